@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// defaultLogMaxSizeMB is the size at which the access log file is rotated when
+// log.max_size_mb is not set.
+const defaultLogMaxSizeMB = 100
+
+// accessLogTimeFormat stamps rotated access log files, e.g.
+// access.log.2024-05-01T03-00-00.000. It sorts chronologically as a string.
+const accessLogTimeFormat = "2006-01-02T15-04-05.000"
+
+// accessLogFormat is the access log line written to log.file: one JSON object
+// per request, so the file can be fed straight to log tooling.
+const accessLogFormat = `{"time":"${time_rfc3339}","remote_ip":"${remote_ip}","method":"${method}","uri":"${uri}",` +
+	`"status":${status},"latency":"${latency_human}","bytes_in":${bytes_in},"bytes_out":${bytes_out},"error":"${error}"}` + "\n"
+
+// accessLogSkipper returns a logger Skipper that suppresses access logs for
+// the given paths.
+func accessLogSkipper(paths []string) middleware.Skipper {
+	skip := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		skip[p] = true
+	}
+	return func(c echo.Context) bool {
+		return skip[c.Request().URL.Path]
+	}
+}
+
+// openAccessLog returns the writer for access logs configured under log:, or
+// nil when log.file is not set and access logs should stay on stdout.
+func openAccessLog(cfg LogConfig) (io.Writer, error) {
+	if strings.TrimSpace(cfg.File) == "" {
+		return nil, nil
+	}
+	maxSizeMB := cfg.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultLogMaxSizeMB
+	}
+	file, err := openRotatingFile(cfg.File, int64(maxSizeMB)*1024*1024, cfg.MaxBackups, time.Duration(cfg.MaxAgeDays)*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// rotatingFile is an append-only log file that is rotated once it would grow
+// past maxSize: the current file is renamed with a timestamp suffix and a new
+// one started. Rotated files beyond maxBackups, or older than maxAge, are
+// deleted; zero keeps them regardless.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+	file       *os.File
+	size       int64
+}
+
+// openRotatingFile opens (or creates) path for appending.
+func openRotatingFile(path string, maxSize int64, maxBackups int, maxAge time.Duration) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups, maxAge: maxAge}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would push the file past maxSize. A
+// single write larger than maxSize still goes to a fresh file whole.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file aside and starts a new one.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	backup := r.path + "." + time.Now().Format(accessLogTimeFormat)
+	if err := os.Rename(r.path, backup); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.prune()
+	return nil
+}
+
+// prune deletes rotated files over the backup count or age limits. Failures
+// are ignored: a stray old log file must never stop logging.
+func (r *rotatingFile) prune() {
+	backups, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups))) // newest first
+
+	kept := 0
+	for _, backup := range backups {
+		stamp, err := time.ParseInLocation(accessLogTimeFormat, strings.TrimPrefix(backup, r.path+"."), time.Local)
+		if err != nil {
+			continue // not one of ours
+		}
+		if (r.maxBackups > 0 && kept >= r.maxBackups) || (r.maxAge > 0 && time.Since(stamp) > r.maxAge) {
+			os.Remove(backup)
+			continue
+		}
+		kept++
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+	r, err := openRotatingFile(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.file.Close()
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != "cccc\n" {
+		t.Errorf("current log = %q, want only the line written after rotation", current)
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 1 {
+		t.Fatalf("got %d rotated files, want 1", len(backups))
+	}
+	if rotated, _ := os.ReadFile(backups[0]); string(rotated) != "aaaa\nbbbb\n" {
+		t.Errorf("rotated log = %q", rotated)
+	}
+}
+
+func TestRotatingFilePrunesBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+
+	// Three old backups, one far past the age limit, plus an unrelated file.
+	now := time.Now()
+	for _, age := range []time.Duration{time.Hour, 2 * time.Hour, 90 * 24 * time.Hour} {
+		name := path + "." + now.Add(-age).Format(accessLogTimeFormat)
+		if err := os.WriteFile(name, []byte("old\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path+".keep-me", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := openRotatingFile(path, 1, 2, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.file.Close()
+	r.Write([]byte("x\n"))
+	r.Write([]byte("y\n")) // rotates, creating a fourth backup and pruning
+
+	backups, _ := filepath.Glob(path + ".*")
+	var ours []string
+	for _, b := range backups {
+		if !strings.HasSuffix(b, ".keep-me") {
+			ours = append(ours, b)
+		}
+	}
+	if len(ours) != 2 {
+		t.Errorf("kept %d rotated files, want 2: %v", len(ours), ours)
+	}
+	if _, err := os.Stat(path + ".keep-me"); err != nil {
+		t.Error("prune removed a file it did not create")
+	}
+}
+
+func TestOpenAccessLogDisabledByDefault(t *testing.T) {
+	w, err := openAccessLog(defaultConfig().Log)
+	if err != nil || w != nil {
+		t.Errorf("openAccessLog(default) = %v, %v; want stdout (nil writer)", w, err)
+	}
+}
+
+func TestAccessLogSkipper(t *testing.T) {
+	skipper := accessLogSkipper([]string{"/", "/api/uptime"})
+	e := echo.New()
+
+	cases := map[string]bool{
+		"/":                 true,
+		"/api/uptime?x=1":   true,
+		"/api/uptime/extra": false,
+		"/api/messages":     false,
+	}
+	for target, want := range cases {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, target, nil), httptest.NewRecorder())
+		if got := skipper(c); got != want {
+			t.Errorf("skip %s = %v, want %v", target, got, want)
+		}
+	}
+}
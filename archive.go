@@ -0,0 +1,395 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxArchiveUploadBytes caps the size of a zip uploaded for extraction.
+const maxArchiveUploadBytes = 256 << 20
+
+// maxExtractedBytes caps the total size of the files extracted from one
+// archive, so a small "zip bomb" can't fill the disk when no quota is set.
+const maxExtractedBytes = 1 << 30
+
+// errExtractTooLarge is returned when an archive expands past maxExtractedBytes.
+var errExtractTooLarge = fmt.Errorf("archive expands to more than %d bytes", maxExtractedBytes)
+
+// errStorageQuotaExceeded is returned when an extracted file doesn't fit in
+// the storage quota.
+var errStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+// unzipEntry is an archive entry checked for extraction, with the absolute
+// path it will be written to.
+type unzipEntry struct {
+	file     *zip.File
+	fullPath string
+}
+
+// @Summary Download a directory as a zip archive
+// @Description Stream the contents of a directory inside the storage directory as a zip archive, e.g. for a bulk export. Only regular files and directories are included; symlinks are skipped so nothing outside the storage directory can end up in the archive. Expired files and files saved with maxDownloads are left out too. With encryption at rest, files are decrypted into the archive.
+// @Tags storage
+// @Accept json
+// @Produce application/zip
+// @Param request body StorageRequest true "Storage request (only path is used)"
+// @Success 200 {file} file "Zip archive"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path or not a directory"
+// @Failure 404 {object} StorageResponse "Directory not found"
+// @Router /api/storage/zip [post]
+func handleStorageZip(c echo.Context) error {
+	var req StorageRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if req.Path == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+
+	root, err := validateAndResolvePath(c, req.Path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	info, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return c.JSON(http.StatusNotFound, StorageResponse{
+			Success: false,
+			Error:   "directory not found",
+		})
+	}
+	if err != nil || !info.IsDir() {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "only directories can be zipped",
+		})
+	}
+
+	// A large directory can take longer to stream than the write timeout.
+	liftDeadlines(c)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/zip")
+	res.Header().Set(echo.HeaderContentDisposition, attachmentDisposition(root+".zip"))
+	res.WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure part-way can only be logged;
+	// the client is left with a truncated archive that fails to open.
+	if err := writeZip(res, root); err != nil {
+		logErrorf("Failed to zip %s: %v", root, err)
+	}
+	return nil
+}
+
+// openStoredFile opens a stored file for reading its plaintext. Unencrypted
+// files are streamed from disk; encrypted ones must be read whole to decrypt.
+func openStoredFile(path string) (io.ReadCloser, error) {
+	if storageCipher == nil {
+		f, err := openLockedFile(path, os.O_RDONLY, 0)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	content, err := readStoredFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// writeZip writes the files and directories under root to w as a zip
+// archive, with paths relative to root. Symlinks and other special files are
+// skipped, as are expired files, files saved with maxDownloads and files
+// removed while the archive is being written.
+func writeZip(w io.Writer, root string) error {
+	zw := zip.NewWriter(w)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if path == root || !(d.IsDir() || d.Type().IsRegular()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			header.Name += "/"
+			_, err := zw.CreateHeader(header)
+			return err
+		}
+
+		// Expired files are as good as gone, and a limited file's reads are
+		// counted one by one, which a bulk export can't do.
+		if storageExpiry.expired(path) {
+			return nil
+		}
+		if downloads, _ := storageDownloads.get(path); downloads.Max > 0 {
+			return nil
+		}
+
+		content, err := openStoredFile(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+
+		header.Method = zip.Deflate
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(entry, content)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// @Summary Upload and extract a zip archive
+// @Description Extract an uploaded zip archive (the raw request body) into a directory inside the storage directory, creating it if needed and overwriting existing files. Every entry is checked before anything is written: paths escaping the directory (zip-slip), symlinks and special files reject the whole archive. Uploads are limited to 256 MiB, extracted content to 1 GiB, and the storage quota applies.
+// @Tags storage
+// @Accept application/zip
+// @Produce json
+// @Param path query string true "Directory to extract into" default(/imports)
+// @Param archive body string true "Zip archive"
+// @Success 200 {object} StorageResponse "Archive extracted"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path, invalid archive or unsafe entry"
+// @Failure 409 {object} StorageResponse "A file already exists at the path"
+// @Failure 413 {object} StorageResponse "Archive or its content too large"
+// @Failure 507 {object} StorageResponse "Storage quota exceeded"
+// @Failure 500 {object} StorageResponse "Internal server error"
+// @Router /api/storage/unzip [post]
+func handleStorageUnzip(c echo.Context) error {
+	// Uploads of up to maxArchiveUploadBytes can outlast the read timeout.
+	extendUploadDeadline(c)
+
+	path := c.QueryParam("path")
+	if path == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+
+	dest, err := validateAndResolvePath(c, path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+	if info, err := os.Stat(dest); err == nil && !info.IsDir() {
+		return c.JSON(http.StatusConflict, StorageResponse{
+			Success: false,
+			Error:   "a file already exists at this path",
+		})
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxArchiveUploadBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, StorageResponse{
+				Success: false,
+				Error:   fmt.Sprintf("archive is larger than %d bytes", maxArchiveUploadBytes),
+			})
+		}
+		logWarnf("Failed to read uploaded archive: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "failed to read request body",
+		})
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "invalid zip archive",
+		})
+	}
+
+	entries, err := planUnzip(c, zr, path, dest)
+	if errors.Is(err, errStorageQuotaExceeded) {
+		setQuotaHeader(c)
+		return c.JSON(http.StatusInsufficientStorage, StorageResponse{
+			Success: false,
+			Error:   "storage quota exceeded",
+		})
+	}
+	if errors.Is(err, errExtractTooLarge) {
+		return c.JSON(http.StatusRequestEntityTooLarge, StorageResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	files := 0
+	for _, entry := range entries {
+		if entry.file.Mode().IsDir() {
+			err = mkdirStorage(entry.fullPath)
+		} else {
+			err = extractZipEntry(entry.file, entry.fullPath)
+			files++
+		}
+		if errors.Is(err, errStorageQuotaExceeded) {
+			setQuotaHeader(c)
+			return c.JSON(http.StatusInsufficientStorage, StorageResponse{
+				Success: false,
+				Error:   fmt.Sprintf("storage quota exceeded at %s", entry.file.Name),
+			})
+		}
+		if err != nil {
+			logErrorf("Failed to extract %s to %s: %v", entry.file.Name, entry.fullPath, err)
+			return c.JSON(http.StatusInternalServerError, StorageResponse{
+				Success: false,
+				Error:   fmt.Sprintf("failed to extract %s", entry.file.Name),
+			})
+		}
+	}
+
+	setQuotaHeader(c)
+	return c.JSON(http.StatusOK, StorageResponse{
+		Success: true,
+		Content: fmt.Sprintf("Extracted %d files", files),
+	})
+}
+
+// planUnzip resolves every entry of zr to a path under dest (the resolved form
+// of the storage path destPath), rejecting the archive if any entry would land
+// outside it or is neither a regular file nor a directory, and checks the
+// declared sizes against maxExtractedBytes and the storage quota. Nothing is
+// written, so a bad archive is rejected as a whole.
+func planUnzip(c echo.Context, zr *zip.Reader, destPath, dest string) ([]unzipEntry, error) {
+	var entries []unzipEntry
+	var total, quotaDelta int64
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if !mode.IsDir() && !mode.IsRegular() {
+			return nil, fmt.Errorf("unsupported entry %s: only files and directories can be extracted", f.Name)
+		}
+		if strings.HasPrefix(f.Name, "/") || strings.Contains(f.Name, "\\") {
+			return nil, fmt.Errorf("unsafe entry path %s", f.Name)
+		}
+
+		fullPath, err := validateAndResolvePath(c, strings.TrimSuffix(destPath, "/")+"/"+f.Name)
+		if err != nil || !strings.HasPrefix(fullPath, dest+string(filepath.Separator)) {
+			return nil, fmt.Errorf("unsafe entry path %s", f.Name)
+		}
+		entries = append(entries, unzipEntry{file: f, fullPath: fullPath})
+		if mode.IsDir() {
+			continue
+		}
+
+		total += int64(f.UncompressedSize64)
+		if f.UncompressedSize64 > maxExtractedBytes || total > maxExtractedBytes {
+			return nil, errExtractTooLarge
+		}
+		quotaDelta += int64(f.UncompressedSize64)
+		if storageCipher != nil {
+			quotaDelta += int64(storageCipher.NonceSize() + storageCipher.Overhead())
+		}
+		if info, err := os.Stat(fullPath); err == nil && info.Mode().IsRegular() {
+			quotaDelta -= info.Size()
+		}
+	}
+
+	if storageUsage != nil && quotaDelta > storageUsage.remaining() {
+		return nil, errStorageQuotaExceeded
+	}
+	return entries, nil
+}
+
+// extractZipEntry writes the content of f to fullPath the way a POST
+// /api/storage save would: serialized per path, encrypted at rest if
+// configured and charged against the quota, while the expiry and download
+// limit of a file it replaces don't carry over. The zip reader fails the read
+// if the content doesn't match the entry's declared size and checksum.
+func extractZipEntry(f *zip.File, fullPath string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	data, err := sealStorageData(content)
+	if err != nil {
+		return err
+	}
+
+	unlock := storageLocks.lock(fullPath)
+	defer unlock()
+	defer invalidateCachedFile(fullPath)
+
+	var quotaDelta int64
+	if storageUsage != nil {
+		quotaDelta = int64(len(data))
+		if info, err := os.Stat(fullPath); err == nil && info.Mode().IsRegular() {
+			quotaDelta -= info.Size()
+		}
+		if !storageUsage.reserve(quotaDelta) {
+			return errStorageQuotaExceeded
+		}
+	}
+
+	err = mkdirStorage(filepath.Dir(fullPath))
+	if err == nil {
+		err = writeStorageFile(fullPath, data)
+	}
+	if err != nil {
+		if storageUsage != nil {
+			storageUsage.release(quotaDelta)
+		}
+		return err
+	}
+	forgetStoredFile(fullPath)
+	return nil
+}
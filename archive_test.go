@@ -0,0 +1,214 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestHandleStorageZip(t *testing.T) {
+	dir := useTempStorage(t)
+	outside := t.TempDir()
+	for name, content := range map[string]string{
+		"exports/a.txt":          "alpha",
+		"exports/sub/b.yaml":     "beta: true",
+		"other/not-included.txt": "x",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "exports", "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("s3cret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "exports", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := doStorageJSON(t, handleStorageZip, http.MethodPost, "/api/storage/zip", `{"path":"/exports"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("content type = %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != "attachment; filename=exports.zip" {
+		t.Errorf("content disposition = %q", cd)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name == "sub/b.yaml" {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, _ := io.ReadAll(r)
+			r.Close()
+			if string(content) != "beta: true" {
+				t.Errorf("sub/b.yaml = %q", content)
+			}
+		}
+	}
+	sort.Strings(names)
+	if got, want := strings.Join(names, ","), "a.txt,empty/,sub/,sub/b.yaml"; got != want {
+		t.Errorf("entries = %s, want %s", got, want)
+	}
+
+	for body, want := range map[string]int{
+		`{"path":"/missing"}`:       http.StatusNotFound,
+		`{"path":"/exports/a.txt"}`: http.StatusBadRequest,
+		`{"path":"/../etc"}`:        http.StatusBadRequest,
+	} {
+		if rec := doStorageJSON(t, handleStorageZip, http.MethodPost, "/api/storage/zip", body); rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, want)
+		}
+	}
+}
+
+// TestHandleStorageZipLimits checks an export leaves out expired files and
+// files with a download limit, rather than reading around them.
+func TestHandleStorageZipLimits(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "exports/kept.txt", "exports/expired.txt", "exports/once.txt")
+	t.Cleanup(func() {
+		storageExpiry.load("")
+		storageDownloads.load(false, "")
+	})
+	storageExpiry.set(filepath.Join(dir, "exports", "expired.txt"), time.Now().Add(-time.Second))
+	storageDownloads.limit(filepath.Join(dir, "exports", "once.txt"), 1)
+
+	rec := doStorageJSON(t, handleStorageZip, http.MethodPost, "/api/storage/zip", `{"path":"/exports"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if got := strings.Join(names, ","); got != "kept.txt" {
+		t.Errorf("entries = %s, want kept.txt", got)
+	}
+	if downloads, _ := storageDownloads.get(filepath.Join(dir, "exports", "once.txt")); downloads.Count != 0 {
+		t.Errorf("export counted %d downloads of the limited file", downloads.Count)
+	}
+}
+
+// makeZip builds an archive from name/content pairs; a name ending in "/" is
+// a directory and a content of "->target" makes a symlink.
+func makeZip(t *testing.T, files [][2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		header := &zip.FileHeader{Name: f[0], Method: zip.Deflate}
+		if target, ok := strings.CutPrefix(f[1], "->"); ok {
+			header.SetMode(os.ModeSymlink | 0o777)
+			f[1] = target
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func doUnzip(t *testing.T, target string, archive []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(archive))
+	req.Header.Set(echo.HeaderContentType, "application/zip")
+	rec := httptest.NewRecorder()
+	if err := handleStorageUnzip(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestHandleStorageUnzip(t *testing.T) {
+	dir := useTempStorage(t)
+
+	rec := doUnzip(t, "/api/storage/unzip?path=/imports", makeZip(t, [][2]string{
+		{"a.txt", "alpha"},
+		{"sub/", ""},
+		{"sub/b.yaml", "beta: true"},
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	for name, want := range map[string]string{"imports/a.txt": "alpha", "imports/sub/b.yaml": "beta: true"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	// A single unsafe entry rejects the whole archive before anything is
+	// written.
+	for name, archive := range map[string][]byte{
+		"zip-slip": makeZip(t, [][2]string{{"ok.txt", "x"}, {"../../evil.txt", "pwned"}}),
+		"absolute": makeZip(t, [][2]string{{"ok.txt", "x"}, {"/etc/evil.txt", "pwned"}}),
+		"symlink":  makeZip(t, [][2]string{{"ok.txt", "x"}, {"link", "->/etc/passwd"}}),
+		"garbage":  []byte("not a zip"),
+	} {
+		if rec := doUnzip(t, "/api/storage/unzip?path=/bad", archive); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400: %s", name, rec.Code, rec.Body)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad")); !os.IsNotExist(err) {
+		t.Errorf("rejected archives must not write anything, stat = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "evil.txt")); !os.IsNotExist(err) {
+		t.Error("zip-slip entry escaped the storage directory")
+	}
+
+	if rec := doUnzip(t, "/api/storage/unzip?path=/imports/a.txt", makeZip(t, [][2]string{{"x", "y"}})); rec.Code != http.StatusConflict {
+		t.Errorf("extracting over a file: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestHandleStorageUnzipQuota(t *testing.T) {
+	useTempStorage(t)
+	appConfig.Storage.Quota = 10
+	if err := initStorageQuota(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storageUsage = nil })
+
+	rec := doUnzip(t, "/api/storage/unzip?path=/imports", makeZip(t, [][2]string{{"big.txt", strings.Repeat("x", 64)}}))
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("status = %d, want 507: %s", rec.Code, rec.Body)
+	}
+}
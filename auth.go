@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// apiKeyContextKey holds the *APIKeyConfig a request authenticated with.
+const apiKeyContextKey = "apiKey"
+
+// unauthenticatedPaths are the /api paths whose Authorization header is never
+// checked: the health check, so monitors need no key, and signed webhooks,
+// which carry their own signature instead.
+var unauthenticatedPaths = map[string]bool{
+	"/api/health":          true,
+	"/api/webhook/message": true,
+}
+
+// validateAPIKeys rejects empty and duplicate keys, and storage directories
+// that leave storage.dir or overlap another key's, which would let one tenant
+// see another's files.
+func validateAPIKeys(keys []APIKeyConfig) error {
+	seen := make(map[string]bool, len(keys))
+	for i, key := range keys {
+		if strings.TrimSpace(key.Key) == "" {
+			return fmt.Errorf("entry %d has no key", i)
+		}
+		if seen[key.Key] {
+			return fmt.Errorf("entry %d repeats a key", i)
+		}
+		seen[key.Key] = true
+
+		if key.StorageDir == "" {
+			continue
+		}
+		dir := filepath.Clean(key.StorageDir)
+		if !filepath.IsLocal(dir) {
+			return fmt.Errorf("entry %d: storage_dir %q must be a subdirectory of storage.dir", i, key.StorageDir)
+		}
+		for j := range keys[:i] {
+			other := filepath.Clean(keys[j].StorageDir)
+			if keys[j].StorageDir != "" && other != dir && (pathWithin(dir, other) || pathWithin(other, dir)) {
+				return fmt.Errorf("entry %d: storage_dir %q overlaps that of entry %d", i, key.StorageDir, j)
+			}
+		}
+	}
+	return nil
+}
+
+// pathWithin reports whether path lies inside the directory dir.
+func pathWithin(path, dir string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// identifyAPIKey returns middleware that records under apiKeyContextKey the
+// key of /api requests sending a valid "Authorization: Bearer <key>" header,
+// so their storage is scoped to its storage_dir, and rejects a bearer token
+// matching no key with 401. Requests without one go through unauthenticated;
+// only routes wrapped in requireAPIKey insist on a key. It runs after CORS, so
+// browsers' preflight requests, which carry no credentials, are answered
+// first.
+func identifyAPIKey(keys []APIKeyConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			path := c.Request().URL.Path
+			if !strings.HasPrefix(path, "/api/") || unauthenticatedPaths[path] {
+				return next(c)
+			}
+			token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok {
+				return next(c)
+			}
+			key := matchAPIKey(keys, strings.TrimSpace(token))
+			if key == nil {
+				return unauthorized(c)
+			}
+			c.Set(apiKeyContextKey, key)
+			return next(c)
+		}
+	}
+}
+
+// requireAPIKey is route middleware that rejects requests identifyAPIKey
+// found no key on with 401. With no keys configured, the API is open and so
+// is the route.
+func requireAPIKey(keys []APIKeyConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if len(keys) > 0 && authenticatedKey(c) == nil {
+				return unauthorized(c)
+			}
+			return next(c)
+		}
+	}
+}
+
+// unauthorized answers a request lacking a valid API key.
+func unauthorized(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+	return echo.NewHTTPError(http.StatusUnauthorized, "a valid API key is required")
+}
+
+// matchAPIKey returns the configured key equal to token, or nil. Every key is
+// compared, in constant time over their digests, so timing reveals neither
+// which key nor how much of one matched.
+func matchAPIKey(keys []APIKeyConfig, token string) *APIKeyConfig {
+	if token == "" {
+		return nil
+	}
+	digest := sha256.Sum256([]byte(token))
+	var match *APIKeyConfig
+	for i := range keys {
+		keyDigest := sha256.Sum256([]byte(keys[i].Key))
+		if subtle.ConstantTimeCompare(digest[:], keyDigest[:]) == 1 {
+			match = &keys[i]
+		}
+	}
+	return match
+}
+
+// storageRoot returns the storage directory of the request: the storage_dir
+// of the API key it authenticated with inside storage.dir, or storage.dir
+// itself for keys without one and when API keys are off.
+func storageRoot(c echo.Context) string {
+	if key := authenticatedKey(c); key != nil && key.StorageDir != "" {
+		return filepath.Join(appConfig.Storage.Dir, key.StorageDir)
+	}
+	return appConfig.Storage.Dir
+}
+
+// authenticatedKey returns the API key the request authenticated with, or nil
+// when no API keys are configured.
+func authenticatedKey(c echo.Context) *APIKeyConfig {
+	key, _ := c.Get(apiKeyContextKey).(*APIKeyConfig)
+	return key
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestAPIKeys checks only routes wrapped in requireAPIKey need a configured
+// key, that an unknown key is rejected everywhere but the open paths, and
+// that the handler learns which key was used.
+func TestAPIKeys(t *testing.T) {
+	keys := []APIKeyConfig{{Name: "dashboard", Key: "k1"}, {Name: "ci", Key: "k2"}}
+	e := echo.New()
+	e.Use(identifyAPIKey(keys))
+	keyName := func(c echo.Context) error {
+		if key := authenticatedKey(c); key != nil {
+			return c.String(http.StatusOK, key.Name)
+		}
+		return c.String(http.StatusOK, "")
+	}
+	e.GET("/api/messages/test", keyName, requireAPIKey(keys))
+	e.Any("/*", keyName)
+
+	cases := []struct {
+		path, authorization string
+		wantStatus          int
+		wantKey             string
+	}{
+		{"/api/messages/test", "Bearer k2", http.StatusOK, "ci"},
+		{"/api/messages/test", "Bearer k1", http.StatusOK, "dashboard"},
+		{"/api/messages/test", "Bearer nope", http.StatusUnauthorized, ""},
+		{"/api/messages/test", "k1", http.StatusUnauthorized, ""},
+		{"/api/messages/test", "", http.StatusUnauthorized, ""},
+		{"/api/messages", "Bearer k1", http.StatusOK, "dashboard"},
+		{"/api/messages", "Bearer nope", http.StatusUnauthorized, ""},
+		{"/api/messages", "", http.StatusOK, ""},
+		{"/api/health", "Bearer nope", http.StatusOK, ""},
+		{"/api/webhook/message", "", http.StatusOK, ""},
+		{"/", "", http.StatusOK, ""},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.authorization != "" {
+			req.Header.Set(echo.HeaderAuthorization, tc.authorization)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tc.wantStatus || (rec.Code == http.StatusOK && rec.Body.String() != tc.wantKey) {
+			t.Errorf("%s with %q: got %d %q, want %d %q", tc.path, tc.authorization, rec.Code, rec.Body.String(), tc.wantStatus, tc.wantKey)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get(echo.HeaderWWWAuthenticate) != "Bearer" {
+			t.Errorf("%s with %q: WWW-Authenticate = %q, want Bearer", tc.path, tc.authorization, rec.Header().Get(echo.HeaderWWWAuthenticate))
+		}
+	}
+}
+
+// TestRequireAPIKeyWithoutKeys checks a route wrapped in requireAPIKey stays
+// open while no keys are configured.
+func TestRequireAPIKeyWithoutKeys(t *testing.T) {
+	e := echo.New()
+	e.GET("/api/messages/test", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, requireAPIKey(nil))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/messages/test", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
+
+func TestValidateAPIKeys(t *testing.T) {
+	if err := validateAPIKeys([]APIKeyConfig{{Key: "a"}, {Name: "b", Key: "b", StorageDir: "tenants/b"}, {Key: "c", StorageDir: "tenants/bc"}}); err != nil {
+		t.Errorf("valid keys: %v", err)
+	}
+	for _, keys := range [][]APIKeyConfig{
+		{{Name: "empty", Key: " "}},
+		{{Key: "a"}, {Key: "a"}},
+		{{Key: "a", StorageDir: "../elsewhere"}},
+		{{Key: "a", StorageDir: "/tmp"}},
+		{{Key: "a", StorageDir: "tenants"}, {Key: "b", StorageDir: "tenants/b"}},
+	} {
+		if err := validateAPIKeys(keys); err == nil {
+			t.Errorf("%+v: expected an error", keys)
+		}
+	}
+}
+
+// TestStorageRootPerAPIKey checks a key's storage_dir confines its storage
+// requests, while keys without one see the whole storage directory.
+func TestStorageRootPerAPIKey(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "shared.txt", "tenants/acme/report.txt")
+	keys := []APIKeyConfig{{Name: "admin", Key: "k1"}, {Name: "acme", Key: "k2", StorageDir: "tenants/acme"}}
+
+	e := echo.New()
+	e.Use(identifyAPIKey(keys))
+	e.Any("/api/storage/*", handleStorageWithPath)
+	get := func(key, path string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/storage"+path, nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, tc := range []struct {
+		key, path string
+		want      int
+	}{
+		{"k2", "/report.txt", http.StatusOK},
+		{"k2", "/shared.txt", http.StatusNotFound},
+		{"k2", "/tenants/acme/report.txt", http.StatusNotFound},
+		{"k1", "/shared.txt", http.StatusOK},
+		{"k1", "/tenants/acme/report.txt", http.StatusOK},
+	} {
+		if got := get(tc.key, tc.path); got != tc.want {
+			t.Errorf("%s reading %s: status = %d, want %d", tc.key, tc.path, got, tc.want)
+		}
+	}
+
+	// Usage and quota cover only the tenant's own files.
+	storageUsage = &storageQuota{limit: 1 << 20}
+	t.Cleanup(func() { storageUsage = nil })
+	usage := func(key string) (StorageUsageResponse, *httptest.ResponseRecorder) {
+		c, rec := newAuthedContext(keys, key, httptest.NewRequest(http.MethodGet, "/api/storage/usage", nil))
+		if err := handleStorageUsage(c); err != nil {
+			t.Fatal(err)
+		}
+		var report StorageUsageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		return report, rec
+	}
+	if report, _ := usage("k2"); report.Files != 1 || report.QuotaBytes != 0 {
+		t.Errorf("tenant usage = %+v, want 1 file and no quota", report)
+	}
+	if report, _ := usage("k1"); report.Files != 2 || report.QuotaBytes != 1<<20 {
+		t.Errorf("admin usage = %+v, want 2 files and the quota", report)
+	}
+
+	// Notifications name the file as the tenant addresses it.
+	appConfig.Storage.NotifyTemplate = "{{.Operation}} {{.Path}}"
+	fake := &fakeNotifier{}
+	prevNotifier := storageNotifier
+	storageNotifier = fake
+	t.Cleanup(func() { storageNotifier = prevNotifier })
+	body := `{"path":"/report.txt","appendLine":"done","notify":["+15550000001"]}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/storage", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c, rec := newAuthedContext(keys, "k2", req)
+	if err := handleStoragePatch(c); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("append: %v, status %d: %s", err, rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get(quotaRemainingHeader); got != "" {
+		t.Errorf("tenant %s = %q, want none", quotaRemainingHeader, got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		fake.mu.Lock()
+		calls := append([]string(nil), fake.calls...)
+		fake.mu.Unlock()
+		if len(calls) > 0 {
+			if want := "+15550000001: PATCH /report.txt"; calls[0] != want {
+				t.Errorf("notification = %q, want %q", calls[0], want)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no notification sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newAuthedContext returns a context for req as authenticated with key.
+func newAuthedContext(keys []APIKeyConfig, key string, req *http.Request) (echo.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set(apiKeyContextKey, matchAPIKey(keys, key))
+	return c, rec
+}
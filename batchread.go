@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxBatchReads caps the number of paths in one batch read.
+const maxBatchReads = 100
+
+// maxBatchReadFileSize is the largest file a batch read returns; batch reads
+// are meant for many small files, and bigger ones should be read on their own.
+const maxBatchReadFileSize = 1 << 20
+
+// @Summary Read files in a batch
+// @Description Read several files in one request, e.g. the small files behind a dashboard. Each path is validated and read on its own: a missing, invalid or unreadable file gets an error in its entry without failing the others. Entries are shaped like a GET /api/storage response, so binary files are base64-encoded. Files over 1 MiB are not returned; read them on their own.
+// @Tags storage
+// @Accept json
+// @Produce json
+// @Param request body StorageBatchReadRequest true "Files to read"
+// @Success 200 {object} StorageBatchReadResponse "Files read; see success and the per-file entries"
+// @Failure 400 {object} StorageBatchReadResponse "Bad request - invalid body, or no or too many paths"
+// @Router /api/storage/batch-read [post]
+func handleStorageBatchRead(c echo.Context) error {
+	var req StorageBatchReadRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageBatchReadResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if len(req.Paths) == 0 {
+		return c.JSON(http.StatusBadRequest, StorageBatchReadResponse{
+			Success: false,
+			Error:   "paths is required",
+		})
+	}
+	if len(req.Paths) > maxBatchReads {
+		return c.JSON(http.StatusBadRequest, StorageBatchReadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("at most %d paths are allowed per request", maxBatchReads),
+		})
+	}
+
+	// The batch takes a single read slot, reading its files one at a time.
+	release, err := acquireReadSlot(c)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	response := StorageBatchReadResponse{Success: true, Files: make(map[string]StorageResponse, len(req.Paths))}
+	for _, path := range req.Paths {
+		file := batchReadFile(c, path)
+		if !file.Success {
+			response.Success = false
+		}
+		response.Files[path] = file
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// batchReadFile reads one file of a batch read, reporting any problem in the
+// returned entry.
+func batchReadFile(c echo.Context, path string) StorageResponse {
+	if path == "" {
+		return StorageResponse{Success: false, Error: "path is required"}
+	}
+	fullPath, err := validateAndResolvePath(c, path)
+	if err != nil {
+		return StorageResponse{Success: false, Error: httpErrorMessage(err)}
+	}
+
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) || storageExpiry.expired(fullPath) {
+		return StorageResponse{Success: false, Error: "file not found"}
+	}
+	if err == nil && !info.Mode().IsRegular() {
+		return StorageResponse{Success: false, Error: "not a file"}
+	}
+	if err == nil && storedContentSize(info) > maxBatchReadFileSize {
+		return StorageResponse{Success: false, Error: fmt.Sprintf("file is larger than %d bytes; read it on its own", maxBatchReadFileSize)}
+	}
+
+	var content []byte
+	if err == nil {
+		done, claimErr := storageDownloads.claim(fullPath)
+		if claimErr != nil {
+			return StorageResponse{Success: false, Error: claimErr.Error()}
+		}
+		content, err = readStoredFileCached(fullPath, info)
+		done(err == nil)
+	}
+	if err != nil {
+		logErrorf("Failed to read file %s: %v", fullPath, err)
+		return StorageResponse{Success: false, Error: "failed to read file"}
+	}
+	return fileContentResponse(content, info)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandleStorageBatchRead(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "dashboard/cpu.json", "dashboard/disk.json")
+	if err := os.WriteFile(filepath.Join(dir, "logo.png"), []byte{0x89, 'P', 'N', 'G', 0x00}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := doStorageJSON(t, handleStorageBatchRead, http.MethodPost, "/api/storage/batch-read",
+		`{"paths": ["/dashboard/cpu.json", "/dashboard/disk.json", "/logo.png", "/missing.json", "/../etc/passwd", "/dashboard"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	var resp StorageBatchReadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success {
+		t.Error("success = true, want false with failed entries")
+	}
+
+	for _, name := range []string{"dashboard/cpu.json", "dashboard/disk.json"} {
+		if file := resp.Files["/"+name]; !file.Success || file.Content != name || file.ModTime == "" {
+			t.Errorf("%s: %+v, want its content", name, file)
+		}
+	}
+	if file := resp.Files["/logo.png"]; !file.Success || file.Encoding != "base64" {
+		t.Errorf("logo.png: %+v, want base64 content", file)
+	}
+	wantErrors := map[string]string{
+		"/missing.json":  "file not found",
+		"/../etc/passwd": "directory traversal",
+		"/dashboard":     "not a file",
+	}
+	for path, want := range wantErrors {
+		if file := resp.Files[path]; file.Success || !strings.Contains(file.Error, want) {
+			t.Errorf("%s: %+v, want error %q", path, file, want)
+		}
+	}
+
+	if rec := doStorageJSON(t, handleStorageBatchRead, http.MethodPost, "/api/storage/batch-read", `{"paths": []}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("no paths: status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// runCommand runs an external program and returns its standard output, for
+// callers to parse. What the program writes to stderr never mixes into it:
+// when the program fails, it is added to the error instead. Every call to
+// osascript and uptime goes through it so tests can substitute a fake and
+// exercise the messaging logic without a Mac or the Messages app.
+var runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+	output, err := exec.CommandContext(ctx, name, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if stderr := bytes.TrimSpace(exitErr.Stderr); len(stderr) > 0 {
+			err = fmt.Errorf("%w: %s", err, stderr)
+		}
+	}
+	return output, err
+}
+
+// commandFailure describes the error of a failed command for a client: what
+// the command wrote to stderr, or the error itself when it wrote nothing.
+func commandFailure(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if stderr := bytes.TrimSpace(exitErr.Stderr); len(stderr) > 0 {
+			return string(stderr)
+		}
+	}
+	return err.Error()
+}
+
+// errMessagingUnavailable is reported for every recipient when osascript is not
+// installed, e.g. when mowa runs on Linux.
+var errMessagingUnavailable = errors.New("messaging not available on this platform (osascript not found)")
+
+// messagingAvailable reports whether osascript was found at startup. It stays
+// true until checkMessagingAvailable says otherwise, so tests that fake
+// runCommand are unaffected.
+var messagingAvailable = true
+
+// checkMessagingAvailable looks for osascript on PATH once at startup and logs
+// a single warning when it is missing, rather than failing noisily on every
+// send.
+func checkMessagingAvailable() {
+	if _, err := exec.LookPath("osascript"); err != nil {
+		messagingAvailable = false
+		logWarnf("⚠️ osascript not found on PATH; messaging is not available on this platform and sends will fail")
+		return
+	}
+	messagingAvailable = true
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestRunCommandSeparatesStderr checks stderr never reaches the output a
+// caller parses, and ends up in the error of a failed command instead.
+func TestRunCommandSeparatesStderr(t *testing.T) {
+	output, err := runCommand(context.Background(), "sh", "-c", "echo out; echo warning >&2")
+	if err != nil || string(output) != "out\n" {
+		t.Errorf("success: got %q, %v; want only stdout", output, err)
+	}
+
+	output, err = runCommand(context.Background(), "sh", "-c", "echo partial; echo 'execution error' >&2; exit 1")
+	if err == nil || !strings.Contains(err.Error(), "execution error") {
+		t.Errorf("failure: error %v, want it to carry stderr", err)
+	}
+	if string(output) != "partial\n" {
+		t.Errorf("failure: output %q, want only stdout", output)
+	}
+	if got := commandFailure(err); got != "execution error" {
+		t.Errorf("failure described as %q, want its stderr", got)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// concurrencyLimit returns middleware that lets at most max requests run at
+// once and turns the rest away with 503 and Retry-After, rather than queueing
+// them. Each message send forks an osascript, so this bounds the number of
+// processes a burst of requests can spawn. Requests for which skipper returns
+// true (the health check) are never limited.
+func concurrencyLimit(max int, skipper middleware.Skipper) echo.MiddlewareFunc {
+	slots := make(chan struct{}, max)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				return next(c)
+			default:
+				c.Response().Header().Set("Retry-After", "1")
+				return c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "server busy, try again shortly"})
+			}
+		}
+	}
+}
+
+// skipConcurrencyLimit exempts GET /api/health from the concurrency limit, so
+// a saturated server still reports its health, and file streams, which stay
+// open indefinitely without spawning anything and would otherwise hold a slot
+// for as long as a client watches.
+func skipConcurrencyLimit(c echo.Context) bool {
+	switch c.Request().URL.Path {
+	case "/api/health", "/api/storage/stream":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	e := echo.New()
+	e.Use(concurrencyLimit(1, skipConcurrencyLimit))
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	e.GET("/api/slow", func(c echo.Context) error {
+		close(entered)
+		<-release
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/api/fast", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/api/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	slowDone := make(chan *httptest.ResponseRecorder)
+	go func() { slowDone <- serve("/api/slow") }()
+	<-entered
+
+	if rec := serve("/api/fast"); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("saturated: status %d, Retry-After %q; want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("/api/health"); rec.Code != http.StatusOK {
+		t.Errorf("health check while saturated: status %d, want 200", rec.Code)
+	}
+
+	close(release)
+	if rec := <-slowDone; rec.Code != http.StatusOK {
+		t.Errorf("slow request: status %d", rec.Code)
+	}
+	if rec := serve("/api/fast"); rec.Code != http.StatusOK {
+		t.Errorf("after release: status %d, want 200", rec.Code)
+	}
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
-	"log"
+	"net/mail"
 	"os"
 	"strings"
 
@@ -17,11 +17,15 @@ var appConfig *Config
 func defaultConfig() *Config {
 	return &Config{
 		Messages: MessagesConfig{
-			Groups:         make(map[string][]string),
-			TimeoutSeconds: defaultSendTimeoutSeconds,
+			Groups:                make(map[string][]string),
+			TimeoutSeconds:        defaultSendTimeoutSeconds,
+			IdempotencyTTLSeconds: defaultIdempotencyTTLSeconds,
+			MaxRecipients:         defaultMaxRecipients,
 		},
 		Storage: StorageConfig{
-			Dir: "./storage", // Default storage directory
+			Dir:      "./storage", // Default storage directory
+			dirMode:  defaultStorageDirMode,
+			fileMode: defaultStorageFileMode,
 		},
 		Reminders: RemindersConfig{
 			TimeoutSeconds: defaultReminderTimeoutSeconds,
@@ -30,6 +34,18 @@ func defaultConfig() *Config {
 			Schedule:       defaultUpdateCheckSchedule,
 			TimeoutSeconds: defaultUpdateCheckTimeoutSeconds,
 		},
+		Heartbeat: HeartbeatConfig{
+			RebootThresholdSeconds: defaultHeartbeatRebootThresholdSeconds,
+		},
+		Log: LogConfig{
+			MaxSizeMB: defaultLogMaxSizeMB,
+		},
+		Server: ServerConfig{
+			ReadTimeoutSeconds:   defaultReadTimeoutSeconds,
+			WriteTimeoutSeconds:  defaultWriteTimeoutSeconds,
+			UploadTimeoutSeconds: defaultUploadTimeoutSeconds,
+			IdleTimeoutSeconds:   defaultIdleTimeoutSeconds,
+		},
 	}
 }
 
@@ -48,7 +64,7 @@ func loadConfig(configPath string) (*Config, error) {
 		// installed by `mowa install`) still starts. Other read errors such as
 		// bad permissions are real and surfaced to the caller.
 		if errors.Is(err, os.ErrNotExist) {
-			log.Printf("Config file %s not found; using defaults", configPath)
+			logInfof("Config file %s not found; using defaults", configPath)
 			return defaultConfig(), nil
 		}
 		return nil, fmt.Errorf("failed to read config file %s: %w", configPath, err)
@@ -65,16 +81,74 @@ func loadConfig(configPath string) (*Config, error) {
 		config.Messages.Groups = make(map[string][]string)
 	}
 
+	// Reject malformed message templates up front rather than on first use
+	for name, text := range config.Messages.Templates {
+		if _, err := parseMessageTemplate(name, text); err != nil {
+			return nil, fmt.Errorf("invalid messages.templates entry %q: %w", name, err)
+		}
+	}
+
+	// Reject a malformed storage notification template up front as well
+	if config.Storage.NotifyTemplate != "" {
+		if _, err := parseNotifyTemplate(config.Storage.NotifyTemplate); err != nil {
+			return nil, fmt.Errorf("invalid storage.notify_template: %w", err)
+		}
+	}
+	if len(config.Storage.NotifyMessages) > 0 {
+		// Operations are matched in upper case, as notifications name them
+		messages := make(map[string]string, len(config.Storage.NotifyMessages))
+		for operation, text := range config.Storage.NotifyMessages {
+			if _, err := parseNotifyTemplate(text); err != nil {
+				return nil, fmt.Errorf("invalid storage.notify_messages entry %q: %w", operation, err)
+			}
+			messages[strings.ToUpper(strings.TrimSpace(operation))] = text
+		}
+		config.Storage.NotifyMessages = messages
+	}
+
 	// Set default storage directory if not specified
 	if config.Storage.Dir == "" {
 		config.Storage.Dir = "./storage"
 	}
 
+	// Parse storage permissions, keeping the defaults when not specified
+	config.Storage.dirMode, config.Storage.fileMode = defaultStorageDirMode, defaultStorageFileMode
+	if config.Storage.DirMode != "" {
+		if config.Storage.dirMode, err = parseFileMode(config.Storage.DirMode); err != nil {
+			return nil, fmt.Errorf("invalid storage.dir_mode: %w", err)
+		}
+	}
+	if config.Storage.FileMode != "" {
+		if config.Storage.fileMode, err = parseFileMode(config.Storage.FileMode); err != nil {
+			return nil, fmt.Errorf("invalid storage.file_mode: %w", err)
+		}
+	}
+
 	// Set default send timeout if not specified or invalid
 	if config.Messages.TimeoutSeconds <= 0 {
 		config.Messages.TimeoutSeconds = defaultSendTimeoutSeconds
 	}
 
+	// Set default idempotency window if not specified or invalid
+	if config.Messages.IdempotencyTTLSeconds <= 0 {
+		config.Messages.IdempotencyTTLSeconds = defaultIdempotencyTTLSeconds
+	}
+
+	// Set default recipient limit if not specified or invalid
+	if config.Messages.MaxRecipients <= 0 {
+		config.Messages.MaxRecipients = defaultMaxRecipients
+	}
+
+	switch config.Messages.RateLimitAction {
+	case "", rateLimitQueue, rateLimitReject:
+	default:
+		return nil, fmt.Errorf("invalid messages.rate_limit_action %q (expected %s or %s)", config.Messages.RateLimitAction, rateLimitQueue, rateLimitReject)
+	}
+
+	if config.Messages.SendDelay < 0 {
+		return nil, fmt.Errorf("invalid messages.send_delay %s: must not be negative", config.Messages.SendDelay)
+	}
+
 	// Set default reminders timeout if not specified or invalid
 	if config.Reminders.TimeoutSeconds <= 0 {
 		config.Reminders.TimeoutSeconds = defaultReminderTimeoutSeconds
@@ -88,7 +162,71 @@ func loadConfig(configPath string) (*Config, error) {
 		config.SoftwareUpdateCheck.TimeoutSeconds = defaultUpdateCheckTimeoutSeconds
 	}
 
-	log.Printf("Configuration loaded from %s with %d message groups and storage dir: %s", configPath, len(config.Messages.Groups), config.Storage.Dir)
+	// Set default heartbeat reboot threshold if not specified or invalid
+	if config.Heartbeat.RebootThresholdSeconds <= 0 {
+		config.Heartbeat.RebootThresholdSeconds = defaultHeartbeatRebootThresholdSeconds
+	}
+
+	switch config.Storage.DownloadLimitAction {
+	case "", downloadLimitGone, downloadLimitDelete:
+	default:
+		return nil, fmt.Errorf("invalid storage.download_limit_action %q (expected %s or %s)", config.Storage.DownloadLimitAction, downloadLimitGone, downloadLimitDelete)
+	}
+
+	// The index file is looked up inside each directory, so it must be a
+	// plain file name
+	if name := config.Storage.IndexFile; name != "" && (name == "." || name == ".." || strings.ContainsAny(name, `/\`)) {
+		return nil, fmt.Errorf("invalid storage.index_file %q: must be a file name, not a path", name)
+	}
+
+	// Email needs somewhere to send from
+	if config.Email.isEnabled() {
+		if _, err := mail.ParseAddress(config.Email.From); err != nil {
+			return nil, fmt.Errorf("email.from must be a valid address when email.host is set")
+		}
+	}
+
+	if config.Storage.UseFileLocks && !fileLocksSupported {
+		return nil, fmt.Errorf("storage.use_file_locks is not supported on this platform")
+	}
+
+	// Reject malformed trusted proxies up front
+	if _, err := parseTrustedProxies(config.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid server.trusted_proxies: %w", err)
+	}
+
+	if err := validateAPIKeys(config.Auth.APIKeys); err != nil {
+		return nil, fmt.Errorf("invalid auth.api_keys: %w", err)
+	}
+
+	if _, err := corsPolicies(config.Server.CORS); err != nil {
+		return nil, fmt.Errorf("invalid server.cors: %w", err)
+	}
+
+	if err := validateResponseHeaders(config.Server.ResponseHeaders); err != nil {
+		return nil, fmt.Errorf("invalid server.response_headers: %w", err)
+	}
+
+	// Set default HTTP server timeouts if not specified or invalid
+	if config.Server.ReadTimeoutSeconds <= 0 {
+		config.Server.ReadTimeoutSeconds = defaultReadTimeoutSeconds
+	}
+	if config.Server.WriteTimeoutSeconds <= 0 {
+		config.Server.WriteTimeoutSeconds = defaultWriteTimeoutSeconds
+	}
+	if config.Server.UploadTimeoutSeconds <= 0 {
+		config.Server.UploadTimeoutSeconds = defaultUploadTimeoutSeconds
+	}
+	if config.Server.IdleTimeoutSeconds <= 0 {
+		config.Server.IdleTimeoutSeconds = defaultIdleTimeoutSeconds
+	}
+
+	// Set default access log rotation size if not specified or invalid
+	if config.Log.MaxSizeMB <= 0 {
+		config.Log.MaxSizeMB = defaultLogMaxSizeMB
+	}
+
+	logInfof("Configuration loaded from %s with %d message groups and storage dir: %s", configPath, len(config.Messages.Groups), config.Storage.Dir)
 	return &config, nil
 }
 
@@ -101,10 +239,10 @@ func expandGroups(recipients []string) []string {
 	var expanded []string
 	for _, recipient := range recipients {
 		// Check if this recipient is a group name
-		if groupMembers, exists := appConfig.Messages.Groups[recipient]; exists {
+		if members, exists := groupMembers(recipient); exists {
 			// Add all group members
-			expanded = append(expanded, groupMembers...)
-			log.Printf("Expanded group '%s' to %d recipients", recipient, len(groupMembers))
+			expanded = append(expanded, members...)
+			logDebugf("Expanded group '%s' to %d recipients", recipient, len(members))
 		} else {
 			// Not a group, add as individual recipient
 			expanded = append(expanded, recipient)
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"net/http"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 // TestLoadConfigMissingFileFallsBackToDefaults ensures a config path that does
@@ -90,3 +92,114 @@ func TestLoadConfigUnreadableFileErrors(t *testing.T) {
 		t.Fatal("expected an error reading a directory as a config file, got nil")
 	}
 }
+
+// TestSwaggerEnabledByDefault checks the swagger docs are served unless the
+// config explicitly turns them off.
+func TestSwaggerEnabledByDefault(t *testing.T) {
+	if !defaultConfig().Swagger.isEnabled() {
+		t.Error("swagger should be enabled by default")
+	}
+	off := false
+	if (SwaggerConfig{Enabled: &off}).isEnabled() {
+		t.Error("swagger.enabled: false should disable it")
+	}
+}
+
+// TestLoadConfigStorageModes checks dir_mode/file_mode are parsed as octal,
+// default when absent, and rejected when malformed.
+func TestLoadConfigStorageModes(t *testing.T) {
+	load := func(yaml string) (*Config, error) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return loadConfig(path)
+	}
+
+	cfg, err := load("storage:\n  dir_mode: \"0775\"\n  file_mode: \"600\"\n")
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Storage.dirMode != 0o775 || cfg.Storage.fileMode != 0o600 {
+		t.Errorf("modes = %o/%o, want 775/600", cfg.Storage.dirMode, cfg.Storage.fileMode)
+	}
+
+	cfg, err = load("storage:\n  dir: ./s\n")
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Storage.dirMode != defaultStorageDirMode || cfg.Storage.fileMode != defaultStorageFileMode {
+		t.Errorf("default modes = %o/%o", cfg.Storage.dirMode, cfg.Storage.fileMode)
+	}
+
+	for _, bad := range []string{"rwxr-xr-x", "0888", "01777"} {
+		if _, err := load("storage:\n  dir_mode: \"" + bad + "\"\n"); err == nil {
+			t.Errorf("dir_mode %q: expected an error", bad)
+		}
+	}
+}
+
+// TestLoadConfigServerTimeouts checks the HTTP server timeouts are read from
+// the config, fall back to defaults when unset or invalid, and are applied to
+// the server.
+func TestLoadConfigServerTimeouts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := "server:\n  read_timeout_seconds: 10\n  write_timeout_seconds: -1\n"
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.Server.ReadTimeoutSeconds != 10 || cfg.Server.WriteTimeoutSeconds != defaultWriteTimeoutSeconds ||
+		cfg.Server.UploadTimeoutSeconds != defaultUploadTimeoutSeconds || cfg.Server.IdleTimeoutSeconds != defaultIdleTimeoutSeconds {
+		t.Errorf("timeouts = %+v", cfg.Server)
+	}
+
+	var s http.Server
+	applyServerTimeouts(&s, cfg.Server)
+	if s.ReadTimeout != 10*time.Second || s.ReadHeaderTimeout != 10*time.Second ||
+		s.WriteTimeout != defaultWriteTimeoutSeconds*time.Second || s.IdleTimeout != defaultIdleTimeoutSeconds*time.Second {
+		t.Errorf("server timeouts: read %s, header %s, write %s, idle %s", s.ReadTimeout, s.ReadHeaderTimeout, s.WriteTimeout, s.IdleTimeout)
+	}
+}
+
+func TestLoadConfigEmail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	for yaml, wantErr := range map[string]bool{
+		"email:\n  host: smtp.example.com\n":                           true,
+		"email:\n  host: smtp.example.com\n  from: not an address\n":   true,
+		"email:\n  host: smtp.example.com\n  from: mowa@example.com\n": false,
+		"email:\n  from: mowa@example.com\n":                           false,
+	} {
+		if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(path); (err != nil) != wantErr {
+			t.Errorf("%q: err = %v, want error %v", yaml, err, wantErr)
+		}
+	}
+}
+
+func TestLoadConfigNotifyMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("storage:\n  notify_messages:\n    post: \"Saved {{.Path}}\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Storage.NotifyMessages["POST"]; got != "Saved {{.Path}}" {
+		t.Errorf("notify_messages[POST] = %q, want the post template keyed in upper case", got)
+	}
+
+	if err := os.WriteFile(path, []byte("storage:\n  notify_messages:\n    GET: \"{{.Nope}}\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil {
+		t.Error("unknown template field: expected an error")
+	}
+}
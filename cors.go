@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Methods and request headers preflight requests are told they may use when
+// server.cors.allow_methods and allow_headers are not set: those of mowa's
+// API.
+var (
+	defaultCORSAllowMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+	defaultCORSAllowHeaders = []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderContentEncoding, echo.HeaderAccept, echo.HeaderAuthorization, idempotencyKeyHeader, "If-Unmodified-Since"}
+)
+
+// corsPolicy is the CORS middleware for the paths under prefix; an empty
+// prefix is the server-wide default.
+type corsPolicy struct {
+	prefix     string
+	middleware echo.MiddlewareFunc
+}
+
+// corsPolicies builds the policies of server.cors, the most specific prefix
+// first and the default last.
+func corsPolicies(cfg CORSConfig) ([]corsPolicy, error) {
+	methods, headers, err := corsAllowLists(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies []corsPolicy
+	for i, route := range cfg.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return nil, fmt.Errorf("routes[%d].path must start with /", i)
+		}
+		if len(route.AllowOrigins) == 0 {
+			return nil, fmt.Errorf("routes[%d].allow_origins is required", i)
+		}
+		policies = append(policies, corsPolicy{
+			prefix:     strings.TrimSuffix(route.Path, "/"),
+			middleware: newCORS(route.AllowOrigins, methods, headers),
+		})
+	}
+	// Longest prefix first, so the first match is the most specific.
+	sort.SliceStable(policies, func(i, j int) bool {
+		return len(policies[i].prefix) > len(policies[j].prefix)
+	})
+
+	origins := cfg.AllowOrigins
+	if len(origins) == 0 {
+		origins = []string{"*"}
+	}
+	return append(policies, corsPolicy{middleware: newCORS(origins, methods, headers)}), nil
+}
+
+// corsAllowLists returns the methods and request headers of cfg, or their
+// defaults. Methods are upper-cased. A lone "*" header comes back as nil,
+// which makes preflights allow whatever headers they ask for.
+func corsAllowLists(cfg CORSConfig) (methods, headers []string, err error) {
+	methods = defaultCORSAllowMethods
+	if len(cfg.AllowMethods) > 0 {
+		methods = make([]string, len(cfg.AllowMethods))
+		for i, method := range cfg.AllowMethods {
+			if !validHeaderName(method) {
+				return nil, nil, fmt.Errorf("allow_methods: invalid method %q", method)
+			}
+			methods[i] = strings.ToUpper(method)
+		}
+	}
+
+	headers = defaultCORSAllowHeaders
+	if len(cfg.AllowHeaders) == 1 && cfg.AllowHeaders[0] == "*" {
+		return methods, nil, nil
+	}
+	if len(cfg.AllowHeaders) > 0 {
+		for _, name := range cfg.AllowHeaders {
+			if name == "*" {
+				return nil, nil, fmt.Errorf("allow_headers: \"*\" must be the only entry")
+			}
+			if !validHeaderName(name) {
+				return nil, nil, fmt.Errorf("allow_headers: invalid header name %q", name)
+			}
+		}
+		headers = cfg.AllowHeaders
+	}
+	return methods, headers, nil
+}
+
+// newCORS is echo's CORS middleware allowing origins to use methods and send
+// headers; nil headers allows any a preflight asks for.
+func newCORS(origins, methods, headers []string) echo.MiddlewareFunc {
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins: origins,
+		AllowMethods: methods,
+		AllowHeaders: headers,
+	})
+}
+
+// corsMiddleware returns middleware that applies, to each request, the CORS
+// policy of server.cors whose route prefix matches its path, or the default.
+// Preflight requests are matched on their path too, so each route answers
+// them with its own origins. Every preflight gets 204 No Content, whether or
+// not a handler is registered for its path or method, so browsers always
+// learn what is allowed.
+func corsMiddleware(cfg CORSConfig) (echo.MiddlewareFunc, error) {
+	policies, err := corsPolicies(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		handlers := make([]echo.HandlerFunc, len(policies))
+		for i, policy := range policies {
+			handlers[i] = policy.middleware(next)
+		}
+		return func(c echo.Context) error {
+			path := c.Request().URL.Path
+			for i, policy := range policies {
+				if policy.prefix == "" || path == policy.prefix || strings.HasPrefix(path, policy.prefix+"/") {
+					return handlers[i](c)
+				}
+			}
+			return next(c)
+		}
+	}, nil
+}
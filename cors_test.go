@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestCORSPerRoute checks each path gets the origins of its longest matching
+// route prefix, falling back to the default, for requests and preflights.
+func TestCORSPerRoute(t *testing.T) {
+	cors, err := corsMiddleware(CORSConfig{
+		AllowOrigins: []string{"https://dashboard.example.com"},
+		Routes: []CORSRouteConfig{
+			{Path: "/api/storage", AllowOrigins: []string{"*"}},
+			{Path: "/api/storage/private/", AllowOrigins: []string{"https://admin.example.com"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(cors)
+	e.Any("/*", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	cases := []struct {
+		method, path, origin, want string
+	}{
+		{http.MethodGet, "/api/storage/report.txt", "https://blog.example.com", "*"},
+		{http.MethodOptions, "/api/storage/report.txt", "https://blog.example.com", "*"},
+		{http.MethodGet, "/api/storage/private/key.txt", "https://admin.example.com", "https://admin.example.com"},
+		{http.MethodGet, "/api/storage/private/key.txt", "https://blog.example.com", ""},
+		{http.MethodGet, "/api/storagex", "https://blog.example.com", ""},
+		{http.MethodOptions, "/api/messages", "https://blog.example.com", ""},
+		{http.MethodPost, "/api/messages", "https://dashboard.example.com", "https://dashboard.example.com"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set(echo.HeaderOrigin, tc.origin)
+		if tc.method == http.MethodOptions {
+			req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if got := rec.Header().Get(echo.HeaderAccessControlAllowOrigin); got != tc.want {
+			t.Errorf("%s %s from %s: Access-Control-Allow-Origin = %q, want %q", tc.method, tc.path, tc.origin, got, tc.want)
+		}
+	}
+}
+
+// TestCORSPreflight checks preflights get 204 with the configured methods and
+// headers on any path, registered or not, ahead of API key checks.
+func TestCORSPreflight(t *testing.T) {
+	preflight := func(cfg CORSConfig, path, requestHeaders string) *httptest.ResponseRecorder {
+		t.Helper()
+		cors, err := corsMiddleware(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := echo.New()
+		e.Use(cors)
+		keys := []APIKeyConfig{{Key: "secret"}}
+		e.Use(identifyAPIKey(keys))
+		e.GET("/api/storage/tree", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, requireAPIKey(keys))
+
+		req := httptest.NewRequest(http.MethodOptions, path, nil)
+		req.Header.Set(echo.HeaderOrigin, "https://dashboard.example.com")
+		req.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodGet)
+		req.Header.Set(echo.HeaderAccessControlRequestHeaders, requestHeaders)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	cases := []struct {
+		name                   string
+		cfg                    CORSConfig
+		path, wantMethods      string
+		requested, wantHeaders string
+	}{
+		{"defaults", CORSConfig{}, "/api/storage/tree", "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+			"Idempotency-Key", "Origin,Content-Type,Content-Encoding,Accept,Authorization,Idempotency-Key,If-Unmodified-Since"},
+		{"unregistered path", CORSConfig{}, "/api/nowhere", "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+			"Authorization", "Origin,Content-Type,Content-Encoding,Accept,Authorization,Idempotency-Key,If-Unmodified-Since"},
+		{"configured", CORSConfig{AllowMethods: []string{"get", "post"}, AllowHeaders: []string{"X-Trace", "Authorization"}}, "/api/storage/tree", "GET,POST",
+			"X-Trace", "X-Trace,Authorization"},
+		{"any header", CORSConfig{AllowHeaders: []string{"*"}}, "/api/storage/tree", "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+			"X-Trace,X-Other", "X-Trace,X-Other"},
+	}
+	for _, tc := range cases {
+		rec := preflight(tc.cfg, tc.path, tc.requested)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s: status = %d, want 204", tc.name, rec.Code)
+		}
+		if got := rec.Header().Get(echo.HeaderAccessControlAllowMethods); got != tc.wantMethods {
+			t.Errorf("%s: Access-Control-Allow-Methods = %q, want %q", tc.name, got, tc.wantMethods)
+		}
+		if got := rec.Header().Get(echo.HeaderAccessControlAllowHeaders); got != tc.wantHeaders {
+			t.Errorf("%s: Access-Control-Allow-Headers = %q, want %q", tc.name, got, tc.wantHeaders)
+		}
+	}
+}
+
+func TestCORSPoliciesValidation(t *testing.T) {
+	for _, cfg := range []CORSConfig{
+		{Routes: []CORSRouteConfig{{Path: "api/storage", AllowOrigins: []string{"*"}}}},
+		{Routes: []CORSRouteConfig{{Path: "/api/storage"}}},
+		{AllowMethods: []string{"GET", "PO ST"}},
+		{AllowHeaders: []string{"X-Trace:"}},
+		{AllowHeaders: []string{"*", "Authorization"}},
+	} {
+		if _, err := corsPolicies(cfg); err == nil {
+			t.Errorf("%+v: expected an error", cfg)
+		}
+	}
+}
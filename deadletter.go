@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxDeadLetters caps how many failed sends are kept; beyond it the oldest are
+// dropped so a recipient that never succeeds can't grow the list forever.
+const maxDeadLetters = 1000
+
+// deadLetterStore records messages that failed to send so they can be listed
+// and retried later. It is kept in memory and, when messages.dead_letter_file
+// is set, mirrored to that file so it survives restarts.
+type deadLetterStore struct {
+	mu      sync.Mutex
+	path    string
+	entries []FailedMessage
+}
+
+var deadLetters = &deadLetterStore{}
+
+// initDeadLetters loads the failed sends persisted in
+// messages.dead_letter_file, if configured. A missing file is an empty list.
+func initDeadLetters() error {
+	return deadLetters.load(appConfig.Messages.DeadLetterFile)
+}
+
+// load replaces the store's entries with those in path and persists future
+// changes there. An empty path keeps the store in memory only.
+func (s *deadLetterStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path, s.entries = path, nil
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.entries)
+}
+
+// add records failed sends, dropping the oldest beyond maxDeadLetters.
+func (s *deadLetterStore) add(failed ...FailedMessage) {
+	if len(failed) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, failed...)
+	if over := len(s.entries) - maxDeadLetters; over > 0 {
+		s.entries = append([]FailedMessage(nil), s.entries[over:]...)
+	}
+	s.save()
+}
+
+// list returns a copy of the recorded failed sends, oldest first.
+func (s *deadLetterStore) list() []FailedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]FailedMessage{}, s.entries...)
+}
+
+// take removes and returns the entries with the given IDs, or every entry when
+// ids is empty, along with any IDs that weren't found. Taking them out before
+// resending means concurrent retries never send the same message twice.
+func (s *deadLetterStore) take(ids []string) (taken []FailedMessage, unknown []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(ids) == 0 {
+		taken, s.entries = s.entries, nil
+		s.save()
+		return taken, nil
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var kept []FailedMessage
+	for _, entry := range s.entries {
+		if wanted[entry.ID] {
+			taken = append(taken, entry)
+			delete(wanted, entry.ID)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	for _, id := range ids {
+		if wanted[id] {
+			unknown = append(unknown, id)
+			delete(wanted, id)
+		}
+	}
+	s.entries = kept
+	s.save()
+	return taken, unknown
+}
+
+// save writes the entries to the dead-letter file, replacing it atomically.
+// The caller must hold s.mu. Failures are logged: the entries are still held in
+// memory, so a write error must not fail the send that produced them.
+func (s *deadLetterStore) save() {
+	if s.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(append([]FailedMessage{}, s.entries...), "", "  ")
+	if err != nil {
+		logErrorf("Failed to encode dead letters: %v", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		logErrorf("Failed to write dead letters to %s: %v", s.path, err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logErrorf("Failed to write dead letters to %s: %v", s.path, err)
+	}
+}
+
+// newDeadLetterID returns a random identifier for a failed send.
+func newDeadLetterID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// recordFailedSends adds every failed result of sending parts to the
+// dead-letter store, keeping the exact part that failed for a split message.
+func recordFailedSends(results []MessageResult, parts []string) {
+	var failed []FailedMessage
+	for _, result := range results {
+		if result.Success {
+			continue
+		}
+		message := parts[0]
+		if result.Part > 0 {
+			message = parts[result.Part-1]
+		}
+		entry := FailedMessage{
+			ID:        newDeadLetterID(),
+			Recipient: result.Recipient,
+			Message:   message,
+			FailedAt:  time.Now().UTC(),
+			Attempts:  1,
+		}
+		if result.Error != nil {
+			entry.Error = *result.Error
+		}
+		failed = append(failed, entry)
+	}
+	deadLetters.add(failed...)
+}
+
+// @Summary List failed messages
+// @Description List messages that failed to send through POST /api/messages (AppleScript errors, invalid numbers), oldest first, so they can be retried with POST /api/messages/retry.
+// @Tags messages
+// @Produce json
+// @Success 200 {object} FailedMessagesResponse "Failed messages"
+// @Router /api/messages/failed [get]
+func handleListFailedMessages(c echo.Context) error {
+	return c.JSON(http.StatusOK, FailedMessagesResponse{Failed: deadLetters.list()})
+}
+
+// @Summary Retry failed messages
+// @Description Re-send failed messages, selected by id or all of them when ids is omitted. Messages that go through are removed from the failed list; those that fail again stay in it with the new error and an incremented attempt count.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param request body RetryMessagesRequest false "Failed messages to retry"
+// @Success 200 {object} RetryMessagesResponse "Retry results"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Router /api/messages/retry [post]
+func handleRetryFailedMessages(c echo.Context) error {
+	// Like a send, a retry of many messages can outlast the write timeout.
+	liftWriteDeadline(c)
+
+	var request RetryMessagesRequest
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":   "Invalid request format",
+				"details": err.Error(),
+			})
+		}
+	}
+
+	taken, unknown := deadLetters.take(request.IDs)
+
+	response := RetryMessagesResponse{Results: []RetryResult{}}
+	var stillFailed []FailedMessage
+	for _, entry := range taken {
+		result := sendMessages([]string{entry.Recipient}, entry.Message)[0]
+		recordSend([]string{entry.Recipient}, entry.Message, []MessageResult{result})
+		response.Results = append(response.Results, RetryResult{
+			ID:        entry.ID,
+			Recipient: entry.Recipient,
+			Success:   result.Success,
+			Error:     result.Error,
+		})
+		if !result.Success {
+			entry.Attempts++
+			entry.FailedAt = time.Now().UTC()
+			if result.Error != nil {
+				entry.Error = *result.Error
+			}
+			stillFailed = append(stillFailed, entry)
+		}
+	}
+	deadLetters.add(stillFailed...)
+
+	for _, id := range unknown {
+		errorMsg := "no failed message with this id"
+		response.Results = append(response.Results, RetryResult{ID: id, Error: &errorMsg})
+	}
+	return c.JSON(http.StatusOK, response)
+}
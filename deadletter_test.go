@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// useTempDeadLetters points the dead-letter store at a fresh file for the test.
+func useTempDeadLetters(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "failed.json")
+	if err := deadLetters.load(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { deadLetters.load("") })
+	return path
+}
+
+func doMessagesJSON(t *testing.T, handler echo.HandlerFunc, method, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	if body != "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	if err := handler(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// TestDeadLetterRetry sends to a failing and an invalid recipient, then checks
+// both are listed, survive a reload from disk, and that a successful retry
+// removes only the message that went through.
+func TestDeadLetterRetry(t *testing.T) {
+	prev := appConfig
+	appConfig = defaultConfig()
+	t.Cleanup(func() { appConfig = prev })
+	path := useTempDeadLetters(t)
+
+	down := true
+	fakeOSAScript(t, func(script string) ([]byte, error) {
+		if down {
+			return nil, errors.New("exit status 1: Messages got an error")
+		}
+		return nil, nil
+	})
+
+	doMessagesJSON(t, handleSendMessages, http.MethodPost, `{"to":["+15550000001","+1555"],"message":"hi"}`)
+
+	if err := deadLetters.load(path); err != nil {
+		t.Fatalf("reloading: %v", err)
+	}
+	var listed FailedMessagesResponse
+	rec := doMessagesJSON(t, handleListFailedMessages, http.MethodGet, "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Failed) != 2 {
+		t.Fatalf("failed = %+v, want 2", listed.Failed)
+	}
+	first := listed.Failed[0]
+	if first.Recipient != "+15550000001" || first.Message != "hi" || first.Attempts != 1 || !strings.Contains(first.Error, "Messages got an error") {
+		t.Errorf("first failure = %+v", first)
+	}
+
+	down = false
+	var retried RetryMessagesResponse
+	rec = doMessagesJSON(t, handleRetryFailedMessages, http.MethodPost, `{"ids":["`+first.ID+`","`+listed.Failed[1].ID+`","nope"]}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &retried); err != nil {
+		t.Fatal(err)
+	}
+	if len(retried.Results) != 3 || !retried.Results[0].Success || retried.Results[1].Success || retried.Results[2].Error == nil {
+		t.Errorf("retry results = %+v", retried.Results)
+	}
+
+	remaining := deadLetters.list()
+	if len(remaining) != 1 || remaining[0].Recipient != "+1555" || remaining[0].Attempts != 2 {
+		t.Errorf("remaining = %+v, want only the invalid number, attempted twice", remaining)
+	}
+}
+
+func TestDeadLetterCap(t *testing.T) {
+	useTempDeadLetters(t)
+	for i := 0; i < maxDeadLetters+5; i++ {
+		deadLetters.add(FailedMessage{ID: newDeadLetterID()})
+	}
+	if n := len(deadLetters.list()); n != maxDeadLetters {
+		t.Errorf("kept %d dead letters, want %d", n, maxDeadLetters)
+	}
+}
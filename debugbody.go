@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// debugEnv names the environment variable that, when true, logs the body of
+// /api requests whose JSON fails to bind, to help diagnose client
+// integrations.
+const debugEnv = "MOWA_DEBUG"
+
+// debugBodyCaptureBytes is how much of a request body is kept for logging;
+// debugBodyLogBytes is how much of it, once redacted, is logged.
+const (
+	debugBodyCaptureBytes = 64 << 10
+	debugBodyLogBytes     = 2 << 10
+)
+
+// redactedFields are the JSON fields whose values are never logged: message
+// and file contents, and anything that may hold a credential. Names are
+// compared case-insensitively.
+var redactedFields = []string{
+	"message", "content", "find", "replace", "vars", "notes", "data",
+	"password", "token", "secret", "apiKey", "authorization",
+}
+
+// redactedStringPattern matches a redacted field with a string value, even in
+// JSON too broken to parse or cut off by the capture limit.
+var redactedStringPattern = regexp.MustCompile(`("(?i:` + strings.Join(redactedFields, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// debugEnabled reports whether MOWA_DEBUG asks for request bodies to be
+// logged.
+func debugEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(debugEnv))
+	return enabled
+}
+
+// debugBinder binds like echo's DefaultBinder, but when binding an /api
+// request fails it logs what the client sent, truncated and with
+// redactedFields masked. Request bodies are otherwise never logged.
+type debugBinder struct {
+	echo.DefaultBinder
+}
+
+func (b *debugBinder) Bind(i interface{}, c echo.Context) error {
+	req := c.Request()
+	if !strings.HasPrefix(req.URL.Path, "/api/") || req.Body == nil {
+		return b.DefaultBinder.Bind(i, c)
+	}
+
+	captured := &cappedBuffer{max: debugBodyCaptureBytes}
+	req.Body = readCloser{io.TeeReader(req.Body, captured), req.Body}
+	err := b.DefaultBinder.Bind(i, c)
+	if err != nil {
+		// Binding stops at the first error; read on so the log shows the rest.
+		io.Copy(io.Discard, io.LimitReader(req.Body, int64(captured.max-captured.Len())))
+		logWarnf("Failed to bind %s %s: %v; body (%d bytes): %s",
+			req.Method, req.URL.Path, err, captured.total, redactBody(captured.Bytes()))
+	}
+	return err
+}
+
+// readCloser reads from one reader and closes another.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// cappedBuffer keeps the first max bytes written to it, counting the rest.
+type cappedBuffer struct {
+	bytes.Buffer
+	max   int
+	total int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.total += len(p)
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// redactBody masks the values of redactedFields in a JSON body and truncates
+// it to debugBodyLogBytes. A body that parses has every such field masked,
+// whatever its type; otherwise only string values can be found.
+func redactBody(body []byte) string {
+	var out string
+	var v any
+	if err := json.Unmarshal(body, &v); err == nil {
+		redacted, _ := json.Marshal(redactValue(v))
+		out = string(redacted)
+	} else {
+		out = redactedStringPattern.ReplaceAllString(string(body), `$1"[redacted]"`)
+	}
+
+	if len(out) > debugBodyLogBytes {
+		out = fmt.Sprintf("%s... (truncated)", out[:debugBodyLogBytes])
+	}
+	return out
+}
+
+// redactValue masks redactedFields throughout a decoded JSON value.
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if isRedactedField(key) {
+				v[key] = "[redacted]"
+			} else {
+				v[key] = redactValue(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+func isRedactedField(name string) bool {
+	for _, field := range redactedFields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+	return false
+}
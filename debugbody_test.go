@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestDebugBinderLogsFailedBinds checks a body that fails to bind is logged
+// with message and file contents redacted, and one that binds is not logged.
+func TestDebugBinderLogsFailedBinds(t *testing.T) {
+	useTempStorage(t)
+	var buf bytes.Buffer
+	prevOut, prevFlags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(prevOut)
+		log.SetFlags(prevFlags)
+	})
+
+	e := echo.New()
+	e.Binder = &debugBinder{}
+	e.POST("/api/storage", handleStorage)
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/storage", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A type error leaves valid JSON, so every field is redacted whatever its type.
+	if code := post(`{"path":"/a.txt","content":"top secret","notify":"+15550000001"}`); code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", code)
+	}
+	// Broken JSON still has its string contents redacted.
+	if code := post(`{"path":"/b.txt","content":"top \"secret\"", "message": "also secret`); code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", code)
+	}
+	logged := buf.String()
+	if strings.Contains(logged, "secret") {
+		t.Errorf("log leaks content:\n%s", logged)
+	}
+	for _, want := range []string{`"path":"/a.txt"`, `"notify":"+15550000001"`, `"path":"/b.txt"`, `"content":"[redacted]"`, `"message": "[redacted]"`} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("log lacks %s:\n%s", want, logged)
+		}
+	}
+
+	buf.Reset()
+	if code := post(`{"path":"/c.txt","content":"fine"}`); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("a successful bind was logged:\n%s", buf.String())
+	}
+}
+
+func TestRedactBodyTruncates(t *testing.T) {
+	got := redactBody([]byte(`{"path":"` + strings.Repeat("x", 3*debugBodyLogBytes) + `"}`))
+	if len(got) > debugBodyLogBytes+len("... (truncated)") || !strings.HasSuffix(got, "... (truncated)") {
+		t.Errorf("redactBody returned %d bytes ending %q, want it truncated", len(got), got[len(got)-20:])
+	}
+}
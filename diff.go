@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxDiffBytes caps the size of the stored file and of the proposed content
+// that POST /api/storage/diff compares.
+const maxDiffBytes = 10 << 20
+
+// diffContextLines is how many unchanged lines surround each change in a hunk,
+// as in `diff -u`.
+const diffContextLines = 3
+
+// maxDiffEdits bounds the work (and memory) of finding a minimal diff. Inputs
+// that differ in more lines than this get a correct but coarser diff that
+// replaces the differing middle as a whole.
+const maxDiffEdits = 2000
+
+// @Summary Preview changes to a file
+// @Description Compare a stored file with proposed content and return a unified diff (as `diff -u` would print), without writing anything, e.g. to preview an edit before saving it with POST /api/storage. A path that doesn't exist, or whose file has expired, is diffed as a new file against /dev/null. The diff counts as a download of the stored file, so a file that has reached its maxDownloads can't be diffed. Binary content is reported as "Binary files ... differ". Both sides are limited to 10 MiB.
+// @Tags storage
+// @Accept json
+// @Produce json
+// @Param request body StorageRequest true "Storage request (path and content are used)"
+// @Success 200 {object} StorageDiffResponse "Diff computed"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path or not a file"
+// @Failure 410 {object} StorageResponse "File has reached its download limit"
+// @Failure 413 {object} StorageResponse "File or content too large to diff"
+// @Failure 500 {object} StorageResponse "Internal server error"
+// @Router /api/storage/diff [post]
+func handleStorageDiff(c echo.Context) error {
+	var req StorageRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if req.Path == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+
+	fullPath, err := validateAndResolvePath(c, req.Path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	if len(req.Content) > maxDiffBytes {
+		return c.JSON(http.StatusRequestEntityTooLarge, StorageResponse{
+			Success: false,
+			Error:   fmt.Sprintf("content is larger than %d bytes", maxDiffBytes),
+		})
+	}
+
+	// An expired file is as good as gone, so it diffs as a new one.
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) || storageExpiry.expired(fullPath) {
+		return c.JSON(http.StatusOK, StorageDiffResponse{
+			Success: true,
+			NewFile: true,
+			Changed: true,
+			Diff:    unifiedDiff(req.Path, nil, []byte(req.Content), true),
+		})
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "only files can be diffed",
+		})
+	}
+	if info.Size() > maxDiffBytes {
+		return c.JSON(http.StatusRequestEntityTooLarge, StorageResponse{
+			Success: false,
+			Error:   fmt.Sprintf("file is larger than %d bytes", maxDiffBytes),
+		})
+	}
+
+	// The diff gives the stored content away, so it counts as a download.
+	done, err := storageDownloads.claim(fullPath)
+	if err != nil {
+		return c.JSON(http.StatusGone, StorageResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	current, err := readStoredFileCached(fullPath, info)
+	done(err == nil)
+	if err != nil {
+		logErrorf("Failed to read file %s: %v", fullPath, err)
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to read file",
+		})
+	}
+
+	proposed := []byte(req.Content)
+	return c.JSON(http.StatusOK, StorageDiffResponse{
+		Success: true,
+		Changed: string(current) != req.Content,
+		Diff:    unifiedDiff(req.Path, current, proposed, false),
+	})
+}
+
+// unifiedDiff renders the changes from old to new as a unified diff with
+// a/ and b/ prefixed names, like `git diff`. It is empty when nothing
+// changed. A new file is diffed against /dev/null.
+func unifiedDiff(path string, old, new []byte, newFile bool) string {
+	name := strings.TrimPrefix(path, "/")
+	oldName, newName := "a/"+name, "b/"+name
+	if newFile {
+		oldName = "/dev/null"
+	}
+
+	if string(old) == string(new) {
+		return ""
+	}
+	if looksBinary(old) || looksBinary(new) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	ops := diffLines(splitLines(string(old)), splitLines(string(new)))
+	for _, h := range diffHunks(ops, diffContextLines) {
+		writeHunk(&b, ops[h.start:h.end])
+	}
+	return b.String()
+}
+
+// splitLines splits s into lines that keep their "\n", so a missing newline
+// at the end of the file shows up as a difference.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOp is one line of an edit script: kept (' '), deleted ('-') or
+// inserted ('+'), with its 1-based line numbers in the old and new text.
+type diffOp struct {
+	kind    byte
+	line    string
+	oldLine int
+	newLine int
+}
+
+// diffLines returns the edit script turning a into b. Common leading and
+// trailing lines are matched directly; the middle is diffed with Myers'
+// algorithm, falling back to replacing it whole past maxDiffEdits.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var kinds []byte
+	for i := 0; i < prefix; i++ {
+		kinds = append(kinds, ' ')
+	}
+	kinds = append(kinds, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for i := 0; i < suffix; i++ {
+		kinds = append(kinds, ' ')
+	}
+
+	ops := make([]diffOp, 0, len(kinds))
+	x, y := 0, 0
+	for _, kind := range kinds {
+		op := diffOp{kind: kind, oldLine: x + 1, newLine: y + 1}
+		switch kind {
+		case ' ':
+			op.line = a[x]
+			x++
+			y++
+		case '-':
+			op.line = a[x]
+			x++
+		case '+':
+			op.line = b[y]
+			y++
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// myersDiff finds a shortest edit script from a to b (E. Myers, "An O(ND)
+// Difference Algorithm and Its Variations"), as a sequence of ' ', '-' and
+// '+'. Deletions come before insertions where both are possible.
+func myersDiff(a, b []string) []byte {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(n, m)
+	}
+
+	// trace[d] holds the furthest x reached on each diagonal k (index
+	// k+d) after d edits, for backtracking.
+	var trace [][]int
+	v := map[int]int{1: 0}
+	for d := 0; d <= n+m && d <= maxDiffEdits; d++ {
+		row := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1] < v[k+1]) {
+				x = v[k+1]
+			} else {
+				x = v[k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k] = x
+			row[k+d] = x
+			if x >= n && y >= m {
+				trace = append(trace, row)
+				return backtrackMyers(trace, n, m)
+			}
+		}
+		trace = append(trace, row)
+	}
+	return replaceAll(n, m)
+}
+
+// backtrackMyers walks the trace of myersDiff back from (n, m) to (0, 0) and
+// returns the edit script in forward order.
+func backtrackMyers(trace [][]int, n, m int) []byte {
+	var script []byte
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			script = append(script, ' ')
+			x--
+			y--
+		}
+		if x == prevX {
+			script = append(script, '+')
+		} else {
+			script = append(script, '-')
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		script = append(script, ' ')
+		x--
+		y--
+	}
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+	return script
+}
+
+// replaceAll is the edit script deleting n lines and inserting m.
+func replaceAll(n, m int) []byte {
+	script := make([]byte, 0, n+m)
+	for i := 0; i < n; i++ {
+		script = append(script, '-')
+	}
+	for i := 0; i < m; i++ {
+		script = append(script, '+')
+	}
+	return script
+}
+
+// diffHunk is a range of ops rendered as one @@ hunk.
+type diffHunk struct {
+	start, end int
+}
+
+// diffHunks groups the changes in ops into hunks with up to context unchanged
+// lines around them, merging changes that are close enough to share context.
+func diffHunks(ops []diffOp, context int) []diffHunk {
+	var hunks []diffHunk
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == ' ' {
+			continue
+		}
+		start := max(i-context, 0)
+		end := i + 1
+		for j := i + 1; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*context {
+				break
+			}
+		}
+		end = min(end+context, len(ops))
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1].end {
+			hunks[len(hunks)-1].end = end
+		} else {
+			hunks = append(hunks, diffHunk{start: start, end: end})
+		}
+		i = end - 1
+	}
+	return hunks
+}
+
+// writeHunk writes one hunk: its @@ header, then each line with its prefix.
+// A line without a trailing newline is followed by the usual marker.
+func writeHunk(b *strings.Builder, ops []diffOp) {
+	oldStart, newStart := ops[0].oldLine, ops[0].newLine
+	oldCount, newCount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	// An empty side is numbered by the line before it, as diff does.
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+	fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+	for _, op := range ops {
+		b.WriteByte(op.kind)
+		b.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats a hunk's start and line count, omitting a count of one.
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
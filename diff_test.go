@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	cases := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", ""},
+		{
+			"replace a line",
+			"host: localhost\nport: 5432\nname: app\n",
+			"host: localhost\nport: 6432\nname: app\n",
+			"--- a/db.yaml\n+++ b/db.yaml\n@@ -1,3 +1,3 @@\n host: localhost\n-port: 5432\n+port: 6432\n name: app\n",
+		},
+		{
+			"separate hunks keep three lines of context",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			"--- a/db.yaml\n+++ b/db.yaml\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			"append",
+			"a\n",
+			"a\nb\n",
+			"--- a/db.yaml\n+++ b/db.yaml\n@@ -1 +1,2 @@\n a\n+b\n",
+		},
+		{
+			"missing final newline",
+			"a\nb",
+			"a\nb\n",
+			"--- a/db.yaml\n+++ b/db.yaml\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			"empty the file",
+			"a\nb\n",
+			"",
+			"--- a/db.yaml\n+++ b/db.yaml\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{"binary", "a\x00b", "a\x00c", "Binary files a/db.yaml and b/db.yaml differ\n"},
+	}
+	for _, tc := range cases {
+		if got := unifiedDiff("/db.yaml", []byte(tc.old), []byte(tc.new), false); got != tc.want {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", tc.name, got, tc.want)
+		}
+	}
+
+	want := "--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+hello\n+world\n"
+	if got := unifiedDiff("/new.txt", nil, []byte("hello\nworld\n"), true); got != want {
+		t.Errorf("new file:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestDiffLinesMinimal checks the edit script is minimal, and that inputs
+// too different for a minimal diff still get a correct one.
+func TestDiffLinesMinimal(t *testing.T) {
+	edits := func(ops []diffOp) int {
+		n := 0
+		for _, op := range ops {
+			if op.kind != ' ' {
+				n++
+			}
+		}
+		return n
+	}
+
+	// "abcabba" -> "cbabac" needs 5 edits (the example from Myers' paper).
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+	if n := edits(diffLines(a, b)); n != 5 {
+		t.Errorf("edits = %d, want 5", n)
+	}
+
+	var old, new []string
+	for i := 0; i < maxDiffEdits; i++ {
+		old = append(old, "old\n", "same\n")
+		new = append(new, "new\n", "same\n")
+	}
+	ops := diffLines(old, new)
+	var gotOld, gotNew []string
+	for _, op := range ops {
+		if op.kind != '+' {
+			gotOld = append(gotOld, op.line)
+		}
+		if op.kind != '-' {
+			gotNew = append(gotNew, op.line)
+		}
+	}
+	if strings.Join(gotOld, "") != strings.Join(old, "") || strings.Join(gotNew, "") != strings.Join(new, "") {
+		t.Error("fallback edit script doesn't turn old into new")
+	}
+}
+
+func TestHandleStorageDiff(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.WriteFile(filepath.Join(dir, "db.yaml"), []byte("port: 5432\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := func(body string) (int, StorageDiffResponse) {
+		t.Helper()
+		rec := doStorageJSON(t, handleStorageDiff, http.MethodPost, "/api/storage/diff", body)
+		var resp StorageDiffResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, resp
+	}
+
+	code, resp := diff(`{"path":"/db.yaml","content":"port: 6432\n"}`)
+	if code != http.StatusOK || !resp.Changed || resp.NewFile || !strings.Contains(resp.Diff, "-port: 5432\n+port: 6432\n") {
+		t.Errorf("changed file: %d %+v", code, resp)
+	}
+
+	code, resp = diff(`{"path":"/db.yaml","content":"port: 5432\n"}`)
+	if code != http.StatusOK || resp.Changed || resp.Diff != "" {
+		t.Errorf("unchanged file: %d %+v", code, resp)
+	}
+
+	code, resp = diff(`{"path":"/new/notes.txt","content":"hi\n"}`)
+	if code != http.StatusOK || !resp.NewFile || !strings.HasPrefix(resp.Diff, "--- /dev/null\n+++ b/new/notes.txt\n") {
+		t.Errorf("new file: %d %+v", code, resp)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new")); !os.IsNotExist(err) {
+		t.Error("diff created the new file's directory")
+	}
+
+	for _, body := range []string{`{"path":"/sub","content":"x"}`, `{"content":"x"}`, `{"path":"/../x","content":"x"}`} {
+		if code, _ := diff(body); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, code)
+		}
+	}
+}
+
+// TestHandleStorageDiffLimits checks a diff can't read around a file's
+// expiry or download limit.
+func TestHandleStorageDiffLimits(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "expired.txt", "once.txt")
+	t.Cleanup(func() {
+		storageExpiry.load("")
+		storageDownloads.load(false, "")
+	})
+	storageExpiry.set(filepath.Join(dir, "expired.txt"), time.Now().Add(-time.Second))
+	storageDownloads.limit(filepath.Join(dir, "once.txt"), 1)
+
+	rec := doStorageJSON(t, handleStorageDiff, http.MethodPost, "/api/storage/diff", `{"path":"/expired.txt","content":"x"}`)
+	var resp StorageDiffResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || !resp.NewFile {
+		t.Errorf("expired file: %d %s; want it diffed as a new file", rec.Code, rec.Body)
+	}
+
+	if rec := doStorageJSON(t, handleStorageDiff, http.MethodPost, "/api/storage/diff", `{"path":"/once.txt","content":"x"}`); rec.Code != http.StatusOK {
+		t.Errorf("first diff of a limited file: status %d, want 200", rec.Code)
+	}
+	if rec := doStorageJSON(t, handleStorageDiff, http.MethodPost, "/api/storage/diff", `{"path":"/once.txt","content":"x"}`); rec.Code != http.StatusGone {
+		t.Errorf("diff past the download limit: status %d, want 410", rec.Code)
+	}
+}
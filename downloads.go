@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fileDownloads is how often a file has been read, and when last.
+type fileDownloads struct {
+	Count      int64     `json:"count"`
+	LastAccess time.Time `json:"lastAccess"`
+	// Max, when positive, is how many times the file may be read; see
+	// storage.download_limit_action for what happens after that.
+	Max int64 `json:"max,omitempty"`
+}
+
+// Actions selectable with storage.download_limit_action.
+const (
+	downloadLimitGone   = "gone"
+	downloadLimitDelete = "delete"
+)
+
+// downloadsSaveDelay is how long plain download counts may sit in memory
+// before they are written to storage.downloads_file, so a burst of reads is
+// saved once instead of once per read.
+const downloadsSaveDelay = 5 * time.Second
+
+// errDownloadLimitReached is returned for a file that has been read as often
+// as its maxDownloads allows.
+var errDownloadLimitReached = errors.New("file has reached its download limit")
+
+// downloadStore counts successful reads of each file when
+// storage.track_downloads is set, and of files saved with maxDownloads in any
+// case. It is kept in memory and, when storage.downloads_file is set, mirrored
+// to that file so counts and limits survive restarts.
+type downloadStore struct {
+	mu      sync.Mutex
+	enabled bool
+	path    string
+	entries map[string]fileDownloads // keyed by full path
+	// pending is the timer of a delayed save, set while counts are unsaved.
+	pending *time.Timer
+}
+
+var storageDownloads = &downloadStore{entries: map[string]fileDownloads{}}
+
+// initStorageDownloads turns download tracking on or off from the
+// configuration, loading the counts persisted in storage.downloads_file.
+func initStorageDownloads() error {
+	return storageDownloads.load(appConfig.Storage.TrackDownloads, appConfig.Storage.DownloadsFile)
+}
+
+// load resets the store, enabling it if asked, with the counts in path, and
+// persists future changes there. An empty path keeps the store in memory only.
+func (s *downloadStore) load(enabled bool, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending != nil {
+		s.save()
+	}
+	s.enabled, s.path, s.entries = enabled, path, map[string]fileDownloads{}
+	if !enabled || path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.entries)
+}
+
+// claim is called before serving the file at fullPath. It returns
+// errDownloadLimitReached for a file that has been read as often as its limit
+// allows, and otherwise a function to call with whether the file was then
+// served, which counts the read. A limited file's read is counted up front, so
+// concurrent requests can't both take its last download, and given back if it
+// wasn't served after all.
+func (s *downloadStore) claim(fullPath string) (done func(served bool), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := s.entries[fullPath]
+	if entry.Max <= 0 {
+		return func(served bool) {
+			if served {
+				s.record(fullPath)
+			}
+		}, nil
+	}
+	if entry.Count >= entry.Max {
+		return nil, errDownloadLimitReached
+	}
+	entry.Count++
+	entry.LastAccess = time.Now().UTC()
+	s.entries[fullPath] = entry
+	s.save()
+
+	return func(served bool) {
+		if !served {
+			s.mu.Lock()
+			if entry, ok := s.entries[fullPath]; ok && entry.Count > 0 {
+				entry.Count--
+				s.entries[fullPath] = entry
+				s.save()
+			}
+			s.mu.Unlock()
+			return
+		}
+		if entry.Count >= entry.Max && appConfig != nil && appConfig.Storage.DownloadLimitAction == downloadLimitDelete {
+			if err := removeDownloadedFile(fullPath); err != nil {
+				logErrorf("Failed to delete %s after its last download: %v", fullPath, err)
+			}
+		}
+	}, nil
+}
+
+// record counts a read of the file at fullPath, if tracking is on. Unlike
+// limits, plain counts are saved after downloadsSaveDelay, so a crash loses
+// at most the last few seconds of them.
+func (s *downloadStore) record(fullPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.enabled {
+		return
+	}
+	entry := s.entries[fullPath]
+	entry.Count++
+	entry.LastAccess = time.Now().UTC()
+	s.entries[fullPath] = entry
+	if s.path != "" && s.pending == nil {
+		s.pending = time.AfterFunc(downloadsSaveDelay, s.flush)
+	}
+}
+
+// limit lets the file at fullPath, just saved, be read max more times,
+// starting its count over; a max of zero lifts any limit but keeps the count.
+func (s *downloadStore) limit(fullPath string, max int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[fullPath]
+	if max <= 0 {
+		if ok && entry.Max > 0 {
+			entry.Max = 0
+			s.entries[fullPath] = entry
+			s.save()
+		}
+		return
+	}
+	s.entries[fullPath] = fileDownloads{Max: max}
+	s.save()
+}
+
+// get returns the reads counted for the file at fullPath, and whether they
+// are counted at all: with tracking on, or for a file with a limit.
+func (s *downloadStore) get(fullPath string) (fileDownloads, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.entries[fullPath]
+	return entry, s.enabled || entry.Max > 0
+}
+
+// forget drops the count of a file that was deleted.
+func (s *downloadStore) forget(fullPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[fullPath]; ok {
+		delete(s.entries, fullPath)
+		s.save()
+	}
+}
+
+// move carries the counts of source, or of everything under it when it is a
+// directory, over to destination.
+func (s *downloadStore) move(source, destination string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for path, entry := range s.entries {
+		rest, ok := strings.CutPrefix(path, source)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, string(filepath.Separator))) {
+			continue
+		}
+		delete(s.entries, path)
+		s.entries[destination+rest] = entry
+		changed = true
+	}
+	if changed {
+		s.save()
+	}
+}
+
+// flush writes counts still waiting for a delayed save, e.g. at shutdown.
+func (s *downloadStore) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending != nil {
+		s.save()
+	}
+}
+
+// save writes the counts to the downloads file, including any waiting for a
+// delayed save. The caller must hold s.mu. Failures are only logged, so they
+// never fail the read being counted.
+func (s *downloadStore) save() {
+	if s.pending != nil {
+		s.pending.Stop()
+		s.pending = nil
+	}
+	if s.path == "" {
+		return
+	}
+	if err := writeJSONFileAtomic(s.path, s.entries); err != nil {
+		logErrorf("Failed to write download counts to %s: %v", s.path, err)
+	}
+}
+
+// writeJSONFileAtomic writes v as indented JSON to path, replacing it
+// atomically so a crash never leaves a half-written file.
+func writeJSONFileAtomic(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// recordDownload serves fullPath with handler, counting the read if it was
+// served successfully, i.e. with 200 OK. A file that has reached its download
+// limit gets 410 Gone instead.
+func recordDownload(c echo.Context, fullPath string, handler func() error) error {
+	done, err := storageDownloads.claim(fullPath)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusGone, err.Error())
+	}
+	err = handler()
+	done(err == nil && c.Response().Status == http.StatusOK)
+	return err
+}
+
+// removeDownloadedFile deletes a file that has been read as often as its
+// limit allows, when storage.download_limit_action is "delete".
+func removeDownloadedFile(path string) error {
+	unlock := storageLocks.lock(path)
+	defer unlock()
+
+	// A save since the last download may have set a new limit.
+	if entry, _ := storageDownloads.get(path); entry.Max <= 0 || entry.Count < entry.Max {
+		return nil
+	}
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+	defer invalidateCachedFile(path)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if storageUsage != nil {
+		storageUsage.reserve(-info.Size())
+	}
+	forgetStoredFile(path)
+	logInfof("Deleted %s after its last allowed download", path)
+	return nil
+}
+
+// @Summary Get file metadata
+// @Description Describe a file without reading it: its size and modification time, when it expires if it was saved with a ttl, and, with storage.track_downloads or for a file saved with maxDownloads, how often it has been read.
+// @Tags storage
+// @Accept json
+// @Produce json
+// @Param request body StorageRequest true "Storage request (only path is used)"
+// @Success 200 {object} StorageStatResponse "File metadata"
+// @Failure 400 {object} StorageStatResponse "Bad request - invalid path or not a file"
+// @Failure 404 {object} StorageStatResponse "File not found"
+// @Router /api/storage/stat [post]
+func handleStorageStat(c echo.Context) error {
+	var req StorageRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageStatResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if req.Path == "" {
+		return c.JSON(http.StatusBadRequest, StorageStatResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+
+	fullPath, err := validateAndResolvePath(c, req.Path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) || storageExpiry.expired(fullPath) {
+		return c.JSON(http.StatusNotFound, StorageStatResponse{
+			Success: false,
+			Error:   "file not found",
+		})
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		return c.JSON(http.StatusBadRequest, StorageStatResponse{
+			Success: false,
+			Error:   "not a file",
+		})
+	}
+
+	response := StorageStatResponse{
+		Success: true,
+		Path:    req.Path,
+		Size:    storedContentSize(info),
+		ModTime: formatModTime(info),
+	}
+	if at, ok := storageExpiry.expiresAt(fullPath); ok {
+		response.ExpiresAt = at.Format(time.RFC3339)
+	}
+	if downloads, tracked := storageDownloads.get(fullPath); tracked {
+		response.Downloads = &downloads.Count
+		if !downloads.LastAccess.IsZero() {
+			response.LastAccess = downloads.LastAccess.Format(time.RFC3339)
+		}
+		if downloads.Max > 0 {
+			response.MaxDownloads = &downloads.Max
+		}
+	}
+	return c.JSON(http.StatusOK, response)
+}
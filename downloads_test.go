@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestStorageDownloads(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "shares/a.txt")
+	downloadsFile := filepath.Join(t.TempDir(), "downloads.json")
+	if err := storageDownloads.load(true, downloadsFile); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storageDownloads.load(false, "") })
+
+	stat := func(path string) (int, StorageStatResponse) {
+		t.Helper()
+		rec := doStorageJSON(t, handleStorageStat, http.MethodPost, "/api/storage/stat", `{"path":"`+path+`"}`)
+		var resp StorageStatResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, resp
+	}
+
+	if code, resp := stat("/shares/a.txt"); code != http.StatusOK || resp.Downloads == nil || *resp.Downloads != 0 || resp.LastAccess != "" {
+		t.Fatalf("before any read: got %d %+v, want 0 downloads", code, resp)
+	}
+
+	e := echo.New()
+	e.HTTPErrorHandler = jsonErrorHandler
+	e.GET("/api/storage", handleStorage)
+	e.GET("/api/storage/*", handleStorageWithPath)
+	for _, target := range []string{"/api/storage/shares/a.txt", "/api/storage/shares/missing.txt"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/shares/a.txt"}`)
+	doStorageJSON(t, handleStorageBatchRead, http.MethodPost, "/api/storage/batch-read", `{"paths":["/shares/a.txt"]}`)
+
+	code, resp := stat("/shares/a.txt")
+	if code != http.StatusOK || resp.Downloads == nil || *resp.Downloads != 3 || resp.LastAccess == "" || resp.Size == 0 {
+		t.Fatalf("after three reads: got %d %+v, want 3 downloads", code, resp)
+	}
+
+	// The counts survive a restart.
+	if err := storageDownloads.load(true, downloadsFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, resp := stat("/shares/a.txt"); resp.Downloads == nil || *resp.Downloads != 3 {
+		t.Errorf("reloaded downloads = %v, want 3", resp.Downloads)
+	}
+
+	if code, _ := stat("/shares/missing.txt"); code != http.StatusNotFound {
+		t.Errorf("missing file: got %d, want 404", code)
+	}
+	if code, _ := stat("/shares"); code != http.StatusBadRequest {
+		t.Errorf("directory: got %d, want 400", code)
+	}
+
+	// Without tracking, stat leaves downloads out.
+	storageDownloads.load(false, "")
+	if _, resp := stat("/shares/a.txt"); resp.Downloads != nil {
+		t.Errorf("tracking off: downloads = %d, want omitted", *resp.Downloads)
+	}
+}
+
+func TestStorageMaxDownloads(t *testing.T) {
+	dir := useTempStorage(t)
+	storageDownloads.load(false, "")
+	t.Cleanup(func() { storageDownloads.load(false, "") })
+
+	e := echo.New()
+	e.HTTPErrorHandler = jsonErrorHandler
+	e.GET("/api/storage/*", handleStorageWithPath)
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/storage"+path, nil))
+		return rec.Code
+	}
+
+	doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/secret.txt","content":"s3cret","maxDownloads":2}`)
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusGone} {
+		if got := get("/secret.txt"); got != want {
+			t.Errorf("read %d: got %d, want %d", i+1, got, want)
+		}
+	}
+	rec := doStorageJSON(t, handleStorageBatchRead, http.MethodPost, "/api/storage/batch-read", `{"paths":["/secret.txt"]}`)
+	var batch StorageBatchReadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &batch); err != nil || batch.Files["/secret.txt"].Error != errDownloadLimitReached.Error() {
+		t.Errorf("batch read past the limit: got %s", rec.Body)
+	}
+
+	// A failed read doesn't use up a download.
+	doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/secret.txt","content":"again","maxDownloads":1}`)
+	path := filepath.Join(dir, "secret.txt")
+	if err := os.Rename(path, path+".bak"); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("/secret.txt"); got != http.StatusNotFound {
+		t.Fatalf("read of a missing file: got %d, want 404", got)
+	}
+	if err := os.Rename(path+".bak", path); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("/secret.txt"); got != http.StatusOK {
+		t.Errorf("read after a failed one: got %d, want 200", got)
+	}
+
+	// Saving without maxDownloads lifts the limit.
+	doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/secret.txt","content":"open"}`)
+	if got := get("/secret.txt"); got != http.StatusOK {
+		t.Errorf("read after lifting the limit: got %d, want 200", got)
+	}
+
+	appConfig.Storage.DownloadLimitAction = downloadLimitDelete
+	t.Cleanup(func() { appConfig.Storage.DownloadLimitAction = "" })
+	doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/once.txt","content":"x","maxDownloads":1}`)
+	if got := get("/once.txt"); got != http.StatusOK {
+		t.Errorf("one-time read: got %d, want 200", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "once.txt")); !os.IsNotExist(err) {
+		t.Errorf("file still there after its last download: %v", err)
+	}
+	if got := get("/once.txt"); got != http.StatusNotFound {
+		t.Errorf("read after deletion: got %d, want 404", got)
+	}
+
+	if rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/x.txt","content":"x","maxDownloads":0}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("maxDownloads 0: got %d, want 400", rec.Code)
+	}
+}
+
+// TestStorageDownloadsDelayedSave checks plain counts are written to the
+// downloads file once, after a delay or a flush, rather than on every read.
+func TestStorageDownloadsDelayedSave(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "a.txt")
+	downloadsFile := filepath.Join(t.TempDir(), "downloads.json")
+	if err := storageDownloads.load(true, downloadsFile); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storageDownloads.load(false, "") })
+
+	for range 3 {
+		doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/a.txt"}`)
+	}
+	if _, err := os.Stat(downloadsFile); !os.IsNotExist(err) {
+		t.Fatalf("downloads file written before the delay: %v", err)
+	}
+
+	storageDownloads.flush()
+	data, err := os.ReadFile(downloadsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]fileDownloads
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if got := saved[filepath.Join(dir, "a.txt")].Count; got != 3 {
+		t.Errorf("saved count = %d, want 3", got)
+	}
+	if storageDownloads.pending != nil {
+		t.Error("a save is still pending after the flush")
+	}
+}
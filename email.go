@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for the email section.
+const (
+	defaultEmailPort           = 587
+	defaultEmailSubject        = "Notification from mowa"
+	defaultEmailTimeoutSeconds = 30
+)
+
+// isEmailRecipient reports whether a recipient is an email address rather
+// than a phone number or group chat.
+func isEmailRecipient(recipient string) bool {
+	if _, ok := chatName(recipient); ok {
+		return false
+	}
+	return strings.Contains(recipient, "@")
+}
+
+// validateEmailRecipient checks that recipient is a bare email address and
+// that email is configured to send it.
+func validateEmailRecipient(recipient string) error {
+	if appConfig == nil || !appConfig.Email.isEnabled() {
+		return fmt.Errorf("email recipients need the email section (email.host) to be configured")
+	}
+	addr, err := mail.ParseAddress(recipient)
+	if err != nil || addr.Address != recipient {
+		return fmt.Errorf("invalid email address")
+	}
+	return nil
+}
+
+// emailNotifier sends notifications as plain-text emails through the SMTP
+// server in the email section, one email per recipient.
+type emailNotifier struct{}
+
+func (emailNotifier) Notify(recipients []string, message string) []MessageResult {
+	results := make([]MessageResult, 0, len(recipients))
+	for _, recipient := range recipients {
+		result := MessageResult{Recipient: recipient}
+		err := validateEmailRecipient(recipient)
+		if err == nil {
+			err = sendEmail(recipient, message)
+		}
+		if err != nil {
+			errorMsg := err.Error()
+			result.Error = &errorMsg
+		} else {
+			result.Success = true
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// sendEmail delivers message to one address. A variable so tests can stub out
+// the SMTP server.
+var sendEmail = func(to, message string) error {
+	cfg := appConfig.Email
+	return sendSMTPMail(cfg, to, buildEmail(cfg, to, message, time.Now()))
+}
+
+// buildEmail renders message as a plain-text email to one address. The body
+// is quoted-printable so any text, emoji included, survives 7-bit relays.
+func buildEmail(cfg EmailConfig, to, message string, date time.Time) []byte {
+	subject := cfg.Subject
+	if subject == "" {
+		subject = defaultEmailSubject
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	body := quotedprintable.NewWriter(&msg)
+	body.Write([]byte(strings.ReplaceAll(message, "\n", "\r\n")))
+	body.Close()
+	return msg.Bytes()
+}
+
+// sendSMTPMail sends msg to one address like smtp.SendMail, but bounded by
+// email.timeout_seconds. Port 465 speaks TLS from the start; on other ports
+// STARTTLS is used whenever the server offers it.
+func sendSMTPMail(cfg EmailConfig, to string, msg []byte) error {
+	port := cfg.Port
+	if port <= 0 {
+		port = defaultEmailPort
+	}
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultEmailTimeoutSeconds * time.Second
+	}
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	if port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+		}
+	}
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(cfg.From); err != nil {
+		return fmt.Errorf("SMTP server rejected the sender: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP server rejected the recipient: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected the email: %w", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSendEmail replaces sendEmail, recording the address of every email sent
+// and failing the sends respond returns an error for.
+func fakeSendEmail(t *testing.T, respond func(to string) error) *[]string {
+	t.Helper()
+	var sent []string
+	prev := sendEmail
+	sendEmail = func(to, message string) error {
+		sent = append(sent, to)
+		return respond(to)
+	}
+	t.Cleanup(func() { sendEmail = prev })
+	return &sent
+}
+
+func TestSendMessagesRoutesEmail(t *testing.T) {
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+	appConfig = defaultConfig()
+
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+	emails := fakeSendEmail(t, func(to string) error {
+		if to == "bounce@example.com" {
+			return errors.New("SMTP server rejected the recipient")
+		}
+		return nil
+	})
+
+	// Without an email section, addresses are rejected up front.
+	results := sendMessages([]string{"ops@example.com"}, "hi")
+	if results[0].Success || len(*emails) != 0 {
+		t.Fatalf("email not configured: got %+v, sent %v", results, *emails)
+	}
+
+	appConfig.Email = EmailConfig{Host: "smtp.example.com", From: "mowa@example.com"}
+	results = sendMessages([]string{"+15550000001", "ops@example.com", "bounce@example.com", "not an@address"}, "hi")
+	want := []bool{true, true, false, false}
+	for i, result := range results {
+		if result.Success != want[i] {
+			t.Errorf("%s: success = %v, want %v (%+v)", result.Recipient, result.Success, want[i], result)
+		}
+	}
+	if got := strings.Join(*emails, ","); got != "ops@example.com,bounce@example.com" {
+		t.Errorf("emailed %s, want ops@ and bounce@", got)
+	}
+	if len(*scripts) != 1 {
+		t.Errorf("ran %d AppleScripts, want 1 for the phone number", len(*scripts))
+	}
+}
+
+func TestBuildEmail(t *testing.T) {
+	cfg := EmailConfig{From: "mowa@example.com", Subject: "Störung"}
+	msg := string(buildEmail(cfg, "ops@example.com", "report.txt saved ✅\nbye", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)))
+	for _, want := range []string{
+		"From: mowa@example.com\r\n",
+		"To: ops@example.com\r\n",
+		"Subject: =?utf-8?q?St=C3=B6rung?=\r\n",
+		"Date: Wed, 01 May 2024 12:00:00 +0000\r\n",
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\nreport.txt saved =E2=9C=85\r\nbye",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("email lacks %q:\n%s", want, msg)
+		}
+	}
+}
+
+// TestSendSMTPMail talks to a minimal SMTP server that offers neither
+// STARTTLS nor AUTH.
+func TestSendSMTPMail(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var lines []string
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 fake ESMTP")
+		for inData := false; ; {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			switch {
+			case inData && line == ".":
+				inData = false
+				reply("250 queued")
+			case inData:
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250 fake")
+			case line == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case line == "QUIT":
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	cfg := EmailConfig{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port, From: "mowa@example.com", TimeoutSeconds: 5}
+	if err := sendSMTPMail(cfg, "ops@example.com", buildEmail(cfg, "ops@example.com", "hello", time.Now())); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Join(<-received, "\n")
+	for _, want := range []string{"MAIL FROM:<mowa@example.com>", "RCPT TO:<ops@example.com>", "\nhello\n"} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("session lacks %q:\n%s", want, lines)
+		}
+	}
+}
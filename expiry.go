@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultExpirySweepSeconds is how often expired files are deleted when
+// storage.expiry_sweep_seconds is not set.
+const defaultExpirySweepSeconds = 60
+
+// expiryStore records when files saved with a ttl expire. It is kept in memory
+// and, when storage.expiry_file is set, mirrored to that file so expiries
+// survive restarts.
+type expiryStore struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]time.Time // keyed by full path
+}
+
+var storageExpiry = &expiryStore{entries: map[string]time.Time{}}
+
+// initStorageExpiry loads the expiries persisted in storage.expiry_file, if
+// configured. A missing file means no file expires.
+func initStorageExpiry() error {
+	return storageExpiry.load(appConfig.Storage.ExpiryFile)
+}
+
+// load replaces the store's entries with those in path and persists future
+// changes there. An empty path keeps the store in memory only.
+func (s *expiryStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path, s.entries = path, map[string]time.Time{}
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.entries)
+}
+
+// set makes the file at fullPath expire at the given time.
+func (s *expiryStore) set(fullPath string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[fullPath] = at.UTC()
+	s.save()
+}
+
+// clear makes the file at fullPath permanent again.
+func (s *expiryStore) clear(fullPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[fullPath]; ok {
+		delete(s.entries, fullPath)
+		s.save()
+	}
+}
+
+// move carries the expiries of source, or of everything under it when it is
+// a directory, over to destination.
+func (s *expiryStore) move(source, destination string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for path, at := range s.entries {
+		rest, ok := strings.CutPrefix(path, source)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, string(filepath.Separator))) {
+			continue
+		}
+		delete(s.entries, path)
+		s.entries[destination+rest] = at
+		changed = true
+	}
+	if changed {
+		s.save()
+	}
+}
+
+// expired reports whether the file at fullPath was saved with a ttl that has
+// run out, so it is treated as gone even before the sweeper deletes it.
+func (s *expiryStore) expired(fullPath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.entries[fullPath]
+	return ok && !time.Now().Before(at)
+}
+
+// expiresAt returns when the file at fullPath expires, if it was saved with a
+// ttl.
+func (s *expiryStore) expiresAt(fullPath string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, ok := s.entries[fullPath]
+	return at, ok
+}
+
+// due returns the paths of every expired file.
+func (s *expiryStore) due() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var paths []string
+	for path, at := range s.entries {
+		if !now.Before(at) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// save writes the entries to the expiry file. The caller must hold s.mu.
+// Failures are logged: the entries are still held in memory, so a write error
+// must not fail the save that set them.
+func (s *expiryStore) save() {
+	if s.path == "" {
+		return
+	}
+	if err := writeJSONFileAtomic(s.path, s.entries); err != nil {
+		logErrorf("Failed to write file expiries to %s: %v", s.path, err)
+	}
+}
+
+// startExpirySweeper deletes expired files right away, to catch up on those
+// that expired while the server was down, and then every
+// storage.expiry_sweep_seconds.
+func startExpirySweeper() {
+	interval := appConfig.Storage.ExpirySweepSeconds
+	if interval <= 0 {
+		interval = defaultExpirySweepSeconds
+	}
+
+	sweepExpiredFiles()
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		sweepExpiredFiles()
+	}
+}
+
+// sweepExpiredFiles deletes every expired file, crediting the freed space to
+// the quota. A file that is already gone just has its expiry dropped.
+func sweepExpiredFiles() {
+	for _, path := range storageExpiry.due() {
+		if err := removeExpiredFile(path); err != nil {
+			logErrorf("Failed to delete expired file %s: %v", path, err)
+			continue
+		}
+		logInfof("Deleted expired file %s", path)
+	}
+}
+
+// removeExpiredFile deletes the file at path if it is still expired once its
+// lock is held, since a save may have given it a new ttl meanwhile.
+func removeExpiredFile(path string) error {
+	unlock := storageLocks.lock(path)
+	defer unlock()
+
+	if !storageExpiry.expired(path) {
+		return nil
+	}
+	info, err := os.Lstat(path)
+	if err == nil && info.Mode().IsRegular() {
+		defer invalidateCachedFile(path)
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if storageUsage != nil {
+			storageUsage.reserve(-info.Size())
+		}
+		storageDownloads.forget(path)
+	}
+	storageExpiry.clear(path)
+	return nil
+}
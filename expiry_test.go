@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorageTTL(t *testing.T) {
+	dir := useTempStorage(t)
+	expiryFile := filepath.Join(t.TempDir(), "expiries.json")
+	if err := storageExpiry.load(expiryFile); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storageExpiry.load("") })
+
+	rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/shares/a.txt","content":"temp","ttl":"1h"}`)
+	var resp StorageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	expiresAt, err := time.Parse(time.RFC3339, resp.ExpiresAt)
+	if rec.Code != http.StatusOK || err != nil || time.Until(expiresAt) < 59*time.Minute {
+		t.Fatalf("save with ttl: got %d %+v, want 200 with expiresAt in an hour", rec.Code, resp)
+	}
+	if rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/shares/a.txt"}`); rec.Code != http.StatusOK {
+		t.Errorf("read before expiry: got %d, want 200", rec.Code)
+	}
+
+	// The expiry survives a restart.
+	if err := storageExpiry.load(expiryFile); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "shares", "a.txt")
+	if at, ok := storageExpiry.entries[path]; !ok || at.Sub(expiresAt).Abs() > time.Second {
+		t.Errorf("reloaded expiry = %v, %v; want %v", at, ok, expiresAt)
+	}
+
+	storageExpiry.set(path, time.Now().Add(-time.Second))
+	if rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/shares/a.txt"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("read after expiry: got %d, want 404", rec.Code)
+	}
+	rec = doStorageJSON(t, handleStorageExists, http.MethodPost, "/api/storage/exists", `{"path":"/shares/a.txt"}`)
+	var exists StorageExistsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &exists); err != nil || exists.Exists {
+		t.Errorf("exists after expiry: got %s, want false", rec.Body)
+	}
+
+	sweepExpiredFiles()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expired file still there after the sweep: %v", err)
+	}
+	if len(storageExpiry.due()) != 0 {
+		t.Errorf("expiry kept after the file was deleted")
+	}
+
+	// Saving again without a ttl makes the file permanent.
+	doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/shares/b.txt","content":"x","ttl":"1ms"}`)
+	time.Sleep(5 * time.Millisecond)
+	doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/shares/b.txt","content":"y"}`)
+	sweepExpiredFiles()
+	if _, err := os.Stat(filepath.Join(dir, "shares", "b.txt")); err != nil {
+		t.Errorf("file saved without a ttl was deleted: %v", err)
+	}
+
+	for _, ttl := range []string{"soon", "-1h", "0s"} {
+		rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/shares/c.txt","content":"x","ttl":"`+ttl+`"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("ttl %q: got %d, want 400", ttl, rec.Code)
+		}
+	}
+}
+
+func TestExpiryStoreMove(t *testing.T) {
+	s := &expiryStore{entries: map[string]time.Time{}}
+	at := time.Now().Add(time.Hour)
+	s.set("/data/shares/a.txt", at)
+	s.set("/data/shares/sub/b.txt", at)
+	s.set("/data/sharesmore/c.txt", at)
+
+	s.move("/data/shares", "/data/archive")
+	for _, path := range []string{"/data/archive/a.txt", "/data/archive/sub/b.txt", "/data/sharesmore/c.txt"} {
+		if _, ok := s.entries[path]; !ok {
+			t.Errorf("no expiry for %s after the move: %v", path, s.entries)
+		}
+	}
+	if len(s.entries) != 3 {
+		t.Errorf("entries = %v, want 3", s.entries)
+	}
+}
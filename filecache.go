@@ -0,0 +1,125 @@
+package main
+
+import (
+	"container/list"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxCachedFileSize is the largest file the read cache keeps; the cache is
+// meant for small, hot files such as configs, not for holding big downloads.
+const maxCachedFileSize = 1 << 20
+
+// fileCacheEntry is the plaintext content of a file, along with the size and
+// modification time it had when read, to detect changes made behind mowa's back.
+type fileCacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+	content []byte
+}
+
+// fileCache is an LRU cache of file contents keyed by path, holding at most max
+// entries. Entries are dropped when mowa writes the file, and ignored when the
+// file's size or modification time no longer match.
+type fileCache struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+}
+
+// storageFileCache caches reads of stored files when storage.cache_entries is
+// set; nil disables caching.
+var storageFileCache *fileCache
+
+// initStorageFileCache sets up the read cache from the configuration.
+func initStorageFileCache() {
+	storageFileCache = nil
+	if n := appConfig.Storage.CacheEntries; n > 0 {
+		storageFileCache = newFileCache(n)
+	}
+}
+
+func newFileCache(max int) *fileCache {
+	return &fileCache{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns the cached content of path if it was read when the file had the
+// size and modification time in info.
+func (c *fileCache) get(path string, info os.FileInfo) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[path]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*fileCacheEntry)
+	if entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		c.order.Remove(elem)
+		delete(c.entries, path)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.content, true
+}
+
+// put caches content read from path while it matched info, evicting the least
+// recently used entry when full. Files over maxCachedFileSize are not cached.
+func (c *fileCache) put(path string, info os.FileInfo, content []byte) {
+	if info.Size() > maxCachedFileSize {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &fileCacheEntry{path: path, size: info.Size(), modTime: info.ModTime(), content: content}
+	if elem, ok := c.entries[path]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[path] = c.order.PushFront(entry)
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*fileCacheEntry).path)
+	}
+}
+
+// invalidate drops path from the cache.
+func (c *fileCache) invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[path]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, path)
+	}
+}
+
+// readStoredFileCached is readStoredFile served from the read cache when
+// enabled. info is the file's current stat, used to detect external changes.
+// The returned content is shared and must not be modified.
+func readStoredFileCached(path string, info os.FileInfo) ([]byte, error) {
+	if storageFileCache == nil {
+		return readStoredFile(path)
+	}
+	if content, ok := storageFileCache.get(path, info); ok {
+		return content, nil
+	}
+	content, err := readStoredFile(path)
+	if err != nil {
+		return nil, err
+	}
+	storageFileCache.put(path, info, content)
+	return content, nil
+}
+
+// invalidateCachedFile drops path from the read cache after mowa changed it.
+func invalidateCachedFile(path string) {
+	if storageFileCache != nil {
+		storageFileCache.invalidate(path)
+	}
+}
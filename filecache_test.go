@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	stat := func(name string) os.FileInfo {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	a, b, c := stat("a"), stat("b"), stat("c")
+
+	cache := newFileCache(2)
+	cache.put("a", a, []byte("a"))
+	cache.put("b", b, []byte("b"))
+	cache.get("a", a)
+	cache.put("c", c, []byte("c"))
+
+	if _, ok := cache.get("b", b); ok {
+		t.Error("b should have been evicted as least recently used")
+	}
+	if _, ok := cache.get("a", a); !ok {
+		t.Error("a should still be cached")
+	}
+	if _, ok := cache.get("c", c); !ok {
+		t.Error("c should be cached")
+	}
+}
+
+// TestFileCacheDetectsChanges checks cached content is not served after a
+// write through mowa, nor after the file is changed by another program.
+func TestFileCacheDetectsChanges(t *testing.T) {
+	dir := useTempStorage(t)
+	appConfig.Storage.CacheEntries = 10
+	initStorageFileCache()
+	t.Cleanup(func() { storageFileCache = nil })
+
+	path := filepath.Join(dir, "config.yaml")
+	read := func() string {
+		t.Helper()
+		rec := doStorageRaw(t, "/api/storage/config.yaml")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		return rec.Body.String()
+	}
+
+	if rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/config.yaml","content":"v1"}`); rec.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", rec.Code, rec.Body)
+	}
+	if got := read(); got != "v1" {
+		t.Fatalf("read = %q, want v1", got)
+	}
+	if _, ok := storageFileCache.entries[path]; !ok {
+		t.Fatal("expected the file to be cached after a read")
+	}
+
+	if rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/config.yaml","content":"v2"}`); rec.Code != http.StatusOK {
+		t.Fatalf("save: %d %s", rec.Code, rec.Body)
+	}
+	if got := read(); got != "v2" {
+		t.Errorf("after a save, read = %q, want v2", got)
+	}
+
+	if err := os.WriteFile(path, []byte("v3"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(); got != "v3" {
+		t.Errorf("after an external write, read = %q, want v3", got)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+)
+
+// openLockedFile opens path like os.OpenFile and, when storage.use_file_locks
+// is set, takes an advisory flock on it: shared when opened read-only,
+// exclusive otherwise. The lock is released when the file is closed. Advisory
+// locks only coordinate with other programs that also flock the file; they
+// don't stop ones that don't.
+func openLockedFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if appConfig == nil || !appConfig.Storage.UseFileLocks {
+		return f, nil
+	}
+	exclusive := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if err := flockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileLocksSupported reports whether storage.use_file_locks can be honoured.
+const fileLocksSupported = false
+
+// flockFile is never reached: loadConfig rejects use_file_locks here.
+func flockFile(f *os.File, exclusive bool) error {
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileLocksSupported reports whether storage.use_file_locks can be honoured.
+const fileLocksSupported = true
+
+// flockFile blocks until it holds a shared or exclusive flock on f.
+func flockFile(f *os.File, exclusive bool) error {
+	how := unix.LOCK_SH
+	if exclusive {
+		how = unix.LOCK_EX
+	}
+	for {
+		err := unix.Flock(int(f.Fd()), how)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock %s: %w", f.Name(), err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestReadWaitsForExternalLock holds an exclusive flock the way another
+// program would and checks a read waits for it only when use_file_locks is on.
+func TestReadWaitsForExternalLock(t *testing.T) {
+	dir := useTempStorage(t)
+	path := filepath.Join(dir, "shared.txt")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := unix.Flock(int(other.Fd()), unix.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+
+	// Locks off: the read goes straight through.
+	if _, err := readStoredFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	appConfig.Storage.UseFileLocks = true
+	done := make(chan struct{})
+	go func() {
+		if _, err := readStoredFile(path); err != nil {
+			t.Error(err)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("read did not wait for the exclusive lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unix.Flock(int(other.Fd()), unix.LOCK_UN)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("read still blocked after the lock was released")
+	}
+}
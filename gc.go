@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// @Summary Delete old files
+// @Description Delete the files under a directory that were last modified more than olderThanDays ago, e.g. to clear out stale exports. Only regular files are deleted; directories are kept, and symbolic links are neither deleted nor followed, so nothing outside the storage directory is ever touched. With dryRun, nothing is deleted and the response lists what would be.
+// @Tags storage
+// @Accept json
+// @Produce json
+// @Param request body StorageGCRequest true "What to clean up"
+// @Success 200 {object} StorageGCResponse "Files deleted (or, with dryRun, that would be)"
+// @Failure 400 {object} StorageGCResponse "Bad request - invalid path or age"
+// @Failure 404 {object} StorageGCResponse "Directory not found"
+// @Failure 500 {object} StorageGCResponse "Internal server error"
+// @Router /api/storage/gc [post]
+func handleStorageGC(c echo.Context) error {
+	// Walking and deleting a big tree can outlast the write timeout.
+	liftWriteDeadline(c)
+
+	var req StorageGCRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageGCResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if req.Path == "" {
+		return c.JSON(http.StatusBadRequest, StorageGCResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+	if req.OlderThanDays <= 0 {
+		return c.JSON(http.StatusBadRequest, StorageGCResponse{
+			Success: false,
+			Error:   "olderThanDays must be a positive number of days",
+		})
+	}
+
+	root, err := validateAndResolvePath(c, req.Path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	info, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return c.JSON(http.StatusNotFound, StorageGCResponse{
+			Success: false,
+			Error:   "directory not found",
+		})
+	}
+	if err != nil || !info.IsDir() {
+		return c.JSON(http.StatusBadRequest, StorageGCResponse{
+			Success: false,
+			Error:   "path must be a directory",
+		})
+	}
+	if !withinStorageDir(c, root) {
+		return c.JSON(http.StatusBadRequest, StorageGCResponse{
+			Success: false,
+			Error:   "path is outside of storage directory",
+		})
+	}
+
+	cutoff := time.Now().Add(-time.Duration(req.OlderThanDays * float64(24*time.Hour)))
+	response := StorageGCResponse{Success: true, DryRun: req.DryRun, Removed: []string{}}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A directory removed or unreadable mid-walk is skipped, not fatal.
+			logWarnf("Garbage collection skipped %s: %v", path, err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// WalkDir never follows symbolic links, and they aren't deleted
+		// either: only regular files are collected.
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			return nil
+		}
+
+		if !req.DryRun {
+			if err := removeOldFile(path, cutoff); err != nil {
+				if !errors.Is(err, errFileChanged) {
+					logErrorf("Failed to delete %s: %v", path, err)
+					response.Failed = append(response.Failed, requestRelativePath(c, path))
+					response.Success = false
+				}
+				return nil
+			}
+		}
+		response.Removed = append(response.Removed, requestRelativePath(c, path))
+		response.FreedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		logErrorf("Failed to collect old files under %s: %v", root, err)
+		return c.JSON(http.StatusInternalServerError, StorageGCResponse{
+			Success: false,
+			Error:   "failed to collect old files",
+		})
+	}
+
+	if !req.DryRun {
+		setQuotaHeader(c)
+		logInfof("Garbage collection removed %d files (%d bytes) under %s", len(response.Removed), response.FreedBytes, root)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// errFileChanged is returned by removeOldFile when the file was written after
+// the walk saw it, so it is no longer old.
+var errFileChanged = errors.New("file changed")
+
+// removeOldFile deletes the regular file at path unless it has been modified
+// since cutoff, crediting the freed space to the quota.
+func removeOldFile(path string, cutoff time.Time) error {
+	unlock := storageLocks.lock(path)
+	defer unlock()
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+		return errFileChanged
+	}
+	defer invalidateCachedFile(path)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if storageUsage != nil {
+		storageUsage.reserve(-info.Size())
+	}
+	forgetStoredFile(path)
+	return nil
+}
+
+// withinStorageDir reports whether path, with every symbolic link resolved,
+// still lies inside the request's storage directory, so a linked directory
+// can't lead an operation outside of it.
+func withinStorageDir(c echo.Context, path string) bool {
+	storageDir, err := filepath.EvalSymlinks(storageRoot(c))
+	if err != nil {
+		return false
+	}
+	if storageDir, err = filepath.Abs(storageDir); err != nil {
+		return false
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	return resolved == storageDir || strings.HasPrefix(resolved, storageDir+string(filepath.Separator))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// doStorageGC posts body to the garbage collection handler and decodes the
+// response.
+func doStorageGC(t *testing.T, body string) (int, StorageGCResponse) {
+	t.Helper()
+	rec := doStorageJSON(t, handleStorageGC, http.MethodPost, "/api/storage/gc", body)
+	var resp StorageGCResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+func TestHandleStorageGC(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "exports/old.csv", "exports/nested/old.csv", "exports/new.csv", "keep/old.csv")
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"exports/old.csv", "exports/nested/old.csv", "keep/old.csv"} {
+		if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := t.TempDir()
+	writeStorageFiles(t, outside, "secret.txt")
+	if err := os.Chtimes(filepath.Join(outside, "secret.txt"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "exports", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	code, resp := doStorageGC(t, `{"path": "/exports", "olderThanDays": 1, "dryRun": true}`)
+	want := "/exports/nested/old.csv,/exports/old.csv"
+	if code != http.StatusOK || !resp.DryRun || strings.Join(resp.Removed, ",") != want {
+		t.Fatalf("dry run: got %d %+v, want %s", code, resp, want)
+	}
+	assertExists(t, dir, true, "exports/old.csv", "exports/nested/old.csv")
+
+	code, resp = doStorageGC(t, `{"path": "/exports", "olderThanDays": 1}`)
+	if code != http.StatusOK || !resp.Success || strings.Join(resp.Removed, ",") != want || resp.FreedBytes == 0 {
+		t.Fatalf("got %d %+v, want %s removed", code, resp, want)
+	}
+	assertExists(t, dir, false, "exports/old.csv", "exports/nested/old.csv")
+	assertExists(t, dir, true, "exports/new.csv", "exports/nested", "exports/link", "keep/old.csv")
+	assertExists(t, outside, true, "secret.txt")
+
+	// The symlinked directory itself can't be collected either.
+	if code, _ := doStorageGC(t, `{"path": "/exports/link", "olderThanDays": 1}`); code != http.StatusBadRequest {
+		t.Errorf("symlinked dir: status = %d, want 400", code)
+	}
+	assertExists(t, outside, true, "secret.txt")
+
+	for body, wantCode := range map[string]int{
+		`{"path": "/exports"}`:                          http.StatusBadRequest,
+		`{"path": "/../etc", "olderThanDays": 1}`:       http.StatusBadRequest,
+		`{"path": "/missing", "olderThanDays": 1}`:      http.StatusNotFound,
+		`{"path": "/keep/old.csv", "olderThanDays": 1}`: http.StatusBadRequest,
+	} {
+		if code, _ := doStorageGC(t, body); code != wantCode {
+			t.Errorf("%s: status = %d, want %d", body, code, wantCode)
+		}
+	}
+}
+
+// TestHandleStorageGCForgetsFile checks a collected file's expiry and download
+// limit don't carry over to a new file unzipped at its path.
+func TestHandleStorageGCForgetsFile(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "exports/old.csv")
+	t.Cleanup(func() {
+		storageExpiry.load("")
+		storageDownloads.load(false, "")
+	})
+	path := filepath.Join(dir, "exports", "old.csv")
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	storageExpiry.set(path, time.Now().Add(-time.Second))
+	storageDownloads.limit(path, 1)
+
+	if code, resp := doStorageGC(t, `{"path": "/exports", "olderThanDays": 1}`); code != http.StatusOK || len(resp.Removed) != 1 {
+		t.Fatalf("gc: got %d %+v, want old.csv removed", code, resp)
+	}
+	if rec := doUnzip(t, "/api/storage/unzip?path=/exports", makeZip(t, [][2]string{{"old.csv", "fresh"}})); rec.Code != http.StatusOK {
+		t.Fatalf("unzip: status %d: %s", rec.Code, rec.Body)
+	}
+
+	sweepExpiredFiles()
+	assertExists(t, dir, true, "exports/old.csv")
+	if downloads, _ := storageDownloads.get(path); downloads.Max != 0 {
+		t.Errorf("recreated file kept the download limit %d", downloads.Max)
+	}
+}
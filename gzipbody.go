@@ -0,0 +1,66 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxDecompressedBodyBytes caps how large a gzip-compressed request body may
+// grow once decompressed, so a small "zip bomb" can't exhaust memory. It
+// matches the largest upload any endpoint accepts. A variable so tests can
+// lower it.
+var maxDecompressedBodyBytes int64 = 256 << 20
+
+// gzipBody is a decompressed request body that closes both the gzip reader and
+// the underlying body.
+type gzipBody struct {
+	io.Reader
+	gz   *gzip.Reader
+	body io.ReadCloser
+}
+
+func (b *gzipBody) Close() error {
+	b.gz.Close()
+	return b.body.Close()
+}
+
+// decompressRequestBody returns middleware that transparently decompresses
+// request bodies sent with Content-Encoding: gzip, so handlers bind and read
+// plain JSON or file content as usual. The decompressed body is limited to
+// maxDecompressedBodyBytes: reading past it fails like any oversized body
+// (413 for uploads, 400 for JSON). Other encodings are rejected with 415.
+func decompressRequestBody() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(echo.HeaderContentEncoding)))
+			switch encoding {
+			case "", "identity":
+				return next(c)
+			case "gzip", "x-gzip":
+			default:
+				c.Response().Header().Set("Accept-Encoding", "gzip")
+				return c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{Error: "unsupported Content-Encoding " + encoding + "; only gzip is supported"})
+			}
+
+			gz, err := gzip.NewReader(req.Body)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid gzip request body"})
+			}
+			req.Body = &gzipBody{
+				Reader: http.MaxBytesReader(c.Response(), io.NopCloser(gz), maxDecompressedBodyBytes),
+				gz:     gz,
+				body:   req.Body,
+			}
+			// Handlers now see an uncompressed body of unknown length.
+			req.Header.Del(echo.HeaderContentEncoding)
+			req.Header.Del(echo.HeaderContentLength)
+			req.ContentLength = -1
+			return next(c)
+		}
+	}
+}
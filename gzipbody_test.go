@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestDecompressRequestBody checks gzip-encoded JSON and raw uploads reach the
+// handlers decompressed, and that other encodings and bad gzip are rejected.
+func TestDecompressRequestBody(t *testing.T) {
+	dir := useTempStorage(t)
+	e := echo.New()
+	e.Use(decompressRequestBody())
+	e.POST("/api/storage", handleStorage)
+	e.Any("/api/storage/*", handleStorageWithPath)
+
+	send := func(method, target, contentType, encoding string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		if encoding != "" {
+			req.Header.Set(echo.HeaderContentEncoding, encoding)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(http.MethodPost, "/api/storage", echo.MIMEApplicationJSON, "gzip",
+		gzipBytes(t, []byte(`{"path":"/config.yaml","content":"port: 6432\n"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("gzip JSON: %d %s", rec.Code, rec.Body)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "config.yaml")); string(got) != "port: 6432\n" {
+		t.Errorf("gzip JSON stored %q", got)
+	}
+
+	content := []byte(strings.Repeat("log line\n", 1000))
+	rec = send(http.MethodPut, "/api/storage/app.log", "text/plain", "GZIP", gzipBytes(t, content))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("gzip upload: %d %s", rec.Code, rec.Body)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "app.log")); !bytes.Equal(got, content) {
+		t.Errorf("gzip upload stored %d bytes, want %d", len(got), len(content))
+	}
+
+	if rec := send(http.MethodPost, "/api/storage", echo.MIMEApplicationJSON, "br", []byte("x")); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("br: status = %d, want 415", rec.Code)
+	}
+	if rec := send(http.MethodPost, "/api/storage", echo.MIMEApplicationJSON, "gzip", []byte(`{"path":"/x"}`)); rec.Code != http.StatusBadRequest {
+		t.Errorf("not gzip: status = %d, want 400", rec.Code)
+	}
+}
+
+// TestDecompressRequestBodyLimit checks the size limit applies to the
+// decompressed body, so a tiny compressed bomb is refused.
+func TestDecompressRequestBodyLimit(t *testing.T) {
+	dir := useTempStorage(t)
+	prev := maxDecompressedBodyBytes
+	maxDecompressedBodyBytes = 1 << 20
+	t.Cleanup(func() { maxDecompressedBodyBytes = prev })
+
+	e := echo.New()
+	e.Use(decompressRequestBody())
+	e.POST("/api/storage", handleStorage)
+	e.Any("/api/storage/*", handleStorageWithPath)
+
+	bomb := gzipBytes(t, make([]byte, 2<<20))
+	if len(bomb) > 64<<10 {
+		t.Fatalf("bomb is %d bytes compressed; expected it to be tiny", len(bomb))
+	}
+	req := httptest.NewRequest(http.MethodPut, "/api/storage/bomb.bin", bytes.NewReader(bomb))
+	req.Header.Set(echo.HeaderContentEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload bomb: status = %d, want 413", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bomb.bin")); !os.IsNotExist(err) {
+		t.Error("upload bomb was written")
+	}
+
+	payload, _ := json.Marshal(StorageRequest{Path: "/big.txt", Content: strings.Repeat("a", 2<<20)})
+	req = httptest.NewRequest(http.MethodPost, "/api/storage", bytes.NewReader(gzipBytes(t, payload)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderContentEncoding, "gzip")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK {
+		t.Error("oversized JSON was accepted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "big.txt")); !os.IsNotExist(err) {
+		t.Error("oversized JSON was written")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// validateResponseHeaders rejects header names that can't be sent, and a
+// header both removed and set.
+func validateResponseHeaders(cfg ResponseHeadersConfig) error {
+	removed := make(map[string]bool, len(cfg.Remove))
+	for _, name := range cfg.Remove {
+		if !validHeaderName(name) {
+			return fmt.Errorf("remove: invalid header name %q", name)
+		}
+		removed[http.CanonicalHeaderKey(name)] = true
+	}
+	for name, value := range cfg.Set {
+		if !validHeaderName(name) {
+			return fmt.Errorf("set: invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("set: value of %s spans lines", name)
+		}
+		if removed[http.CanonicalHeaderKey(name)] {
+			return fmt.Errorf("%s is both removed and set", name)
+		}
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is a non-empty HTTP token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// rewriteResponseHeaders returns middleware that applies cfg to the headers
+// of every response right before they are written, so headers set by
+// handlers and other middleware, error responses included, are covered too.
+func rewriteResponseHeaders(cfg ResponseHeadersConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			res := c.Response()
+			res.Before(func() {
+				header := res.Header()
+				// A present but empty entry also keeps net/http from adding
+				// its own, as it does for Date.
+				for _, name := range cfg.Remove {
+					header[http.CanonicalHeaderKey(name)] = nil
+				}
+				for name, value := range cfg.Set {
+					header.Set(name, value)
+				}
+			})
+			return next(c)
+		}
+	}
+}
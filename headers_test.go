@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestRewriteResponseHeaders checks configured headers are removed or
+// overridden, even when a handler sets them or answers with an error.
+func TestRewriteResponseHeaders(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = jsonErrorHandler
+	e.Use(rewriteResponseHeaders(ResponseHeadersConfig{
+		Remove: []string{"x-powered-by", "Date"},
+		Set:    map[string]string{"Server": "mowa"},
+	}))
+	e.GET("/api/uptime", func(c echo.Context) error {
+		c.Response().Header().Set("X-Powered-By", "Echo")
+		c.Response().Header().Set("Server", "Echo/4")
+		return c.String(http.StatusOK, "ok")
+	})
+
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	for _, path := range []string{"/api/uptime", "/missing"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("Server"); got != "mowa" {
+			t.Errorf("%s: Server = %q, want mowa", path, got)
+		}
+		for _, name := range []string{"X-Powered-By", "Date"} {
+			if got, ok := resp.Header[name]; ok {
+				t.Errorf("%s: %s = %q, want it removed", path, name, got)
+			}
+		}
+	}
+}
+
+func TestValidateResponseHeaders(t *testing.T) {
+	if err := validateResponseHeaders(ResponseHeadersConfig{Remove: []string{"X-Powered-By"}, Set: map[string]string{"Server": "mowa"}}); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+	for name, cfg := range map[string]ResponseHeadersConfig{
+		"empty name":       {Remove: []string{""}},
+		"space in name":    {Set: map[string]string{"X Frame": "deny"}},
+		"multi-line value": {Set: map[string]string{"Server": "mowa\r\nX-Injected: 1"}},
+		"removed and set":  {Remove: []string{"server"}, Set: map[string]string{"Server": "mowa"}},
+	} {
+		if err := validateResponseHeaders(cfg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// @Summary Health check
+// @Description Report whether the server is healthy. Besides answering at all, this verifies the storage directory is writable by creating and removing a temporary file, so a full disk or a volume remounted read-only is caught (skipped when storage is disabled). Returns 503 when a check fails.
+// @Tags system
+// @Produce json
+// @Success 200 {object} HealthResponse "Healthy"
+// @Failure 503 {object} HealthResponse "A check failed"
+// @Router /api/health [get]
+func handleHealth(c echo.Context) error {
+	response := HealthResponse{Status: "ok"}
+
+	// Without the storage feature the directory may never be used, so it is
+	// neither checked nor created.
+	if !appConfig.Features.storageEnabled() {
+		return c.JSON(http.StatusOK, response)
+	}
+
+	writable := true
+	response.StorageWritable = &writable
+	if err := checkStorageWritable(appConfig.Storage.Dir); err != nil {
+		logWarnf("Health check: storage directory %s is not writable: %v", appConfig.Storage.Dir, err)
+		writable = false
+		response.Status = "unhealthy"
+		response.Error = "storage directory is not writable"
+		return c.JSON(http.StatusServiceUnavailable, response)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// checkStorageWritable creates, writes and removes a temporary file in dir,
+// creating dir first if nothing has been stored yet.
+func checkStorageWritable(dir string) error {
+	if err := mkdirStorage(dir); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".mowa-health-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write([]byte("ok")); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// storageSelfCheck writes a temporary file in dir, reads it back, compares
+// the content and deletes the file, so a storage directory that can't be
+// used (wrong permissions, a missing or read-only mount) is caught at startup
+// rather than by the first real request.
+func storageSelfCheck(dir string) error {
+	if err := mkdirStorage(dir); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+	f, err := os.CreateTemp(dir, ".mowa-selfcheck-*")
+	if err != nil {
+		return fmt.Errorf("create a file: %w", err)
+	}
+	name := f.Name()
+	defer os.Remove(name)
+
+	want := []byte("mowa self-check " + time.Now().Format(time.RFC3339Nano))
+	if _, err := f.Write(want); err != nil {
+		f.Close()
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+
+	got, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("read %s: got %d bytes back that differ from the %d written", name, len(got), len(want))
+	}
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("delete %s: %w", name, err)
+	}
+	return nil
+}
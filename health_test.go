@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestHandleHealth(t *testing.T) {
+	dir := useTempStorage(t)
+
+	check := func() (int, HealthResponse) {
+		rec := httptest.NewRecorder()
+		if err := handleHealth(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/health", nil), rec)); err != nil {
+			t.Fatal(err)
+		}
+		var resp HealthResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, resp
+	}
+
+	if code, resp := check(); code != http.StatusOK || resp.StorageWritable == nil || !*resp.StorageWritable || resp.Status != "ok" {
+		t.Errorf("writable storage: %d %+v", code, resp)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("health check left %d files behind", len(entries))
+	}
+
+	// A storage path blocked by a regular file can never be written to.
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	appConfig.Storage.Dir = filepath.Join(blocked, "storage")
+	if code, resp := check(); code != http.StatusServiceUnavailable || resp.StorageWritable == nil || *resp.StorageWritable || resp.Status != "unhealthy" {
+		t.Errorf("unwritable storage: %d %+v", code, resp)
+	}
+
+	// With storage disabled the directory isn't checked at all.
+	off := false
+	appConfig.Features.Storage = &off
+	if code, resp := check(); code != http.StatusOK || resp.StorageWritable != nil {
+		t.Errorf("storage disabled: %d %+v", code, resp)
+	}
+}
+
+func TestStorageSelfCheck(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "storage")
+	if err := storageSelfCheck(dir); err != nil {
+		t.Fatalf("usable directory: %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("self-check left %d files behind", len(entries))
+	}
+
+	blocked := filepath.Join(t.TempDir(), "blocked")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := storageSelfCheck(filepath.Join(blocked, "storage")); err == nil {
+		t.Error("directory under a file: expected an error")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// defaultHeartbeatRebootThresholdSeconds is the uptime below which mowa assumes
+// the machine has just rebooted when heartbeat.reboot_threshold_seconds is not
+// set. Ten minutes covers a slow boot plus launchd starting the agent.
+const defaultHeartbeatRebootThresholdSeconds = 10 * 60
+
+// shutdownNotifyTimeout bounds how long shutdown waits for the shutdown
+// notification, so a wedged Messages app can't keep the process alive.
+const shutdownNotifyTimeout = 10 * time.Second
+
+// startHeartbeat runs the heartbeat notifications configured under heartbeat:
+// a one-off alert at startup when uptime shows the machine has just rebooted,
+// then, if heartbeat.interval_minutes is set, a periodic "still alive"
+// message. It does nothing without recipients and is meant to run in its own
+// goroutine for the life of the server.
+func startHeartbeat() {
+	cfg := appConfig.Heartbeat
+	if len(cfg.Notify) == 0 {
+		return
+	}
+
+	if uptime, err := getUptime(); err != nil {
+		logWarnf("Heartbeat: could not read uptime: %v", err)
+	} else if message, rebooted := rebootAlertMessage(uptime, heartbeatRebootThreshold()); rebooted {
+		sendHeartbeat(context.Background(), cfg.Notify, message)
+	}
+
+	if cfg.IntervalMinutes <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(cfg.IntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		uptime, err := getUptime()
+		if err != nil {
+			logWarnf("Heartbeat: could not read uptime: %v", err)
+			continue
+		}
+		sendHeartbeat(context.Background(), cfg.Notify, aliveMessage(uptime))
+	}
+}
+
+// heartbeatRebootThreshold returns the configured reboot threshold, falling
+// back to the default when no config has been loaded or the value is invalid.
+func heartbeatRebootThreshold() time.Duration {
+	if appConfig != nil && appConfig.Heartbeat.RebootThresholdSeconds > 0 {
+		return time.Duration(appConfig.Heartbeat.RebootThresholdSeconds) * time.Second
+	}
+	return defaultHeartbeatRebootThresholdSeconds * time.Second
+}
+
+// rebootAlertMessage reports whether uptime is low enough to count as a fresh
+// reboot, and the message to send about it.
+func rebootAlertMessage(uptime UptimeResponse, threshold time.Duration) (string, bool) {
+	if time.Duration(uptime.UptimeSeconds*float64(time.Second)) >= threshold {
+		return "", false
+	}
+	return fmt.Sprintf("🔄 %s has restarted (up %s)", heartbeatHostname(), describeUptime(uptime)), true
+}
+
+// notifyShutdown tells the heartbeat recipients the server is stopping, if
+// heartbeat.notify_on_shutdown is set. A send still running after timeout is
+// killed, so nothing is left behind once it returns.
+func notifyShutdown(timeout time.Duration) {
+	cfg := appConfig.Heartbeat
+	if !cfg.NotifyOnShutdown || len(cfg.Notify) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	sendHeartbeat(ctx, cfg.Notify, shutdownMessage())
+	if ctx.Err() != nil {
+		logWarnf("Heartbeat: gave up on the shutdown notification after %s", timeout)
+	}
+}
+
+// shutdownMessage is the text sent when the server stops.
+func shutdownMessage() string {
+	return fmt.Sprintf("⏹️ %s is shutting down", heartbeatHostname())
+}
+
+// aliveMessage is the periodic heartbeat text.
+func aliveMessage(uptime UptimeResponse) string {
+	return fmt.Sprintf("💓 %s is alive (up %s)", heartbeatHostname(), describeUptime(uptime))
+}
+
+// describeUptime is the human-readable uptime, which formatUptimeResponse
+// leaves empty for the first minute.
+func describeUptime(uptime UptimeResponse) string {
+	if uptime.Formatted == "" {
+		return "less than a minute"
+	}
+	return uptime.Formatted
+}
+
+// heartbeatHostname names this machine in heartbeat messages.
+func heartbeatHostname() string {
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+	return "mowa"
+}
+
+// sendHeartbeat messages the heartbeat recipients and logs the outcome. Sends
+// still running once ctx is done are killed.
+func sendHeartbeat(ctx context.Context, notify []string, message string) {
+	pacer := newMessagePacer(ctx)
+	pacer.interrupt = true
+	for _, result := range pacer.send(expandGroups(notify), message, 0) {
+		if result.Success {
+			logInfof("Heartbeat sent to %s", result.Recipient)
+		} else {
+			logWarnf("Failed to send heartbeat to %s: %s", result.Recipient, *result.Error)
+		}
+	}
+}
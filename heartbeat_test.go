@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRebootAlertMessage(t *testing.T) {
+	threshold := 10 * time.Minute
+
+	if _, rebooted := rebootAlertMessage(formatUptimeResponse(3600), threshold); rebooted {
+		t.Error("an hour of uptime should not count as a reboot")
+	}
+
+	msg, rebooted := rebootAlertMessage(formatUptimeResponse(120), threshold)
+	if !rebooted {
+		t.Fatal("two minutes of uptime should count as a reboot")
+	}
+	if !strings.Contains(msg, "restarted") || !strings.Contains(msg, "2 minutes") {
+		t.Errorf("message = %q", msg)
+	}
+
+	msg, _ = rebootAlertMessage(formatUptimeResponse(20), threshold)
+	if !strings.Contains(msg, "less than a minute") {
+		t.Errorf("message for 20s uptime = %q", msg)
+	}
+}
+
+func TestHeartbeatRebootThresholdDefault(t *testing.T) {
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+
+	appConfig = defaultConfig()
+	if got := heartbeatRebootThreshold(); got != defaultHeartbeatRebootThresholdSeconds*time.Second {
+		t.Errorf("default threshold = %s", got)
+	}
+	appConfig.Heartbeat.RebootThresholdSeconds = 90
+	if got := heartbeatRebootThreshold(); got != 90*time.Second {
+		t.Errorf("configured threshold = %s, want 90s", got)
+	}
+}
+
+// TestNotifyShutdown checks the shutdown message is only sent when enabled,
+// and that a hung send doesn't hold up shutdown past the timeout.
+func TestNotifyShutdown(t *testing.T) {
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+	appConfig = defaultConfig()
+	appConfig.Heartbeat.Notify = []string{"+15550000001"}
+
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+	notifyShutdown(time.Second)
+	if len(*scripts) != 0 {
+		t.Fatalf("sent %d messages without notify_on_shutdown", len(*scripts))
+	}
+
+	appConfig.Heartbeat.NotifyOnShutdown = true
+	notifyShutdown(time.Second)
+	if len(*scripts) != 1 || !strings.Contains((*scripts)[0], "is shutting down") {
+		t.Fatalf("scripts = %q, want one shutdown message", *scripts)
+	}
+
+	// A hung osascript is killed, like exec.CommandContext does, once the
+	// timeout passes, and notifyShutdown returns only after it is gone.
+	running := true
+	prevRun := runCommand
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		<-ctx.Done()
+		running = false
+		return nil, ctx.Err()
+	}
+	t.Cleanup(func() { runCommand = prevRun })
+	start := time.Now()
+	notifyShutdown(50 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("notifyShutdown waited %s on a hung send", elapsed)
+	}
+	if running {
+		t.Error("notifyShutdown returned with the send still running")
+	}
+}
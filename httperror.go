@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// jsonErrorHandler replaces Echo's default error handler so every error,
+// including routing errors such as an unknown path (404) or a wrong method
+// (405), is rendered as the same {"error": "..."} body the handlers use.
+// Internal errors are logged and reported generically, never echoed back. The
+// body carries the request's ID, so a report can be matched to the logs.
+func jsonErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	message := http.StatusText(status)
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		status = httpErr.Code
+		if httpErr.Internal != nil {
+			logErrorf("%s %s: %v", c.Request().Method, c.Request().URL.Path, httpErr.Internal)
+		}
+		if msg, ok := httpErr.Message.(string); ok {
+			message = msg
+		} else {
+			message = fmt.Sprint(httpErr.Message)
+		}
+	} else {
+		logErrorf("%s %s: %v", c.Request().Method, c.Request().URL.Path, err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, ErrorResponse{Error: message, RequestID: requestID(c)})
+	}
+	if err != nil {
+		logErrorf("Failed to send error response: %v", err)
+	}
+}
+
+// recoverPanics returns middleware that turns a panicking handler into a 500
+// with the usual JSON error body. The panic is logged along with the stack of
+// the goroutine that raised it and the request's ID; the client learns
+// nothing of it beyond the ID.
+func recoverPanics() echo.MiddlewareFunc {
+	return middleware.RecoverWithConfig(middleware.RecoverConfig{
+		DisableStackAll: true,
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			logErrorf("Panic serving %s %s (request %s): %v\n%s", c.Request().Method, c.Request().URL.Path, requestID(c), err, stack)
+			// Without an internal error, jsonErrorHandler doesn't log it again.
+			return echo.NewHTTPError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		},
+	})
+}
+
+// requestID returns the ID middleware.RequestID gave the request, or "" when
+// it has none.
+func requestID(c echo.Context) string {
+	return c.Response().Header().Get(echo.HeaderXRequestID)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// TestJSONErrorHandler checks routing errors, handler HTTP errors and plain
+// errors all render as {"error": "..."}, with internal details hidden.
+func TestJSONErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = jsonErrorHandler
+	e.GET("/api/uptime", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/api/missing", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+	})
+	e.GET("/api/broken", func(c echo.Context) error { return errors.New("disk on fire at /secret/path") })
+
+	cases := []struct {
+		method, target string
+		wantStatus     int
+		wantError      string
+	}{
+		{http.MethodGet, "/nope", http.StatusNotFound, "Not Found"},
+		{http.MethodPost, "/api/uptime", http.StatusMethodNotAllowed, "Method Not Allowed"},
+		{http.MethodGet, "/api/missing", http.StatusNotFound, "file not found"},
+		{http.MethodGet, "/api/broken", http.StatusInternalServerError, "Internal Server Error"},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+
+		if rec.Code != tc.wantStatus {
+			t.Errorf("%s %s: status = %d, want %d", tc.method, tc.target, rec.Code, tc.wantStatus)
+		}
+		var body ErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s %s: body %q is not JSON: %v", tc.method, tc.target, rec.Body.String(), err)
+			continue
+		}
+		if body.Error != tc.wantError {
+			t.Errorf("%s %s: error = %q, want %q", tc.method, tc.target, body.Error, tc.wantError)
+		}
+	}
+}
+
+// TestRecoverPanics checks a panicking handler gets the JSON error body with
+// the request's ID, and the panic isn't echoed back.
+func TestRecoverPanics(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = jsonErrorHandler
+	e.Use(middleware.RequestID(), recoverPanics())
+	e.GET("/api/groups", func(c echo.Context) error {
+		var groups map[string][]string
+		groups["family"] = nil // assignment to a nil map panics
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/groups", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	var body ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not JSON: %v", rec.Body.String(), err)
+	}
+	if body.Error != "Internal Server Error" || body.RequestID == "" || body.RequestID != rec.Header().Get(echo.HeaderXRequestID) {
+		t.Errorf("body = %+v with X-Request-Id %q, want a generic error carrying the ID", body, rec.Header().Get(echo.HeaderXRequestID))
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// idempotencyKeyHeader lets clients retry POST /api/messages safely: a repeat
+// request carrying the same key gets the original MessageResponse back instead
+// of texting everyone again.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyReplayedHeader marks a response served from the idempotency cache.
+const idempotencyReplayedHeader = "Idempotent-Replayed"
+
+// defaultIdempotencyTTLSeconds is how long a key's response is remembered when
+// messages.idempotency_ttl_seconds is not set. A day comfortably covers client
+// retry windows while keeping the in-memory cache small.
+const defaultIdempotencyTTLSeconds = 24 * 60 * 60
+
+// idempotencyEntry is one remembered request. done is closed once the first
+// request carrying the key has finished sending, so a concurrent retry waits
+// for that result instead of sending in parallel.
+type idempotencyEntry struct {
+	fingerprint string
+	done        chan struct{}
+	response    MessageResponse
+	expires     time.Time
+}
+
+// idempotencyStore is an in-memory, process-local cache of message responses
+// keyed by Idempotency-Key. Entries expire ttl after they complete and are
+// purged lazily whenever a new key is seen.
+type idempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+}
+
+var messageIdempotency = &idempotencyStore{entries: make(map[string]*idempotencyEntry)}
+
+// begin looks up key, registering a new in-flight entry for fingerprint when
+// there is none (or only an expired one). fresh reports whether the caller
+// owns the new entry and must send, then call finish.
+func (s *idempotencyStore) begin(key, fingerprint string) (entry *idempotencyEntry, fresh bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.entries[key]; ok && (existing.expires.IsZero() || now.Before(existing.expires)) {
+		return existing, false
+	}
+
+	for k, e := range s.entries {
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+
+	entry = &idempotencyEntry{fingerprint: fingerprint, done: make(chan struct{})}
+	s.entries[key] = entry
+	return entry, true
+}
+
+// finish records the response for an entry obtained from begin and releases
+// any requests waiting on it.
+func (s *idempotencyStore) finish(entry *idempotencyEntry, response MessageResponse, ttl time.Duration) {
+	s.mu.Lock()
+	entry.response = response
+	entry.expires = time.Now().Add(ttl)
+	s.mu.Unlock()
+	close(entry.done)
+}
+
+// messageFingerprint identifies what a message request asks for, so reusing an
+// Idempotency-Key for a different send can be told apart from a genuine retry.
+// Every field counts, as each changes what is sent: the same message split or
+// not, or rendered from a template with other vars, is a different send.
+func messageFingerprint(request MessageRequest) string {
+	data, _ := json.Marshal(request)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyTTL returns the configured idempotency window, falling back to
+// the default when no config has been loaded or the value is invalid.
+func idempotencyTTL() time.Duration {
+	if appConfig != nil && appConfig.Messages.IdempotencyTTLSeconds > 0 {
+		return time.Duration(appConfig.Messages.IdempotencyTTLSeconds) * time.Second
+	}
+	return defaultIdempotencyTTLSeconds * time.Second
+}
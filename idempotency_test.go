@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	s := &idempotencyStore{entries: make(map[string]*idempotencyEntry)}
+	fp := messageFingerprint(MessageRequest{To: []string{"+1234567890"}, Message: "hi"})
+
+	entry, fresh := s.begin("k1", fp)
+	if !fresh {
+		t.Fatal("first use of a key must be fresh")
+	}
+
+	// A retry while the first request is still sending shares its entry and
+	// sees the result once it finishes.
+	retry, fresh := s.begin("k1", fp)
+	if fresh || retry != entry {
+		t.Fatal("retry of an in-flight key must reuse the existing entry")
+	}
+	want := MessageResponse{Results: []MessageResult{{Recipient: "+1234567890", Success: true}}}
+	s.finish(entry, want, time.Hour)
+	<-retry.done
+	if len(retry.response.Results) != 1 || !retry.response.Results[0].Success {
+		t.Errorf("retry saw %+v, want the original response", retry.response)
+	}
+
+	// Different content under the same key is detectable via the fingerprint.
+	for _, other := range []MessageRequest{
+		{To: []string{"+1234567890"}, Message: "bye"},
+		{To: []string{"+1234567890"}, Message: "hi", Split: true},
+		{To: []string{"+1234567890"}, Message: "hi", Template: "greeting"},
+		{To: []string{"+1234567890"}, Message: "hi", Vars: map[string]string{"name": "Ada"}},
+	} {
+		if messageFingerprint(other) == fp {
+			t.Errorf("%+v has the fingerprint of a different request", other)
+		}
+	}
+
+	// Once expired, the key starts over.
+	entry.expires = time.Now().Add(-time.Second)
+	if _, fresh := s.begin("k1", fp); !fresh {
+		t.Error("an expired key must be fresh again")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// logLevelEnv names the environment variable that sets the minimum level
+// written to the server log.
+const logLevelEnv = "MOWA_LOG_LEVEL"
+
+// logLevel orders log messages by severity; a message is written only when its
+// level is at or above currentLogLevel.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// currentLogLevel defaults to info, so per-request detail such as raw
+// AppleScript output stays out of the log unless asked for.
+var currentLogLevel = levelInfo
+
+// parseLogLevel maps a level name (debug, info, warn or error, in any case) to
+// its logLevel. "warning" is accepted as an alias for warn.
+func parseLogLevel(s string) (logLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return levelDebug, nil
+	case "info":
+		return levelInfo, nil
+	case "warn", "warning":
+		return levelWarn, nil
+	case "error":
+		return levelError, nil
+	}
+	return levelInfo, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+}
+
+// initLogLevel sets currentLogLevel from MOWA_LOG_LEVEL. An unset variable
+// keeps the default; an invalid one is reported and also keeps it, so a typo
+// never silences the log.
+func initLogLevel() {
+	value := os.Getenv(logLevelEnv)
+	if value == "" {
+		return
+	}
+	level, err := parseLogLevel(value)
+	if err != nil {
+		logWarnf("Ignoring %s: %v", logLevelEnv, err)
+		return
+	}
+	currentLogLevel = level
+}
+
+// logf writes a message through the standard logger when level is enabled.
+// Levels other than info are tagged so they stand out when grepping the log.
+func logf(level logLevel, format string, args ...any) {
+	if level < currentLogLevel {
+		return
+	}
+	prefix := ""
+	switch level {
+	case levelDebug:
+		prefix = "DEBUG "
+	case levelWarn:
+		prefix = "WARN "
+	case levelError:
+		prefix = "ERROR "
+	}
+	log.Output(3, prefix+fmt.Sprintf(format, args...))
+}
+
+// logDebugf logs detail that is only useful while troubleshooting.
+func logDebugf(format string, args ...any) { logf(levelDebug, format, args...) }
+
+// logInfof logs normal operational events.
+func logInfof(format string, args ...any) { logf(levelInfo, format, args...) }
+
+// logWarnf logs problems mowa recovers from or that a client caused.
+func logWarnf(format string, args ...any) { logf(levelWarn, format, args...) }
+
+// logErrorf logs failures that need an operator's attention.
+func logErrorf(format string, args ...any) { logf(levelError, format, args...) }
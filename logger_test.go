@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+// TestParseLogLevel checks level names are case-insensitive and unknown names
+// are rejected.
+func TestParseLogLevel(t *testing.T) {
+	for input, want := range map[string]logLevel{
+		"debug": levelDebug, "INFO": levelInfo, " warn ": levelWarn, "Warning": levelWarn, "error": levelError,
+	} {
+		got, err := parseLogLevel(input)
+		if err != nil || got != want {
+			t.Errorf("parseLogLevel(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("parseLogLevel(verbose): expected an error")
+	}
+}
+
+// TestLogLevelFiltering checks messages below MOWA_LOG_LEVEL are dropped, an
+// invalid level keeps the default, and non-info messages are tagged.
+func TestLogLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	prevOut, prevFlags, prevLevel := log.Writer(), log.Flags(), currentLogLevel
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(prevOut)
+		log.SetFlags(prevFlags)
+		currentLogLevel = prevLevel
+	})
+
+	logAll := func() {
+		logDebugf("d %d", 1)
+		logInfof("i %d", 2)
+		logWarnf("w %d", 3)
+		logErrorf("e %d", 4)
+	}
+
+	t.Setenv(logLevelEnv, "warn")
+	currentLogLevel = levelInfo
+	initLogLevel()
+	logAll()
+	if got, want := buf.String(), "WARN w 3\nERROR e 4\n"; got != want {
+		t.Errorf("warn level logged %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	t.Setenv(logLevelEnv, "loud")
+	currentLogLevel = levelInfo
+	initLogLevel()
+	if currentLogLevel != levelInfo || !strings.Contains(buf.String(), "Ignoring "+logLevelEnv) {
+		t.Errorf("invalid level: level %v, log %q; want info and a warning", currentLogLevel, buf.String())
+	}
+
+	buf.Reset()
+	currentLogLevel = levelDebug
+	logAll()
+	if got, want := buf.String(), "DEBUG d 1\ni 2\nWARN w 3\nERROR e 4\n"; got != want {
+		t.Errorf("debug level logged %q, want %q", got, want)
+	}
+}
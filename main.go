@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"mowa/docs" // This is generated by swag
 
@@ -51,6 +56,9 @@ var (
 // @name Authorization
 
 func main() {
+	// Pick the log level first, so every subcommand honours it.
+	initLogLevel()
+
 	// Subcommand dispatch: `mowa install [flags]` installs mowa as a launchd
 	// login service, `mowa check-updates [flags]` runs the scheduled software
 	// update check; both exit when done. Any other invocation starts the HTTP
@@ -72,7 +80,9 @@ func main() {
 
 	// Parse command line flags
 	var configPath string
+	var selfCheck bool
 	flag.StringVar(&configPath, "config", "", "Path to configuration file (optional)")
+	flag.BoolVar(&selfCheck, "selfcheck", false, "Check the storage directory can be written, read and deleted from at startup, and exit if not")
 	flag.Parse()
 
 	// Load configuration
@@ -82,6 +92,55 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Fail fast on a storage directory that can't be used, if asked to.
+	if (selfCheck || appConfig.Storage.SelfCheck) && appConfig.Features.storageEnabled() {
+		if err := storageSelfCheck(appConfig.Storage.Dir); err != nil {
+			log.Fatalf("Storage self-check failed: %v", err)
+		}
+		logInfof("Storage self-check passed for %s", appConfig.Storage.Dir)
+	}
+
+	// Warn once if this host can't send messages (no osascript).
+	checkMessagingAvailable()
+
+	// Cap the overall send rate, if configured.
+	initMessageThrottle()
+
+	// Load messages that failed to send, so they can still be retried.
+	if err := initDeadLetters(); err != nil {
+		log.Fatalf("Failed to load messages.dead_letter_file: %v", err)
+	}
+
+	// Load the history of sent messages.
+	if err := initSendLog(); err != nil {
+		log.Fatalf("Failed to load messages.send_log_file: %v", err)
+	}
+
+	// Set up encryption at rest before anything touches stored files.
+	if err := initStorageEncryption(); err != nil {
+		log.Fatalf("Invalid storage encryption key: %v", err)
+	}
+
+	// Pick the backend that delivers storage notifications.
+	if err := initStorageNotifier(); err != nil {
+		log.Fatalf("Invalid storage notifier: %v", err)
+	}
+
+	// Load when files saved with a ttl expire.
+	if err := initStorageExpiry(); err != nil {
+		log.Fatalf("Failed to load storage.expiry_file: %v", err)
+	}
+
+	// Count downloads per file, if configured.
+	if err := initStorageDownloads(); err != nil {
+		log.Fatalf("Failed to load storage.downloads_file: %v", err)
+	}
+
+	// Establish current storage usage so the quota can be enforced on writes.
+	if err := initStorageQuota(); err != nil {
+		log.Fatalf("Failed to compute storage usage for the quota: %v", err)
+	}
+
 	// Self-heal the scheduled update-check agent: after an upgrade (e.g. via
 	// POST /api/update) launchd relaunches this server on the new binary, and
 	// this makes sure the agent exists and matches the config without anyone
@@ -90,37 +149,89 @@ func main() {
 		go ensureUpdateCheckAgentAtStartup(configPath)
 	}
 
+	// Cache hot files in memory, if configured.
+	initStorageFileCache()
+
+	// Bound concurrent storage reads, if configured.
+	initStorageReadLimit()
+
+	// Delete files whose ttl has run out.
+	go startExpirySweeper()
+
+	// Alert on a fresh reboot and send periodic heartbeats, if configured.
+	go startHeartbeat()
+
 	// Get port from environment variable or use default 8080
 	port := getPort()
 
-	log.Printf("🚀 Mowa server starting on http://localhost:%d", port)
+	logInfof("🚀 Mowa server starting on http://localhost:%d", port)
 
 	// Create Echo instance
 	e := echo.New()
+	e.HTTPErrorHandler = jsonErrorHandler
+	if debugEnabled() {
+		e.Binder = &debugBinder{}
+		logWarnf("%s is set: bodies of /api requests that fail to bind are logged (redacted)", debugEnv)
+	}
+
+	// Determine the real client IP, honouring X-Forwarded-For only from
+	// configured proxies.
+	ipExtractor, err := newIPExtractor(appConfig.Server)
+	if err != nil {
+		log.Fatalf("Invalid server.trusted_proxies: %v", err)
+	}
+	e.IPExtractor = ipExtractor
 
 	// Custom logger configuration for nicer output
 	loggerConfig := middleware.LoggerConfig{
 		Format:           "${time_rfc3339} | ${status} | ${latency} | ${remote_ip} | ${method} ${uri}\n",
 		CustomTimeFormat: "2006/01/02 15:04:05",
+		Skipper:          accessLogSkipper(appConfig.Log.SkipPaths),
+	}
+
+	// With log.file set, access logs go to that file as JSON lines, rotated
+	// by size, instead of stdout.
+	accessLog, err := openAccessLog(appConfig.Log)
+	if err != nil {
+		log.Fatalf("Failed to open access log: %v", err)
+	}
+	if accessLog != nil {
+		loggerConfig.Format = accessLogFormat
+		loggerConfig.Output = accessLog
+		logInfof("Access logs are written to %s", appConfig.Log.File)
 	}
 
 	// Middleware
+	if headers := appConfig.Server.ResponseHeaders; len(headers.Remove) > 0 || len(headers.Set) > 0 {
+		e.Use(rewriteResponseHeaders(headers))
+	}
+	e.Use(middleware.RequestID())
 	e.Use(middleware.LoggerWithConfig(loggerConfig))
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
-	}))
-
-	// Root endpoint - redirect to Swagger documentation
-	e.GET("/", func(c echo.Context) error {
-		return c.Redirect(http.StatusMovedPermanently, "/swagger/index.html")
-	})
-
-	// Custom Swagger UI with logo
-	e.GET("/swagger/index.html", func(c echo.Context) error {
-		html := `<!DOCTYPE html>
+	e.Use(recoverPanics())
+	if max := appConfig.Server.MaxConcurrentRequests; max > 0 {
+		e.Use(concurrencyLimit(max, skipConcurrencyLimit))
+	}
+	e.Use(decompressRequestBody())
+	cors, err := corsMiddleware(appConfig.Server.CORS)
+	if err != nil {
+		log.Fatalf("Invalid server.cors: %v", err)
+	}
+	e.Use(cors)
+	if keys := appConfig.Auth.APIKeys; len(keys) > 0 {
+		e.Use(identifyAPIKey(keys))
+		logInfof("API key authentication is on with %d keys", len(keys))
+	}
+
+	// Root endpoint - lists the registered routes (as JSON for
+	// Accept: application/json), or redirects to the Swagger UI if enabled
+	e.GET("/", rootHandler(e, appConfig.Swagger.isEnabled(), appConfig.Server.Banner))
+
+	// Swagger UI and the OpenAPI spec (/swagger/doc.json), unless turned off
+	// with swagger.enabled: false
+	if appConfig.Swagger.isEnabled() {
+		// Custom Swagger UI with logo
+		e.GET("/swagger/index.html", func(c echo.Context) error {
+			html := `<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
@@ -229,78 +340,181 @@ func main() {
     </script>
 </body>
 </html>`
-		return c.HTML(http.StatusOK, html)
-	})
-
-	// Serve embedded static assets (logo)
-	e.GET("/assets/mowa-logo.png", func(c echo.Context) error {
-		logoData, err := logoFile.ReadFile("assets/mowa-logo.png")
-		if err != nil {
-			return c.String(http.StatusNotFound, "Logo not found")
+			return c.HTML(http.StatusOK, html)
+		})
+
+		// Serve embedded static assets (logo)
+		e.GET("/assets/mowa-logo.png", func(c echo.Context) error {
+			logoData, err := logoFile.ReadFile("assets/mowa-logo.png")
+			if err != nil {
+				return c.String(http.StatusNotFound, "Logo not found")
+			}
+			return c.Blob(http.StatusOK, "image/png", logoData)
+		})
+
+		// Serve swagger.json from docs package
+		e.GET("/swagger/doc.json", func(c echo.Context) error {
+			swaggerJSON := docs.SwaggerInfo.ReadDoc()
+			return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, []byte(swaggerJSON))
+		})
+
+		// Serve swagger.yaml from docs package
+		e.GET("/swagger/doc.yaml", func(c echo.Context) error {
+			// For YAML, we'll use the echo-swagger handler
+			return echoSwagger.WrapHandler(c)
+		})
+
+		// Swagger documentation (for other swagger assets)
+		e.GET("/swagger/*", echoSwagger.WrapHandler)
+	}
+
+	// API routes
+	registerAPIRoutes(e.Group("/api"), appConfig.Features, appConfig.Auth.APIKeys)
+
+	// Start server, and shut it down gracefully on SIGINT/SIGTERM (launchd
+	// sends SIGTERM when the agent is stopped or upgraded)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	applyServerTimeouts(e.Server, appConfig.Server)
+	e.Server.RegisterOnShutdown(closeStreams)
+	go func() {
+		if err := e.Start(":" + strconv.Itoa(port)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
 		}
-		return c.Blob(http.StatusOK, "image/png", logoData)
-	})
+	}()
+	<-ctx.Done()
+	stop()
+
+	logInfof("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		logErrorf("Failed to finish in-flight requests: %v", err)
+	}
+	storageDownloads.flush()
+	notifyShutdown(shutdownNotifyTimeout)
+}
 
-	// Serve swagger.json from docs package
-	e.GET("/swagger/doc.json", func(c echo.Context) error {
-		swaggerJSON := docs.SwaggerInfo.ReadDoc()
-		return c.String(http.StatusOK, swaggerJSON)
-	})
+// shutdownTimeout bounds how long in-flight requests may take to finish once a
+// shutdown is requested.
+const shutdownTimeout = 10 * time.Second
 
-	// Serve swagger.yaml from docs package
-	e.GET("/swagger/doc.yaml", func(c echo.Context) error {
-		// For YAML, we'll use the echo-swagger handler
-		return echoSwagger.WrapHandler(c)
-	})
+// getPort returns the port from environment variable or default 8080
+func getPort() int {
+	portStr := os.Getenv("MOWA_PORT")
+	if portStr == "" {
+		return 8080
+	}
 
-	// Swagger documentation (for other swagger assets)
-	e.GET("/swagger/*", echoSwagger.WrapHandler)
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		logWarnf("Invalid port %s, using default 8080", portStr)
+		return 8080
+	}
 
-	// API routes
-	api := e.Group("/api")
-	{
+	return port
+}
+
+// registerAPIRoutes registers the /api endpoints on api, leaving out the
+// groups disabled under features. Routes that need an API key require one of
+// keys.
+func registerAPIRoutes(api *echo.Group, features FeaturesConfig, keys []APIKeyConfig) {
+	if features.messagesEnabled() {
 		// Messages endpoint
 		api.POST("/messages", handleSendMessages)
 
-		// Uptime endpoint
-		api.GET("/uptime", handleGetUptime)
+		// The same, streaming each recipient's result as Server-Sent Events
+		api.POST("/messages/stream", handleSendMessagesStream)
+
+		// Recipient validation without sending
+		api.POST("/messages/validate", handleValidateRecipients)
+
+		// Failed sends, and retrying them
+		api.GET("/messages/failed", handleListFailedMessages)
+		api.POST("/messages/retry", handleRetryFailedMessages)
+
+		// History of sends
+		api.GET("/messages/status", handleMessageStatus)
+
+		// Canned message to check the pipeline end to end
+		api.POST("/messages/test", handleTestMessage, requireAPIKey(keys))
+
+		// Messages from external services, verified by signature
+		api.POST("/webhook/message", handleWebhookMessage)
+	}
+
+	// Uptime endpoint
+	api.GET("/uptime", handleGetUptime)
+
+	// Health check, including storage writability
+	api.GET("/health", handleHealth)
 
+	// Prometheus metrics, such as AppleScript run times
+	api.GET("/metrics", handleMetrics)
+
+	if features.storageEnabled() {
 		// Storage endpoint (GET and POST) - supports both JSON payload and URL path
 		api.GET("/storage", handleStorage)
 		api.POST("/storage", handleStorage)
 
-		// Storage endpoint with path in URL (GET only)
-		api.GET("/storage/*", handleStorageWithPath)
+		// Partial (find/replace) edits of existing files
+		api.PATCH("/storage", handleStoragePatch)
 
-		// Self-update endpoint
-		api.POST("/update", handleUpdate)
+		// Lightweight existence check (stat only, never reads content)
+		api.POST("/storage/exists", handleStorageExists)
 
-		// Reminders endpoints - manage macOS Reminders lists and reminders
-		api.GET("/reminders/lists", handleListReminderLists)
-		api.POST("/reminders/lists", handleCreateReminderList)
-		api.DELETE("/reminders/lists/:id", handleDeleteReminderList)
-		api.GET("/reminders/lists/:id/reminders", handleListReminders)
-		api.POST("/reminders", handleCreateReminder)
-		api.PATCH("/reminders/:id", handleUpdateReminder)
-		api.DELETE("/reminders/:id", handleDeleteReminder)
-	}
+		// File metadata: size, modTime, expiry and download count
+		api.POST("/storage/stat", handleStorageStat)
 
-	// Start server
-	log.Fatal(e.Start(":" + strconv.Itoa(port)))
-}
+		// Follow a file's appended content as Server-Sent Events
+		api.GET("/storage/stream", handleStorageStream)
 
-// getPort returns the port from environment variable or default 8080
-func getPort() int {
-	portStr := os.Getenv("MOWA_PORT")
-	if portStr == "" {
-		return 8080
-	}
+		// Total size and file count of the storage directory
+		api.GET("/storage/usage", handleStorageUsage)
 
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		log.Printf("Invalid port %s, using default 8080", portStr)
-		return 8080
+		// Nested tree of a directory's files, e.g. for a file browser
+		api.GET("/storage/tree", handleStorageTree)
+
+		// Create (empty) directories ahead of uploads
+		api.POST("/storage/mkdir", handleStorageMkdir)
+
+		// Empty a file in place (e.g. clear a log) without deleting it
+		api.POST("/storage/truncate", handleStorageTruncate)
+
+		// Create an empty file or bump its modification time, like touch(1)
+		api.POST("/storage/touch", handleStorageTouch)
+
+		// Download a whole directory as a zip archive, or upload one to extract
+		api.POST("/storage/zip", handleStorageZip)
+		api.POST("/storage/unzip", handleStorageUnzip)
+
+		// Read several files in one request
+		api.POST("/storage/batch-read", handleStorageBatchRead)
+
+		// Preview a save as a unified diff against the current file
+		api.POST("/storage/diff", handleStorageDiff)
+
+		// Delete files older than a given age
+		api.POST("/storage/gc", handleStorageGC)
+
+		// Move or rename many files in one request
+		api.POST("/storage/move-batch", handleStorageMoveBatch)
+
+		// Storage endpoint with path in URL. GET, HEAD, PUT and POST are
+		// supported, but every method is routed here so the handler answers
+		// the rest with its own JSON 405 instead of the router's generic one.
+		api.Any("/storage/*", handleStorageWithPath)
 	}
 
-	return port
+	// Self-update endpoint
+	api.POST("/update", handleUpdate)
+
+	// Reminders endpoints - manage macOS Reminders lists and reminders
+	api.GET("/reminders/lists", handleListReminderLists)
+	api.POST("/reminders/lists", handleCreateReminderList)
+	api.DELETE("/reminders/lists/:id", handleDeleteReminderList)
+	api.GET("/reminders/lists/:id/reminders", handleListReminders)
+	api.POST("/reminders", handleCreateReminder)
+	api.PATCH("/reminders/:id", handleUpdateReminder)
+	api.DELETE("/reminders/:id", handleDeleteReminder)
 }
@@ -3,11 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
-	"os/exec"
 	"regexp"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -20,102 +19,613 @@ import (
 // gives up.
 const defaultSendTimeoutSeconds = 7
 
+// defaultMaxRecipients is the messages.max_recipients used when none is
+// configured: generous for real groups, but a stop for an "everyone" group
+// that grew by accident.
+const defaultMaxRecipients = 100
+
 // @Summary Send messages to recipients
-// @Description Send messages to one or more recipients via iMessage
+// @Description Send messages to one or more recipients via iMessage, waiting messages.send_delay between sends. Recipients still waiting when the client disconnects are not messaged.
 // @Tags messages
 // @Accept json
 // @Produce json
 // @Param request body MessageRequest true "Message request"
+// @Param Idempotency-Key header string false "Retry key: a repeat request with the same key returns the original response without re-sending"
 // @Success 200 {object} MessageResponse "Messages sent successfully"
-// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input, or too many recipients after expanding groups"
+// @Failure 422 {object} map[string]interface{} "Idempotency-Key reused for a different request"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/messages [post]
 func handleSendMessages(c echo.Context) error {
+	// Each send is bounded by messages.timeout_seconds, but a request with
+	// many recipients can outlast the server's write timeout.
+	liftWriteDeadline(c)
+
+	send, status, body := prepareMessageSend(c)
+	if send == nil {
+		return c.JSON(status, body)
+	}
+	request, parts, expansion := send.request, send.parts, send.expansion
+	expandedRecipients := expansion.recipients
+
+	// A retried request carrying the same Idempotency-Key gets the original
+	// response back instead of sending the messages a second time.
+	if key := strings.TrimSpace(c.Request().Header.Get(idempotencyKeyHeader)); key != "" {
+		fingerprint := messageFingerprint(request)
+		entry, fresh := messageIdempotency.begin(key, fingerprint)
+		if entry.fingerprint != fingerprint {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+				"error": "Idempotency-Key was already used for a different request",
+			})
+		}
+		if !fresh {
+			select {
+			case <-entry.done:
+			case <-c.Request().Context().Done():
+				return c.Request().Context().Err()
+			}
+			c.Response().Header().Set(idempotencyReplayedHeader, "true")
+			return c.JSON(http.StatusOK, entry.response)
+		}
+
+		started := time.Now()
+		response := expansion.response(sendMessageParts(c.Request().Context(), expandedRecipients, parts, nil))
+		response.DurationSeconds = time.Since(started).Seconds()
+		recordFailedSends(response.Results, parts)
+		recordSend(request.To, request.Message, response.Results)
+		messageIdempotency.finish(entry, response, idempotencyTTL())
+		return c.JSON(http.StatusOK, response)
+	}
+
+	// Send messages to all recipients
+	started := time.Now()
+	results := sendMessageParts(c.Request().Context(), expandedRecipients, parts, nil)
+	recordFailedSends(results, parts)
+	recordSend(request.To, request.Message, results)
+
+	// Return results
+	response := expansion.response(results)
+	response.DurationSeconds = time.Since(started).Seconds()
+	return c.JSON(http.StatusOK, response)
+}
+
+// messageSend is a validated message request, ready to be sent.
+type messageSend struct {
+	request MessageRequest
+	// parts is the message, split into numbered parts when it is too long.
+	parts     []string
+	expansion recipientExpansion
+}
+
+// prepareMessageSend binds and validates a message request: its message or
+// template, length and recipients. When it is rejected, send is nil and
+// status and body are the error response.
+func prepareMessageSend(c echo.Context) (send *messageSend, status int, body map[string]interface{}) {
 	var request MessageRequest
 	if err := c.Bind(&request); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+		return nil, http.StatusBadRequest, map[string]interface{}{
 			"error":   "Invalid request format",
 			"details": err.Error(),
-		})
+		}
 	}
 
 	// Validate required fields
 	if len(request.To) == 0 {
-		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+		return nil, http.StatusBadRequest, map[string]interface{}{
 			"error": "At least one recipient is required",
-		})
+		}
+	}
+
+	if request.Template != "" {
+		if request.Message != "" {
+			return nil, http.StatusBadRequest, map[string]interface{}{
+				"error": "Provide either message or template, not both",
+			}
+		}
+		rendered, err := renderMessageTemplate(request.Template, request.Vars)
+		if err != nil {
+			return nil, http.StatusBadRequest, map[string]interface{}{
+				"error":   "Failed to render message template",
+				"details": err.Error(),
+			}
+		}
+		request.Message = rendered
 	}
 
 	if request.Message == "" {
-		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+		return nil, http.StatusBadRequest, map[string]interface{}{
 			"error": "Message content is required",
+		}
+	}
+
+	// Over-long messages are rejected, or split into numbered parts when the
+	// client opts in, rather than left to be truncated by iMessage.
+	parts := []string{request.Message}
+	if maxLength := maxMessageLength(); maxLength > 0 && messageLength(request.Message) > maxLength {
+		if !request.Split {
+			return nil, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("Message is %d characters, over the limit of %d; set split to send it in parts", messageLength(request.Message), maxLength),
+			}
+		}
+		var err error
+		if parts, err = splitMessage(request.Message, maxLength); err != nil {
+			return nil, http.StatusBadRequest, map[string]interface{}{
+				"error": err.Error(),
+			}
+		}
+	}
+
+	// Expand groups to individual recipients, messaging each one only once
+	expansion := expandRecipients(request.To)
+	expandedRecipients := expansion.recipients
+	if maxRecipients := maxRecipientsPerRequest(); len(expandedRecipients) > maxRecipients {
+		return nil, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("Request expands to %d recipients, over the limit of %d", len(expandedRecipients), maxRecipients),
+		}
+	}
+
+	return &messageSend{request: request, parts: parts, expansion: expansion}, 0, nil
+}
+
+// recipientExpansion is the outcome of expanding a request's recipients: who
+// to message, and how the inputs got there.
+type recipientExpansion struct {
+	// recipients is who to message, each once, in the order first listed.
+	recipients []string
+	// groups maps a recipient to the group it was first listed through.
+	groups map[string]string
+	// duplicates lists recipients listed more than once, directly or
+	// through groups.
+	duplicates []string
+	// invalid lists recipients that fail validation, and groups without
+	// members.
+	invalid []string
+}
+
+// expandRecipients expands the groups in to and drops repeated recipients.
+// Phone numbers are compared without spaces, like messages.allowed_recipients
+// does.
+func expandRecipients(to []string) recipientExpansion {
+	expansion := recipientExpansion{groups: make(map[string]string)}
+	seen := make(map[string]bool)
+	reported := make(map[string]bool)
+	add := func(recipient, group string) {
+		key := normalizeRecipient(recipient)
+		if seen[key] {
+			if !reported[key] {
+				reported[key] = true
+				expansion.duplicates = append(expansion.duplicates, recipient)
+			}
+			return
+		}
+		seen[key] = true
+		expansion.recipients = append(expansion.recipients, recipient)
+		if group != "" {
+			expansion.groups[recipient] = group
+		}
+		if validateRecipient(recipient) != nil {
+			expansion.invalid = append(expansion.invalid, recipient)
+		}
+	}
+
+	for _, entry := range to {
+		members, isGroup := groupMembers(entry)
+		if !isGroup {
+			add(entry, "")
+			continue
+		}
+		logDebugf("Expanded group '%s' to %d recipients", entry, len(members))
+		if len(members) == 0 {
+			expansion.invalid = append(expansion.invalid, entry)
+		}
+		for _, member := range members {
+			add(member, entry)
+		}
+	}
+	return expansion
+}
+
+// response builds the MessageResponse for results, tagging each with the
+// group its recipient came from and reporting duplicate and invalid inputs.
+func (e recipientExpansion) response(results []MessageResult) MessageResponse {
+	for i := range results {
+		results[i].ExpandedFrom = e.groups[results[i].Recipient]
+	}
+	return MessageResponse{
+		Results:    results,
+		Duplicates: e.duplicates,
+		Invalid:    e.invalid,
+	}
+}
+
+// parseMessageTemplate parses a messages.templates entry. Placeholders use Go
+// text/template syntax ({{.name}}); referencing a var the request doesn't
+// supply is an error rather than silently rendering "<no value>".
+func parseMessageTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+// renderMessageTemplate renders the named messages.templates entry with vars.
+func renderMessageTemplate(name string, vars map[string]string) (string, error) {
+	if appConfig == nil {
+		return "", fmt.Errorf("unknown template %q", name)
+	}
+	text, ok := appConfig.Messages.Templates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown template %q", name)
+	}
+
+	tmpl, err := parseMessageTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// testMessage is what POST /api/messages/test sends.
+const testMessage = "Mowa test message"
+
+// @Summary Send a test message
+// @Description Send the canned "Mowa test message" to check the whole pipeline, AppleScript included, works, e.g. after changing the Messages setup. It goes to the recipient in the body, or else to messages.test_recipient. Test sends are not added to the history of sends or the failed messages. Once auth.api_keys is set, it requires an API key.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body TestMessageRequest false "Recipient (optional)"
+// @Success 200 {object} MessageResponse "Test message sent, or the reason it failed"
+// @Failure 400 {object} map[string]interface{} "Bad request - no recipient"
+// @Failure 401 {object} map[string]interface{} "Missing or invalid API key"
+// @Router /api/messages/test [post]
+func handleTestMessage(c echo.Context) error {
+	var request TestMessageRequest
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error":   "Invalid request format",
+				"details": err.Error(),
+			})
+		}
+	}
+
+	recipient := strings.TrimSpace(request.To)
+	if recipient == "" {
+		recipient = strings.TrimSpace(appConfig.Messages.TestRecipient)
+	}
+	if recipient == "" {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "No recipient; pass to or configure messages.test_recipient",
 		})
 	}
 
-	// Expand groups to individual recipients
-	expandedRecipients := expandGroups(request.To)
+	started := time.Now()
+	results := sendMessages([]string{recipient}, testMessage)
+	if !results[0].Success {
+		logWarnf("Test message to %s failed: %s", recipient, *results[0].Error)
+	}
+	return c.JSON(http.StatusOK, MessageResponse{Results: results, DurationSeconds: time.Since(started).Seconds()})
+}
 
-	// Send messages to all recipients
-	results := sendMessages(expandedRecipients, request.Message)
+// @Summary Validate recipients
+// @Description Check phone numbers, group names and group chats the way POST /api/messages would, expanding groups, without sending anything. Works even where the Messages app is unavailable.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param request body ValidateRecipientsRequest true "Recipients to validate"
+// @Success 200 {object} ValidateRecipientsResponse "Validation results"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Router /api/messages/validate [post]
+func handleValidateRecipients(c echo.Context) error {
+	var request ValidateRecipientsRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Invalid request format",
+			"details": err.Error(),
+		})
+	}
 
-	// Return results
-	return c.JSON(http.StatusOK, MessageResponse{Results: results})
+	if len(request.To) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "At least one recipient is required",
+		})
+	}
+
+	return c.JSON(http.StatusOK, validateRecipients(request.To))
+}
+
+// validateRecipients expands groups and validates every resulting recipient.
+func validateRecipients(to []string) ValidateRecipientsResponse {
+	response := ValidateRecipientsResponse{Valid: true, Results: []RecipientValidation{}}
+	for _, entry := range to {
+		group := ""
+		members := []string{entry}
+		if expanded, ok := groupMembers(entry); ok {
+			group, members = entry, expanded
+		}
+
+		if group != "" && len(members) == 0 {
+			response.Valid = false
+			response.Results = append(response.Results, RecipientValidation{
+				Recipient: entry,
+				Group:     group,
+				Error:     "group has no members",
+			})
+			continue
+		}
+
+		for _, member := range members {
+			result := RecipientValidation{Recipient: member, Group: group, Valid: true}
+			if err := validateRecipient(member); err != nil {
+				result.Valid = false
+				result.Error = err.Error()
+				response.Valid = false
+			}
+			response.Results = append(response.Results, result)
+		}
+	}
+	return response
+}
+
+// sendMessageParts sends the parts of a split message to every recipient in
+// order, tagging each result with its part number. A message that wasn't split
+// is sent exactly like sendMessages. Sends are spaced out by
+// messages.send_delay, and those left when ctx is done are not made. A
+// non-nil onResult is called with each result as soon as it is known.
+func sendMessageParts(ctx context.Context, recipients []string, parts []string, onResult func(MessageResult)) []MessageResult {
+	pacer := newMessagePacer(ctx)
+	pacer.onResult = onResult
+	if len(parts) == 1 {
+		return pacer.send(recipients, parts[0], 0)
+	}
+
+	var results []MessageResult
+	for i, part := range parts {
+		results = append(results, pacer.send(recipients, part, i+1)...)
+	}
+	return results
 }
 
 // sendMessages sends messages to multiple recipients
 func sendMessages(recipients []string, message string) []MessageResult {
-	var results []MessageResult
+	return newMessagePacer(context.Background()).send(recipients, message, 0)
+}
+
+// messagePacer waits messages.send_delay between consecutive sends, so a
+// batch doesn't look like spam to Apple, until its context is done.
+type messagePacer struct {
+	ctx   context.Context
+	delay time.Duration
+	// sent is set once a send was made, as the first needs no wait.
+	sent bool
+	// onResult, if set, is called with each result as it is known.
+	onResult func(MessageResult)
+	// interrupt, if set, kills a send still running once ctx is done.
+	// Otherwise it is left to finish, since a killed osascript may or may
+	// not have sent the message.
+	interrupt bool
+}
+
+func newMessagePacer(ctx context.Context) *messagePacer {
+	pacer := &messagePacer{ctx: ctx}
+	if appConfig != nil {
+		pacer.delay = appConfig.Messages.SendDelay
+	}
+	return pacer
+}
 
+// wait blocks until the next send may be made, or returns the context's
+// error once it is done.
+func (p *messagePacer) wait() error {
+	if p.sent && p.delay > 0 {
+		timer := time.NewTimer(p.delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-p.ctx.Done():
+		}
+	}
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	p.sent = true
+	return nil
+}
+
+// send sends message to each of recipients in turn, tagging the results
+// with part (0 for a message that wasn't split).
+func (p *messagePacer) send(recipients []string, message string, part int) []MessageResult {
+	var results []MessageResult
 	for _, recipient := range recipients {
-		result := MessageResult{
-			Recipient: recipient,
-			Success:   false,
+		result := p.sendOne(recipient, message)
+		result.Part = part
+		if p.onResult != nil {
+			p.onResult(result)
 		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// sendOne sends message to a single recipient.
+func (p *messagePacer) sendOne(recipient, message string) MessageResult {
+	result := MessageResult{
+		Recipient: recipient,
+		Success:   false,
+	}
 
-		// Validate phone number
-		if err := validatePhoneNumber(recipient); err != nil {
-			errorMsg := err.Error()
+	// Without osascript nothing can be sent (other than email); say so
+	// plainly
+	if !messagingAvailable && !isEmailRecipient(recipient) {
+		errorMsg := errMessagingUnavailable.Error()
+		result.Error = &errorMsg
+		return result
+	}
+
+	// Validate phone number (or group chat name)
+	if err := validateRecipient(recipient); err != nil {
+		errorMsg := err.Error()
+		result.Error = &errorMsg
+		return result
+	}
+
+	if err := p.wait(); err != nil {
+		errorMsg := "not sent: " + err.Error()
+		result.Error = &errorMsg
+		return result
+	}
+	// Email doesn't go through the iMessage account the throttle protects.
+	if messageThrottle != nil && !isEmailRecipient(recipient) {
+		queue := appConfig == nil || appConfig.Messages.RateLimitAction != rateLimitReject
+		if err := messageThrottle.take(p.ctx, queue); err != nil {
+			errorMsg := "not sent: " + err.Error()
 			result.Error = &errorMsg
-			results = append(results, result)
-			continue
+			return result
 		}
+	}
 
-		// Send the message
-		if err := sendMessage(recipient, message); err != nil {
-			errorMsg := err.Error()
-			result.Error = &errorMsg
-		} else {
-			result.Success = true
+	// Send the message
+	sendCtx := context.Background()
+	if p.interrupt {
+		sendCtx = p.ctx
+	}
+	if err := sendMessage(sendCtx, recipient, message); err != nil {
+		errorMsg := err.Error()
+		result.Error = &errorMsg
+	} else {
+		result.Success = true
+	}
+	return result
+}
+
+// chatRecipientPrefix marks a recipient as an existing group chat, addressed
+// by its display name ("chat:My Family") instead of a buddy's number.
+const chatRecipientPrefix = "chat:"
+
+// chatName returns the group chat name of a "chat:" recipient.
+func chatName(recipient string) (string, bool) {
+	name, ok := strings.CutPrefix(recipient, chatRecipientPrefix)
+	return strings.TrimSpace(name), ok
+}
+
+// validateRecipient checks a single expanded recipient: a group chat only
+// needs a name, an email address needs email configured, anything else must be
+// a valid phone number. Either way it must be allowed by
+// messages.allowed_recipients.
+func validateRecipient(recipient string) error {
+	if name, ok := chatName(recipient); ok {
+		if name == "" {
+			return fmt.Errorf("chat name is required after %q", chatRecipientPrefix)
+		}
+	} else if isEmailRecipient(recipient) {
+		if err := validateEmailRecipient(recipient); err != nil {
+			return err
 		}
+	} else if err := validatePhoneNumber(recipient); err != nil {
+		return err
+	}
 
-		results = append(results, result)
+	if !recipientAllowed(recipient) {
+		return fmt.Errorf("recipient is not in messages.allowed_recipients")
 	}
+	return nil
+}
 
-	return results
+// recipientAllowed reports whether messages.allowed_recipients permits
+// messaging recipient, expanding any groups it lists. Phone numbers are
+// compared without spaces. An empty list allows everyone.
+func recipientAllowed(recipient string) bool {
+	if appConfig == nil || len(appConfig.Messages.AllowedRecipients) == 0 {
+		return true
+	}
+	for _, entry := range appConfig.Messages.AllowedRecipients {
+		members, isGroup := groupMembers(entry)
+		if !isGroup {
+			members = []string{entry}
+		}
+		for _, allowed := range members {
+			if normalizeRecipient(allowed) == normalizeRecipient(recipient) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
+// normalizeRecipient returns the form recipients are compared in: phone
+// numbers without spaces, group chats as given.
+func normalizeRecipient(recipient string) string {
+	if _, ok := chatName(recipient); ok {
+		return recipient
+	}
+	return strings.ReplaceAll(recipient, " ", "")
+}
+
+// sendMessageScript and sendChatScript read the recipient (or chat name) and
+// the message from argv instead of having them spliced into the source, so no
+// value needs escaping and none can change what the script does. The only
+// placeholder is the integer `with timeout` value.
+const sendMessageScript = `
+on run argv
+    set targetRecipient to item 1 of argv
+    set targetMessage to item 2 of argv
+    with timeout of %d seconds
+        tell application "Messages"
+            set targetService to 1st service whose service type = iMessage
+            set myBuddy to buddy targetRecipient of targetService
+            send targetMessage to myBuddy
+        end tell
+    end timeout
+end run
+`
+
+const sendChatScript = `
+on run argv
+    set targetChat to item 1 of argv
+    set targetMessage to item 2 of argv
+    with timeout of %d seconds
+        tell application "Messages"
+            send targetMessage to chat targetChat
+        end tell
+    end timeout
+end run
+`
+
 // sendMessage sends a single message to one recipient
-func sendMessage(recipient, message string) error {
-	// Escape the message content for AppleScript
-	escapedMessage := strings.ReplaceAll(message, "\"", "\\\"")
+func sendMessage(ctx context.Context, recipient, message string) error {
+	if isEmailRecipient(recipient) {
+		return sendEmail(recipient, message)
+	}
 
 	timeout := sendTimeout()
 
-	// Create AppleScript to send message via Messages app. The `with timeout`
-	// block makes the AppleEvent surface a clean error faster than its ~120s
-	// default; executeAppleScript enforces a hard deadline as a backstop.
-	script := fmt.Sprintf(`
-with timeout of %d seconds
-    tell application "Messages"
-        set targetService to 1st service whose service type = iMessage
-        set myBuddy to buddy "%s" of targetService
-        send "%s" to myBuddy
-    end tell
-end timeout
-`, int(timeout.Seconds()), recipient, escapedMessage)
+	// A group chat is sent to directly; Messages fails the script if no chat
+	// has that name.
+	if name, ok := chatName(recipient); ok {
+		script := fmt.Sprintf(sendChatScript, int(timeout.Seconds()))
+		return executeAppleScript(ctx, script, timeout, name, message)
+	}
 
-	// Execute the AppleScript
-	return executeAppleScript(script, timeout)
+	// The `with timeout` block makes the AppleEvent surface a clean error
+	// faster than its ~120s default; executeAppleScript enforces a hard
+	// deadline as a backstop.
+	script := fmt.Sprintf(sendMessageScript, int(timeout.Seconds()))
+	return executeAppleScript(ctx, script, timeout, recipient, message)
+}
+
+// maxRecipientsPerRequest returns the configured recipient limit, falling back
+// to the default when no config has been loaded or the value is invalid.
+func maxRecipientsPerRequest() int {
+	if appConfig != nil && appConfig.Messages.MaxRecipients > 0 {
+		return appConfig.Messages.MaxRecipients
+	}
+	return defaultMaxRecipients
 }
 
 // sendTimeout returns the configured osascript send timeout, falling back to
@@ -128,19 +638,21 @@ func sendTimeout() time.Duration {
 }
 
 // runOSAScript invokes osascript with the given arguments under a bounded
-// deadline, killing the process on timeout so no orphaned osascript lingers.
-// It returns the combined output, whether the deadline was exceeded, and any
-// exec error. This is the shared low-level runner used by both the Messages
-// AppleScript path (executeAppleScript) and the Reminders JXA path.
-func runOSAScript(timeout time.Duration, args ...string) (output []byte, timedOut bool, err error) {
+// deadline, killing the process on timeout, or once parent is done, so no
+// orphaned osascript lingers. It returns the standard output, whether the
+// deadline was exceeded, and any exec error, which carries what osascript
+// wrote to stderr. This is the shared low-level runner used by both the
+// Messages AppleScript path (executeAppleScript) and the Reminders JXA path.
+func runOSAScript(parent context.Context, timeout time.Duration, args ...string) (output []byte, timedOut bool, err error) {
 	// Give the process a small grace period beyond any in-script `with timeout`
 	// so its cleaner error can surface before the hard kill.
-	ctx, cancel := context.WithTimeout(context.Background(), timeout+2*time.Second)
+	ctx, cancel := context.WithTimeout(parent, timeout+2*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "osascript", args...)
-
-	output, err = cmd.CombinedOutput()
+	output, err = runCommand(ctx, "osascript", args...)
+	if err := parent.Err(); err != nil {
+		return output, false, fmt.Errorf("osascript stopped: %w", err)
+	}
 	if ctx.Err() == context.DeadlineExceeded {
 		return output, true, fmt.Errorf("osascript timed out after %s", timeout)
 	}
@@ -148,22 +660,36 @@ func runOSAScript(timeout time.Duration, args ...string) (output []byte, timedOu
 }
 
 // executeAppleScript executes an AppleScript with a bounded deadline and returns
-// any error. The process is killed on timeout so no orphaned osascript lingers.
-func executeAppleScript(script string, timeout time.Duration) error {
-	output, timedOut, err := runOSAScript(timeout, "-e", script)
+// any error. The process is killed on timeout, or once ctx is done, so no
+// orphaned osascript lingers.
+// Any argv values are passed to the script's `on run argv` handler after "--",
+// so a value starting with "-" is never taken for an osascript option.
+func executeAppleScript(ctx context.Context, script string, timeout time.Duration, argv ...string) error {
+	args := []string{"-e", script}
+	if len(argv) > 0 {
+		args = append(append(args, "--"), argv...)
+	}
+	started := time.Now()
+	output, timedOut, err := runOSAScript(ctx, timeout, args...)
+	elapsed := time.Since(started)
+	appleScriptDurations.observe(elapsed)
+	logDebugf("AppleScript took %s", elapsed)
 	if timedOut {
-		log.Printf("AppleScript timed out after %s; killed osascript", timeout)
+		logWarnf("AppleScript timed out after %s; killed osascript", timeout)
+		return err
+	}
+	if ctx.Err() != nil {
+		logWarnf("AppleScript abandoned: %v", err)
 		return err
 	}
 	if err != nil {
-		log.Printf("AppleScript failed with error: %v", err)
-		log.Printf("AppleScript output: %s", string(output))
-		log.Printf("Failed script: %s", script)
-		return fmt.Errorf("AppleScript error: %s", string(output))
+		logWarnf("AppleScript failed with error: %v", err)
+		logDebugf("Failed script: %s", script)
+		return fmt.Errorf("AppleScript error: %s", commandFailure(err))
 	}
 
 	if len(output) > 0 {
-		log.Printf("AppleScript output: %s", string(output))
+		logDebugf("AppleScript output: %s", string(output))
 	}
 
 	return nil
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/labstack/echo/v4"
 )
 
 // TestExecuteAppleScriptSuccess verifies a trivial script returns quickly with no error.
 func TestExecuteAppleScriptSuccess(t *testing.T) {
 	start := time.Now()
-	if err := executeAppleScript(`return "ok"`, 15*time.Second); err != nil {
+	if err := executeAppleScript(context.Background(), `return "ok"`, 15*time.Second); err != nil {
 		t.Fatalf("expected success, got error: %v", err)
 	}
 	if elapsed := time.Since(start); elapsed > time.Second {
@@ -21,7 +28,7 @@ func TestExecuteAppleScriptSuccess(t *testing.T) {
 // confirms the call fails fast with a timeout error instead of blocking.
 func TestExecuteAppleScriptTimeout(t *testing.T) {
 	start := time.Now()
-	err := executeAppleScript(`delay 30`, 1*time.Second)
+	err := executeAppleScript(context.Background(), `delay 30`, 1*time.Second)
 	elapsed := time.Since(start)
 
 	if err == nil {
@@ -35,3 +42,478 @@ func TestExecuteAppleScriptTimeout(t *testing.T) {
 		t.Errorf("timeout took %s, expected it to fail fast (~3s)", elapsed)
 	}
 }
+
+// TestRenderMessageTemplate covers rendering a configured template and the
+// errors for unknown templates and missing vars.
+func TestRenderMessageTemplate(t *testing.T) {
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+	appConfig = defaultConfig()
+	appConfig.Messages.Templates = map[string]string{
+		"disk": "Disk on {{.host}} is {{.percent}}% full",
+	}
+
+	got, err := renderMessageTemplate("disk", map[string]string{"host": "macmini", "percent": "93"})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if want := "Disk on macmini is 93% full"; got != want {
+		t.Errorf("render = %q, want %q", got, want)
+	}
+
+	if _, err := renderMessageTemplate("nope", nil); err == nil || !strings.Contains(err.Error(), "unknown template") {
+		t.Errorf("unknown template: err = %v", err)
+	}
+	if _, err := renderMessageTemplate("disk", map[string]string{"host": "macmini"}); err == nil {
+		t.Error("missing var: expected an error, got nil")
+	}
+}
+
+// fakeOSAScript replaces runCommand for the duration of the test. Each call is
+// recorded (the AppleScript source followed by its argv, one per line) and
+// answered by respond.
+func fakeOSAScript(t *testing.T, respond func(script string) ([]byte, error)) *[]string {
+	t.Helper()
+	var scripts []string
+	prev := runCommand
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != "osascript" {
+			t.Fatalf("unexpected command %q", name)
+		}
+		script := strings.Join(args[1:], "\n")
+		scripts = append(scripts, script)
+		return respond(script)
+	}
+	t.Cleanup(func() { runCommand = prev })
+	return &scripts
+}
+
+// TestSendMessages checks per-recipient results against a fake osascript:
+// invalid numbers are rejected before anything runs, and a failing send is
+// reported with osascript's error output.
+func TestSendMessages(t *testing.T) {
+	scripts := fakeOSAScript(t, func(script string) ([]byte, error) {
+		if strings.Contains(script, "+15550000002") {
+			return nil, errors.New("exit status 1: buddy not found")
+		}
+		return nil, nil
+	})
+
+	results := sendMessages([]string{"+15550000001", "+15550000002", "5550000003", "+1555"}, `say "hi"`)
+
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4", len(results))
+	}
+	if !results[0].Success {
+		t.Errorf("first recipient: %+v, want success", results[0])
+	}
+	if results[1].Success || results[1].Error == nil || !strings.Contains(*results[1].Error, "buddy not found") {
+		t.Errorf("second recipient: %+v, want osascript failure", results[1])
+	}
+	if results[2].Success || !strings.Contains(*results[2].Error, "must start with +") {
+		t.Errorf("third recipient: %+v, want missing + error", results[2])
+	}
+	if results[3].Success || !strings.Contains(*results[3].Error, "at least 10 digits") {
+		t.Errorf("fourth recipient: %+v, want too short error", results[3])
+	}
+
+	if len(*scripts) != 2 {
+		t.Fatalf("osascript ran %d times, want 2 (invalid numbers must not be sent)", len(*scripts))
+	}
+	if !strings.HasSuffix((*scripts)[0], "\n+15550000001\nsay \"hi\"") {
+		t.Errorf("recipient and message not passed as argv:\n%s", (*scripts)[0])
+	}
+}
+
+// TestSendMessageArgv checks recipients and messages reach osascript verbatim
+// as argv after "--", never inside the script source, whatever they contain.
+func TestSendMessageArgv(t *testing.T) {
+	var calls [][]string
+	prev := runCommand
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		return nil, nil
+	}
+	t.Cleanup(func() { runCommand = prev })
+
+	tricky := []string{
+		`say "hi"`,
+		`back\slash \" end`,
+		"\" & (do shell script \"rm -rf ~\") & \"",
+		"line one\nline two\r\ttabbed",
+		"-e bad",
+		"--",
+		"ünïcödé 🎉 'single' `tick` $HOME %d %s",
+		"end tell\nend run",
+	}
+	for _, message := range tricky {
+		for _, recipient := range []string{"+15550000001", `chat:-The "Smiths" \ "`} {
+			calls = nil
+			if err := sendMessage(context.Background(), recipient, message); err != nil {
+				t.Fatalf("sendMessage(%q, %q): %v", recipient, message, err)
+			}
+			if len(calls) != 1 {
+				t.Fatalf("osascript ran %d times, want 1", len(calls))
+			}
+			args := calls[0]
+			want := strings.TrimPrefix(recipient, chatRecipientPrefix)
+			if len(args) != 5 || args[0] != "-e" || args[2] != "--" || args[3] != want || args[4] != message {
+				t.Fatalf("args = %q, want [-e <script> -- %q %q]", args, want, message)
+			}
+			if !strings.Contains(args[1], "on run argv") {
+				t.Errorf("script does not read argv:\n%s", args[1])
+			}
+			if strings.Contains(args[1], message) {
+				t.Errorf("message %q leaked into the script source", message)
+			}
+		}
+	}
+}
+
+// TestSendMessagesToChat checks a "chat:" recipient skips phone validation and
+// is sent to the named group chat rather than a buddy.
+func TestSendMessagesToChat(t *testing.T) {
+	scripts := fakeOSAScript(t, func(script string) ([]byte, error) { return nil, nil })
+
+	results := sendMessages([]string{`chat:The "Smiths"`, "chat:  "}, "hi")
+	if !results[0].Success {
+		t.Errorf("chat recipient: %+v, want success", results[0])
+	}
+	if results[1].Success || results[1].Error == nil || !strings.Contains(*results[1].Error, "chat name is required") {
+		t.Errorf("empty chat name: %+v, want a validation error", results[1])
+	}
+
+	if len(*scripts) != 1 {
+		t.Fatalf("osascript ran %d times, want 1", len(*scripts))
+	}
+	if !strings.Contains((*scripts)[0], "to chat targetChat") || !strings.HasSuffix((*scripts)[0], "\nThe \"Smiths\"\nhi") {
+		t.Errorf("unexpected chat script:\n%s", (*scripts)[0])
+	}
+	if strings.Contains((*scripts)[0], "buddy") {
+		t.Errorf("chat must not be resolved as a buddy:\n%s", (*scripts)[0])
+	}
+
+	if resp := validateRecipients([]string{"chat:Family"}); !resp.Valid {
+		t.Errorf("validate chat: %+v, want valid", resp)
+	}
+}
+
+// TestSendMessagesMaxRecipients checks the recipient limit applies after
+// groups are expanded, and that nothing is sent when it is exceeded.
+func TestSendMessagesMaxRecipients(t *testing.T) {
+	prev := appConfig
+	appConfig = defaultConfig()
+	appConfig.Messages.MaxRecipients = 2
+	appConfig.Messages.Groups = map[string][]string{"everyone": {"+15550000001", "+15550000002", "+15550000003"}}
+	t.Cleanup(func() { appConfig = prev })
+
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(`{"to":["everyone"],"message":"hi"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if err := handleSendMessages(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "3 recipients, over the limit of 2") {
+		t.Errorf("got %d %s, want 400 over the limit", rec.Code, rec.Body)
+	}
+	if len(*scripts) != 0 {
+		t.Errorf("osascript ran %d times, want none", len(*scripts))
+	}
+}
+
+// TestSendMessagesAllowedRecipients checks only listed numbers, chats and
+// members of listed groups can be messaged once an allowlist is configured.
+func TestSendMessagesAllowedRecipients(t *testing.T) {
+	prev := appConfig
+	appConfig = defaultConfig()
+	appConfig.Messages.Groups = map[string][]string{"family": {"+15550000002"}}
+	appConfig.Messages.AllowedRecipients = []string{"+1 555 000 0001", "family", "chat:Family"}
+	t.Cleanup(func() { appConfig = prev })
+
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	results := sendMessages([]string{"+15550000001", "+15550000002", "chat:Family", "+15559999999", "chat:Work"}, "hi")
+	for i, want := range []bool{true, true, true, false, false} {
+		if results[i].Success != want {
+			t.Errorf("%s: success = %v, want %v (%v)", results[i].Recipient, results[i].Success, want, results[i].Error)
+		}
+	}
+	if err := results[3].Error; err == nil || !strings.Contains(*err, "allowed_recipients") {
+		t.Errorf("disallowed recipient error = %v", err)
+	}
+	if len(*scripts) != 3 {
+		t.Errorf("osascript ran %d times, want 3", len(*scripts))
+	}
+
+	if resp := validateRecipients([]string{"+15559999999"}); resp.Valid {
+		t.Errorf("validate: %+v, want the disallowed number rejected", resp)
+	}
+}
+
+// TestSendMessagesTimeout simulates a wedged Messages app and checks the
+// osascript process is abandoned after messages.timeout_seconds, with the
+// timeout reported in that recipient's result.
+func TestSendMessagesTimeout(t *testing.T) {
+	prev := appConfig
+	appConfig = defaultConfig()
+	appConfig.Messages.TimeoutSeconds = 1
+	t.Cleanup(func() { appConfig = prev })
+
+	prevRun := runCommand
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	t.Cleanup(func() { runCommand = prevRun })
+
+	results := sendMessages([]string{"+15550000001"}, "hi")
+	if len(results) != 1 || results[0].Success {
+		t.Fatalf("results = %+v, want one failure", results)
+	}
+	if results[0].Error == nil || !strings.Contains(*results[0].Error, "timed out") {
+		t.Errorf("error = %v, want a timeout", results[0].Error)
+	}
+}
+
+// TestSendMessagesExpandsGroups sends to a group through the API handler and
+// checks every member is messaged once.
+func TestSendMessagesExpandsGroups(t *testing.T) {
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+	appConfig = defaultConfig()
+	appConfig.Messages.Groups = map[string][]string{"family": {"+15550000001", "+15550000002"}}
+
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(`{"to":["family","+15550000003"],"message":"dinner"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if err := handleSendMessages(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp MessageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	var got []string
+	for _, r := range resp.Results {
+		if !r.Success {
+			t.Errorf("%s failed: %v", r.Recipient, *r.Error)
+		}
+		got = append(got, r.Recipient)
+	}
+	if want := "+15550000001,+15550000002,+15550000003"; strings.Join(got, ",") != want {
+		t.Errorf("recipients = %v, want %s", got, want)
+	}
+	if len(*scripts) != 3 {
+		t.Errorf("osascript ran %d times, want 3", len(*scripts))
+	}
+}
+
+// TestSendMessagesDeduplicates checks a recipient listed directly and through
+// groups is messaged once, and that the response reports where recipients came
+// from, which were repeated and which are invalid.
+func TestSendMessagesDeduplicates(t *testing.T) {
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+	appConfig = defaultConfig()
+	appConfig.Messages.Groups = map[string][]string{
+		"family": {"+15550000001", "+15550000002"},
+		"work":   {"+1 555 000 0002", "+1555"},
+		"empty":  {},
+	}
+
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(`{"to":["family","work","+15550000001","empty"],"message":"hi"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if err := handleSendMessages(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp MessageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	var got []string
+	for _, r := range resp.Results {
+		got = append(got, r.Recipient+"<"+r.ExpandedFrom)
+	}
+	if want := "+15550000001<family,+15550000002<family,+1555<work"; strings.Join(got, ",") != want {
+		t.Errorf("results = %v, want %s", got, want)
+	}
+	if want := "+1 555 000 0002,+15550000001"; strings.Join(resp.Duplicates, ",") != want {
+		t.Errorf("duplicates = %v, want %s", resp.Duplicates, want)
+	}
+	if want := "+1555,empty"; strings.Join(resp.Invalid, ",") != want {
+		t.Errorf("invalid = %v, want %s", resp.Invalid, want)
+	}
+	if len(*scripts) != 2 {
+		t.Errorf("osascript ran %d times, want 2", len(*scripts))
+	}
+}
+
+// TestSendMessagesValidation covers request-level validation in the handler.
+func TestSendMessagesValidation(t *testing.T) {
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+	appConfig = defaultConfig()
+
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	for _, body := range []string{
+		`{"to":[],"message":"hi"}`,
+		`{"to":["+15550000001"]}`,
+		`not json`,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if err := handleSendMessages(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, rec.Code)
+		}
+	}
+	if len(*scripts) != 0 {
+		t.Errorf("osascript ran %d times for invalid requests, want 0", len(*scripts))
+	}
+}
+
+// TestSendMessagesWithoutOSAScript checks every recipient gets a clear error,
+// and nothing is executed, when osascript is unavailable.
+func TestSendMessagesWithoutOSAScript(t *testing.T) {
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+	messagingAvailable = false
+	t.Cleanup(func() { messagingAvailable = true })
+
+	results := sendMessages([]string{"+15550000001", "+15550000002"}, "hi")
+	for _, r := range results {
+		if r.Success || r.Error == nil || *r.Error != errMessagingUnavailable.Error() {
+			t.Errorf("%s: %+v, want messaging unavailable error", r.Recipient, r)
+		}
+	}
+	if len(results) != 2 || len(*scripts) != 0 {
+		t.Errorf("got %d results and %d osascript runs, want 2 and 0", len(results), len(*scripts))
+	}
+}
+
+// TestSendMessagesDelay checks messages.send_delay spaces out actual sends,
+// and that recipients still waiting when the context is done are skipped.
+func TestSendMessagesDelay(t *testing.T) {
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+	appConfig = defaultConfig()
+	appConfig.Messages.SendDelay = 30 * time.Millisecond
+
+	fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+	start := time.Now()
+	results := sendMessageParts(context.Background(), []string{"+15550000001", "+1555", "+15550000002", "+15550000003"}, []string{"hi"}, nil)
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("3 sends took %v, want at least 2 delays of 30ms", elapsed)
+	}
+	if len(results) != 4 || !results[0].Success || results[1].Success || !results[3].Success {
+		t.Errorf("results = %+v, want the invalid recipient alone to fail", results)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) {
+		cancel()
+		return nil, nil
+	})
+	results = sendMessageParts(ctx, []string{"+15550000001", "+15550000002", "+15550000003"}, []string{"hi"}, nil)
+	if len(*scripts) != 1 || !results[0].Success {
+		t.Fatalf("osascript ran %d times (first result %+v), want just the first send", len(*scripts), results[0])
+	}
+	for _, r := range results[1:] {
+		if r.Success || r.Error == nil || !strings.HasPrefix(*r.Error, "not sent:") {
+			t.Errorf("%s: %+v, want not sent", r.Recipient, r)
+		}
+	}
+}
+
+func TestValidateRecipients(t *testing.T) {
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+	appConfig = defaultConfig()
+	appConfig.Messages.Groups = map[string][]string{
+		"family": {"+15550000001", "not-a-number"},
+		"empty":  {},
+	}
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	resp := validateRecipients([]string{"family", "+15550000002", "+1555", "empty"})
+	if resp.Valid {
+		t.Error("expected the list to be invalid overall")
+	}
+
+	want := []RecipientValidation{
+		{Recipient: "+15550000001", Group: "family", Valid: true},
+		{Recipient: "not-a-number", Group: "family", Error: "phone number must start with +"},
+		{Recipient: "+15550000002", Valid: true},
+		{Recipient: "+1555", Error: "phone number must be at least 10 digits"},
+		{Recipient: "empty", Group: "empty", Error: "group has no members"},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("got %d results, want %d: %+v", len(resp.Results), len(want), resp.Results)
+	}
+	for i, w := range want {
+		if resp.Results[i] != w {
+			t.Errorf("result %d = %+v, want %+v", i, resp.Results[i], w)
+		}
+	}
+
+	if ok := validateRecipients([]string{"+15550000001"}); !ok.Valid {
+		t.Errorf("valid list reported invalid: %+v", ok)
+	}
+	if len(*scripts) != 0 {
+		t.Errorf("validation ran osascript %d times", len(*scripts))
+	}
+}
+
+// TestHandleTestMessage checks the test message goes to the requested
+// recipient, or else messages.test_recipient.
+func TestHandleTestMessage(t *testing.T) {
+	prev := appConfig
+	appConfig = defaultConfig()
+	t.Cleanup(func() { appConfig = prev })
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/messages/test", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		if err := handleTestMessage(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	if rec := post(""); rec.Code != http.StatusBadRequest {
+		t.Errorf("no recipient: status = %d, want 400", rec.Code)
+	}
+	if len(*scripts) != 0 {
+		t.Fatalf("osascript ran %d times, want none", len(*scripts))
+	}
+
+	appConfig.Messages.TestRecipient = "+15550000001"
+	for body, want := range map[string]string{
+		"":                      "+15550000001",
+		`{"to":"+15550000002"}`: "+15550000002",
+	} {
+		rec := post(body)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"recipient":"`+want+`","success":true`) {
+			t.Errorf("body %q: got %d %s, want a successful send to %s", body, rec.Code, rec.Body, want)
+		}
+	}
+	for _, script := range *scripts {
+		if !strings.Contains(script, testMessage) {
+			t.Errorf("script does not send %q:\n%s", testMessage, script)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxMessageLength returns the configured messages.max_length, or 0 when
+// messages are unlimited.
+func maxMessageLength() int {
+	if appConfig != nil && appConfig.Messages.MaxLength > 0 {
+		return appConfig.Messages.MaxLength
+	}
+	return 0
+}
+
+// messageLength is the length of a message as counted against
+// messages.max_length: the number of user-perceived characters (grapheme
+// clusters), so an emoji or an accented letter counts once however many bytes
+// or code points it is made of.
+func messageLength(message string) int {
+	return len(graphemes(message))
+}
+
+// graphemes splits s into user-perceived characters. It approximates the
+// Unicode grapheme cluster rules (UAX #29) closely enough for messages:
+// combining marks, variation selectors, emoji skin-tone modifiers and tag
+// sequences stay attached to their base, zero-width-joiner sequences (e.g.
+// family emoji) stay whole, regional indicators pair up into flags, and CRLF is
+// one character.
+func graphemes(s string) []string {
+	var clusters []string
+	var current []rune
+	joinNext := false
+	for _, r := range s {
+		extend := len(current) > 0 && (joinNext || extendsCluster(r) ||
+			(r == '\n' && len(current) == 1 && current[0] == '\r') ||
+			(isRegionalIndicator(r) && len(current) == 1 && isRegionalIndicator(current[0])))
+		if !extend && len(current) > 0 {
+			clusters = append(clusters, string(current))
+			current = current[:0]
+		}
+		current = append(current, r)
+		joinNext = r == zeroWidthJoiner
+	}
+	if len(current) > 0 {
+		clusters = append(clusters, string(current))
+	}
+	return clusters
+}
+
+// zeroWidthJoiner glues the emoji on either side into a single glyph.
+const zeroWidthJoiner = '\u200D'
+
+// extendsCluster reports whether r attaches to the character before it.
+func extendsCluster(r rune) bool {
+	switch {
+	case r == zeroWidthJoiner:
+		return true
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc): // combining marks, variation selectors, keycaps
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF: // emoji skin-tone modifiers
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // emoji tag sequences (subdivision flags)
+		return true
+	}
+	return false
+}
+
+// isRegionalIndicator reports whether r is one of the letters that pair up
+// into flag emoji.
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// splitMessage breaks message into numbered parts ("(1/3) ...") of at most
+// maxLength characters each, numbering prefix included. Parts end at the last
+// whitespace that fits where possible, so words are only cut when a single word
+// is longer than a whole part, and then only between characters: an emoji or
+// accented letter is never cut in half.
+func splitMessage(message string, maxLength int) ([]string, error) {
+	chars := graphemes(message)
+	if len(chars) <= maxLength {
+		return []string{message}, nil
+	}
+
+	// The prefix width depends on the number of parts, which in turn depends
+	// on how much room the prefix leaves; grow the estimate until it holds.
+	for total := 2; ; total++ {
+		room := maxLength - messageLength(partPrefix(total, total))
+		if room <= 0 {
+			return nil, fmt.Errorf("max length %d is too small to split a message into numbered parts", maxLength)
+		}
+		chunks := chunkCharacters(chars, room)
+		if len(chunks) > total {
+			continue
+		}
+		parts := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			parts[i] = partPrefix(i+1, len(chunks)) + chunk
+		}
+		return parts, nil
+	}
+}
+
+// partPrefix numbers part n of total.
+func partPrefix(n, total int) string {
+	return fmt.Sprintf("(%d/%d) ", n, total)
+}
+
+// chunkCharacters cuts chars (grapheme clusters) into chunks of at most size
+// characters, preferring to break at whitespace. Whitespace at a break is
+// dropped so parts don't start or end with stray spaces.
+func chunkCharacters(chars []string, size int) []string {
+	var chunks []string
+	for len(chars) > 0 {
+		if len(chars) <= size {
+			chunks = append(chunks, strings.Join(chars, ""))
+			break
+		}
+		cut := size
+		for i := size; i > 0; i-- {
+			if isSpaceCharacter(chars[i]) {
+				cut = i
+				break
+			}
+		}
+		chunks = append(chunks, strings.Join(trimSpaceCharacters(chars[:cut]), ""))
+		chars = chars[cut:]
+		for len(chars) > 0 && isSpaceCharacter(chars[0]) {
+			chars = chars[1:]
+		}
+	}
+	return chunks
+}
+
+// isSpaceCharacter reports whether a grapheme cluster is whitespace.
+func isSpaceCharacter(char string) bool {
+	return strings.TrimSpace(char) == ""
+}
+
+// trimSpaceCharacters drops trailing whitespace characters.
+func trimSpaceCharacters(chars []string) []string {
+	for len(chars) > 0 && isSpaceCharacter(chars[len(chars)-1]) {
+		chars = chars[:len(chars)-1]
+	}
+	return chars
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+	// Short messages are left alone.
+	parts, err := splitMessage("hello", 10)
+	if err != nil || len(parts) != 1 || parts[0] != "hello" {
+		t.Fatalf("short message: %q, %v", parts, err)
+	}
+
+	msg := "the quick brown fox jumps over the lazy dog"
+	parts, err = splitMessage(msg, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"(1/3) the quick brown", "(2/3) fox jumps over", "(3/3) the lazy dog"}
+	if strings.Join(parts, "|") != strings.Join(want, "|") {
+		t.Errorf("splitMessage = %q, want %q", parts, want)
+	}
+	for _, p := range parts {
+		if n := messageLength(p); n > 21 {
+			t.Errorf("part %q is %d characters, over the limit", p, n)
+		}
+	}
+
+	// A word longer than a part is cut.
+	parts, err = splitMessage(strings.Repeat("x", 25), 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(parts, "|"); got != "(1/5) xxxxxx|(2/5) xxxxxx|(3/5) xxxxxx|(4/5) xxxxxx|(5/5) x" {
+		t.Errorf("hard cut = %q", got)
+	}
+
+	// No room left after the numbering prefix.
+	if _, err := splitMessage(strings.Repeat("x", 10), 5); err == nil {
+		t.Error("expected an error for a limit smaller than the prefix")
+	}
+}
+
+// TestMessageLengthCountsCharacters checks that emoji and accented letters
+// count as one character each, however many code points they're built from.
+func TestMessageLengthCountsCharacters(t *testing.T) {
+	cases := map[string]int{
+		"hello":   5,
+		"héllo":   5, // precomposed é
+		"héllo":  5, // e + combining acute accent
+		"👍":       1,
+		"👍🏽":      1, // thumbs up + skin tone modifier
+		"👨‍👩‍👧‍👦": 1, // family: four people joined by ZWJ
+		"🇩🇪🇫🇷":    2, // two flags from four regional indicators
+		"1️⃣":     1, // keycap 1
+		"❤️":      1, // heart + emoji presentation selector
+		"a\r\nb":  3,
+		"":        0,
+	}
+	for in, want := range cases {
+		if got := messageLength(in); got != want {
+			t.Errorf("messageLength(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+// TestSplitMessageKeepsEmojiIntact splits text made only of multi-code-point
+// characters and checks every part reassembles into the original characters,
+// i.e. nothing was cut mid-emoji or between a letter and its accent.
+func TestSplitMessageKeepsEmojiIntact(t *testing.T) {
+	family := "👨‍👩‍👧‍👦"
+	accented := "é"
+	msg := strings.Repeat(family+accented+"🇯🇵", 10) // 30 characters, no spaces
+
+	parts, err := splitMessage(msg, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rebuilt strings.Builder
+	for i, p := range parts {
+		if n := messageLength(p); n > 10 {
+			t.Errorf("part %d is %d characters, over the limit", i+1, n)
+		}
+		body := strings.TrimPrefix(p, partPrefix(i+1, len(parts)))
+		for _, char := range graphemes(body) {
+			if char != family && char != accented && char != "🇯🇵" {
+				t.Fatalf("part %d contains a broken character %q", i+1, char)
+			}
+		}
+		rebuilt.WriteString(body)
+	}
+	if rebuilt.String() != msg {
+		t.Error("parts do not reassemble into the original message")
+	}
+}
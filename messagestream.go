@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SSE events of POST /api/messages/stream.
+const (
+	messageStreamResultEvent = "result"
+	messageStreamDoneEvent   = "done"
+)
+
+// @Summary Send messages, streaming the results
+// @Description Send messages like POST /api/messages, but answer with Server-Sent Events as the sends happen, for live progress on large broadcasts: a "result" event carrying each recipient's MessageResult as soon as it is known, then a "done" event with the whole MessageResponse. Invalid requests are answered with a JSON error before the stream starts. Recipients still waiting when the client disconnects are not messaged. Idempotency-Key is not supported.
+// @Tags messages
+// @Accept json
+// @Produce text/event-stream
+// @Param request body MessageRequest true "Message request"
+// @Success 200 {string} string "Event stream of results"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input, or too many recipients after expanding groups"
+// @Router /api/messages/stream [post]
+func handleSendMessagesStream(c echo.Context) error {
+	// A stream for many recipients outlasts the server's write timeout.
+	liftWriteDeadline(c)
+
+	// Replaying a stream isn't possible, so don't pretend to.
+	if c.Request().Header.Get(idempotencyKeyHeader) != "" {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Idempotency-Key is not supported when streaming; use POST /api/messages",
+		})
+	}
+
+	send, status, body := prepareMessageSend(c)
+	if send == nil {
+		return c.JSON(status, body)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	started := time.Now()
+	results := sendMessageParts(c.Request().Context(), send.expansion.recipients, send.parts, func(result MessageResult) {
+		result.ExpandedFrom = send.expansion.groups[result.Recipient]
+		// A client that went away cancels the request's context, which
+		// stops the remaining sends.
+		if err := writeSSEEvent(res, messageStreamResultEvent, result); err == nil {
+			res.Flush()
+		}
+	})
+	recordFailedSends(results, send.parts)
+	recordSend(send.request.To, send.request.Message, results)
+
+	response := send.expansion.response(results)
+	response.DurationSeconds = time.Since(started).Seconds()
+	if err := writeSSEEvent(res, messageStreamDoneEvent, response); err == nil {
+		res.Flush()
+	}
+	return nil
+}
+
+// writeSSEEvent writes v, as JSON on a single line, as one SSE event named
+// event.
+func writeSSEEvent(w io.Writer, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestHandleSendMessagesStream checks each recipient's result is streamed as
+// its own event, followed by the whole response.
+func TestHandleSendMessagesStream(t *testing.T) {
+	prev := appConfig
+	appConfig = defaultConfig()
+	appConfig.Messages.Groups = map[string][]string{"family": {"+15550000002"}}
+	t.Cleanup(func() { appConfig = prev })
+	fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	post := func(body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/messages/stream", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		if err := handleSendMessagesStream(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	rec := post(`{"to":["+15550000001","family","+1555"],"message":"hi"}`, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "text/event-stream" {
+		t.Fatalf("got %d %q, want 200 text/event-stream", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+
+	var events []string
+	var results []MessageResult
+	var done MessageResponse
+	for _, event := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n") {
+		name, data, _ := strings.Cut(event, "\n")
+		name = strings.TrimPrefix(name, "event: ")
+		data = strings.TrimPrefix(data, "data: ")
+		events = append(events, name)
+		switch name {
+		case messageStreamResultEvent:
+			var result MessageResult
+			if err := json.Unmarshal([]byte(data), &result); err != nil {
+				t.Fatalf("result %q: %v", data, err)
+			}
+			results = append(results, result)
+		case messageStreamDoneEvent:
+			if err := json.Unmarshal([]byte(data), &done); err != nil {
+				t.Fatalf("done %q: %v", data, err)
+			}
+		}
+	}
+	if got := strings.Join(events, " "); got != "result result result done" {
+		t.Fatalf("events = %s, want three results then done", got)
+	}
+	if !results[0].Success || results[1].ExpandedFrom != "family" || results[2].Success {
+		t.Errorf("results = %+v, want the invalid number alone to fail and the group member tagged", results)
+	}
+	if len(done.Results) != 3 || len(done.Invalid) != 1 {
+		t.Errorf("done = %+v, want all 3 results and 1 invalid recipient", done)
+	}
+
+	// Invalid requests are rejected before any stream starts.
+	if rec := post(`{"to":[],"message":"hi"}`, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("no recipients: status = %d, want 400", rec.Code)
+	}
+	if rec := post(`{"to":["+15550000001"],"message":"hi"}`, http.Header{idempotencyKeyHeader: {"k"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Idempotency-Key: status = %d, want 400", rec.Code)
+	}
+}
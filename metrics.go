@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// appleScriptDurationBuckets are the upper bounds, in seconds, of the buckets
+// AppleScript runs are counted in: a healthy send takes well under a second,
+// while a stuck Messages app runs into messages.timeout_seconds.
+var appleScriptDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// appleScriptDurations times every executeAppleScript call.
+var appleScriptDurations = newDurationHistogram(appleScriptDurationBuckets)
+
+// durationHistogram counts durations into cumulative buckets, like a
+// Prometheus histogram.
+type durationHistogram struct {
+	mu sync.Mutex
+	// bounds are the buckets' upper bounds in seconds, ascending; counts
+	// holds one more entry for durations beyond the last.
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newDurationHistogram(bounds []float64) *durationHistogram {
+	return &durationHistogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// observe records one duration.
+func (h *durationHistogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := 0
+	for i < len(h.bounds) && seconds > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += seconds
+	h.count++
+}
+
+// write renders the histogram in the Prometheus text format as name.
+func (h *durationHistogram) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// @Summary Get metrics
+// @Description Report metrics in the Prometheus text format, for scraping: mowa_applescript_duration_seconds, a histogram of how long each AppleScript run (a message send, a reminder, ...) took, including failed and timed out ones. Counts start over when the server restarts.
+// @Tags system
+// @Produce plain
+// @Success 200 {string} string "Metrics"
+// @Router /api/metrics [get]
+func handleMetrics(c echo.Context) error {
+	var b strings.Builder
+	appleScriptDurations.write(&b, "mowa_applescript_duration_seconds", "Time taken by AppleScript runs, such as message sends.")
+	return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
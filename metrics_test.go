@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestDurationHistogram checks durations land in cumulative buckets in the
+// Prometheus text format.
+func TestDurationHistogram(t *testing.T) {
+	h := newDurationHistogram([]float64{0.5, 1})
+	for _, d := range []time.Duration{100 * time.Millisecond, 500 * time.Millisecond, 800 * time.Millisecond, 3 * time.Second} {
+		h.observe(d)
+	}
+
+	var b strings.Builder
+	h.write(&b, "send_seconds", "Send time.")
+	want := `# HELP send_seconds Send time.
+# TYPE send_seconds histogram
+send_seconds_bucket{le="0.5"} 2
+send_seconds_bucket{le="1"} 3
+send_seconds_bucket{le="+Inf"} 4
+send_seconds_sum 4.4
+send_seconds_count 4
+`
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+// TestHandleMetrics checks AppleScript runs are timed and reported.
+func TestHandleMetrics(t *testing.T) {
+	prev := appleScriptDurations
+	appleScriptDurations = newDurationHistogram(appleScriptDurationBuckets)
+	t.Cleanup(func() { appleScriptDurations = prev })
+	fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	if err := executeAppleScript(context.Background(), `return "ok"`, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	if err := handleMetrics(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/metrics", nil), rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "mowa_applescript_duration_seconds_count 1\n") {
+		t.Errorf("got %d %q, want one timed run", rec.Code, rec.Body.String())
+	}
+}
@@ -1,11 +1,216 @@
 package main
 
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
 // Config represents the application configuration
 type Config struct {
 	Messages            MessagesConfig            `yaml:"messages"`
 	Storage             StorageConfig             `yaml:"storage"`
 	Reminders           RemindersConfig           `yaml:"reminders"`
 	SoftwareUpdateCheck SoftwareUpdateCheckConfig `yaml:"software_update_check"`
+	Swagger             SwaggerConfig             `yaml:"swagger"`
+	Heartbeat           HeartbeatConfig           `yaml:"heartbeat"`
+	Log                 LogConfig                 `yaml:"log"`
+	Server              ServerConfig              `yaml:"server"`
+	Features            FeaturesConfig            `yaml:"features"`
+	Email               EmailConfig               `yaml:"email"`
+	Auth                AuthConfig                `yaml:"auth"`
+}
+
+// AuthConfig configures API key authentication. Without keys the API is open
+// to anyone who can reach it.
+type AuthConfig struct {
+	// APIKeys are the keys clients may send as "Authorization: Bearer
+	// <key>". Once any are set, POST /api/messages/test requires one; other
+	// requests may omit it but are rejected with an unknown one.
+	APIKeys []APIKeyConfig `yaml:"api_keys"`
+}
+
+// APIKeyConfig is one API key.
+type APIKeyConfig struct {
+	// Name identifies the key in logs, e.g. the client it was issued to.
+	Name string `yaml:"name"`
+	// Key is the secret itself.
+	Key string `yaml:"key"`
+	// StorageDir, a directory inside storage.dir, confines the key's storage
+	// requests to it, so tenants sharing a server can't see each other's
+	// files. Empty (the default) gives the key the whole storage.dir.
+	StorageDir string `yaml:"storage_dir"`
+}
+
+// FeaturesConfig turns whole groups of endpoints on or off, so one binary can
+// serve different roles. Omitted (nil) flags are enabled; a disabled feature's
+// routes are not registered and answer 404.
+type FeaturesConfig struct {
+	// Messages serves /api/messages and its sub-routes.
+	Messages *bool `yaml:"messages"`
+	// Storage serves /api/storage and its sub-routes.
+	Storage *bool `yaml:"storage"`
+}
+
+// messagesEnabled reports whether the messages routes should be registered.
+func (c FeaturesConfig) messagesEnabled() bool {
+	return c.Messages == nil || *c.Messages
+}
+
+// storageEnabled reports whether the storage routes should be registered.
+func (c FeaturesConfig) storageEnabled() bool {
+	return c.Storage == nil || *c.Storage
+}
+
+// ServerConfig holds HTTP server settings.
+type ServerConfig struct {
+	// TrustedProxies lists reverse proxies (IP addresses or CIDR ranges)
+	// whose X-Forwarded-For header is believed when determining the client
+	// IP. Empty means the direct connection address is always used.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// MaxConcurrentRequests caps how many requests are handled at once;
+	// further requests get 503 until one finishes. Zero (the default) means
+	// unlimited. The health check is never limited.
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests"`
+	// ReadTimeoutSeconds bounds reading a request, headers and body.
+	// Defaults to defaultReadTimeoutSeconds.
+	ReadTimeoutSeconds int `yaml:"read_timeout_seconds"`
+	// WriteTimeoutSeconds bounds handling a request and writing its
+	// response. Defaults to defaultWriteTimeoutSeconds. Streams, zip
+	// downloads, uploads and message sends are exempt.
+	WriteTimeoutSeconds int `yaml:"write_timeout_seconds"`
+	// UploadTimeoutSeconds bounds receiving a raw upload or zip archive,
+	// which replaces the read timeout for them. Defaults to
+	// defaultUploadTimeoutSeconds.
+	UploadTimeoutSeconds int `yaml:"upload_timeout_seconds"`
+	// IdleTimeoutSeconds is how long a keep-alive connection may wait for
+	// the next request. Defaults to defaultIdleTimeoutSeconds.
+	IdleTimeoutSeconds int `yaml:"idle_timeout_seconds"`
+	// Banner is shown at the top of the / response, e.g. the instance name
+	// and environment, to tell deployments apart. Empty shows nothing.
+	Banner string `yaml:"banner"`
+	// CORS sets which origins browsers may call mowa from, optionally per
+	// route.
+	CORS CORSConfig `yaml:"cors"`
+	// ResponseHeaders removes or overrides headers on every response, e.g.
+	// to hide what the server runs on.
+	ResponseHeaders ResponseHeadersConfig `yaml:"response_headers"`
+}
+
+// ResponseHeadersConfig edits the headers of every response, just before
+// they are sent.
+type ResponseHeadersConfig struct {
+	// Remove lists headers to drop, e.g. "X-Powered-By".
+	Remove []string `yaml:"remove"`
+	// Set maps headers to the value they are sent with, replacing any set
+	// by mowa, e.g. Server: mowa.
+	Set map[string]string `yaml:"set"`
+}
+
+// CORSConfig configures cross-origin access. Without it every origin is
+// allowed everywhere.
+type CORSConfig struct {
+	// AllowOrigins applies to every path no entry in Routes matches, e.g.
+	// "https://dashboard.example.com" or "*". Defaults to "*".
+	AllowOrigins []string `yaml:"allow_origins"`
+	// Routes overrides AllowOrigins for the paths under a prefix; when
+	// several match, the longest prefix wins.
+	Routes []CORSRouteConfig `yaml:"routes"`
+	// AllowMethods are the methods preflight requests may ask for, on every
+	// route. Defaults to defaultCORSAllowMethods.
+	AllowMethods []string `yaml:"allow_methods"`
+	// AllowHeaders are the request headers preflight requests may ask for,
+	// on every route; a lone "*" allows any. Defaults to
+	// defaultCORSAllowHeaders.
+	AllowHeaders []string `yaml:"allow_headers"`
+}
+
+// CORSRouteConfig is the CORS policy of the paths under one prefix.
+type CORSRouteConfig struct {
+	// Path is the prefix, matched on whole path segments: "/api/messages"
+	// covers /api/messages and /api/messages/validate but not
+	// /api/messagesx.
+	Path string `yaml:"path"`
+	// AllowOrigins lists the origins allowed under Path.
+	AllowOrigins []string `yaml:"allow_origins"`
+}
+
+// LogConfig configures where HTTP access logs go. Without File they are
+// printed to stdout.
+type LogConfig struct {
+	// File receives access logs as JSON lines, one per request.
+	File string `yaml:"file"`
+	// MaxSizeMB is the size at which File is rotated. Defaults to
+	// defaultLogMaxSizeMB.
+	MaxSizeMB int `yaml:"max_size_mb"`
+	// MaxBackups is how many rotated files to keep. Zero keeps all of them.
+	MaxBackups int `yaml:"max_backups"`
+	// MaxAgeDays deletes rotated files older than this. Zero keeps them
+	// regardless of age.
+	MaxAgeDays int `yaml:"max_age_days"`
+	// SkipPaths lists request paths (e.g. "/" polled by an uptime monitor)
+	// that are not access-logged. Matching is exact, on the path without the
+	// query string.
+	SkipPaths []string `yaml:"skip_paths"`
+}
+
+// HeartbeatConfig configures uptime-based notifications: an alert when the
+// server starts shortly after a reboot, and an optional periodic heartbeat.
+type HeartbeatConfig struct {
+	// Notify lists who to message, as phone numbers or group names. Nothing
+	// is sent when it is empty.
+	Notify []string `yaml:"notify"`
+	// RebootThresholdSeconds is the uptime below which startup is reported as
+	// a reboot. Defaults to defaultHeartbeatRebootThresholdSeconds.
+	RebootThresholdSeconds int `yaml:"reboot_threshold_seconds"`
+	// IntervalMinutes, when positive, sends a "still alive" message this
+	// often. Zero (the default) sends only the reboot alert.
+	IntervalMinutes int `yaml:"interval_minutes"`
+	// NotifyOnShutdown also messages Notify when the server is stopped (e.g.
+	// by launchd during an upgrade), so an intentional stop is told apart
+	// from a crash.
+	NotifyOnShutdown bool `yaml:"notify_on_shutdown"`
+}
+
+// EmailConfig sets up sending to email addresses through an SMTP server.
+// Once Host is set, any recipient containing "@" (in POST /api/messages,
+// storage notifications, groups and so on) is emailed instead of messaged.
+type EmailConfig struct {
+	// Host is the SMTP server. Empty (the default) disables email.
+	Host string `yaml:"host"`
+	// Port defaults to defaultEmailPort (submission with STARTTLS); 465
+	// connects with TLS from the start.
+	Port int `yaml:"port"`
+	// From is the sender address. Required when Host is set.
+	From string `yaml:"from"`
+	// Username and Password authenticate to the server (PLAIN, only over
+	// TLS or to localhost). Empty Username skips authentication.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Subject of every email. Defaults to defaultEmailSubject.
+	Subject string `yaml:"subject"`
+	// TimeoutSeconds bounds sending one email. Defaults to
+	// defaultEmailTimeoutSeconds.
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+}
+
+// isEnabled reports whether email recipients can be sent to.
+func (c EmailConfig) isEnabled() bool {
+	return strings.TrimSpace(c.Host) != ""
+}
+
+// SwaggerConfig controls the interactive API documentation under /swagger/.
+type SwaggerConfig struct {
+	// Enabled serves the Swagger UI and the OpenAPI spec at /swagger/doc.json.
+	// When omitted (nil) they are served; set `enabled: false` to hide them,
+	// e.g. on an exposed production host.
+	Enabled *bool `yaml:"enabled"`
+}
+
+// isEnabled reports whether the Swagger routes should be registered.
+func (c SwaggerConfig) isEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
 }
 
 // SoftwareUpdateCheckConfig configures the nightly `mowa check-updates` run
@@ -51,22 +256,181 @@ type MessagesConfig struct {
 	// TimeoutSeconds bounds how long a single osascript send may run before
 	// it is killed and reported as a failure. Defaults to defaultSendTimeoutSeconds.
 	TimeoutSeconds int `yaml:"timeout_seconds"`
+	// Templates are named message bodies a request can reference instead of
+	// sending raw text. Placeholders use Go text/template syntax, e.g.
+	// "Disk on {{.host}} is {{.percent}}% full".
+	Templates map[string]string `yaml:"templates"`
+	// IdempotencyTTLSeconds is how long the response to a request carrying an
+	// Idempotency-Key is remembered for retries. Defaults to
+	// defaultIdempotencyTTLSeconds (24h).
+	IdempotencyTTLSeconds int `yaml:"idempotency_ttl_seconds"`
+	// MaxLength caps a message's length in characters. Longer messages are
+	// rejected unless the request sets split, in which case they are sent as
+	// numbered parts. Zero (the default) means unlimited.
+	MaxLength int `yaml:"max_length"`
+	// MaxRecipients caps how many recipients one request may send to, counted
+	// after groups are expanded, so a misconfigured group can't flood the
+	// Messages app. Defaults to defaultMaxRecipients.
+	MaxRecipients int `yaml:"max_recipients"`
+	// AllowedRecipients, when non-empty, is the only set of recipients that
+	// may be messaged: phone numbers, group chats ("chat:<name>") and group
+	// names, which allow every member of the group. Empty means unrestricted.
+	AllowedRecipients []string `yaml:"allowed_recipients"`
+	// DeadLetterFile persists messages that failed to send (see GET
+	// /api/messages/failed) so they survive restarts. Without it they are only
+	// kept in memory.
+	DeadLetterFile string `yaml:"dead_letter_file"`
+	// SendLogFile persists the history of sends (see GET
+	// /api/messages/status) as JSON lines so it survives restarts. Without it
+	// the history is only kept in memory.
+	SendLogFile string `yaml:"send_log_file"`
+	// WebhookSecret enables POST /api/webhook/message, which sends messages
+	// for external services that sign their requests with this secret (see
+	// webhookSignatureHeader). Empty (the default) disables it.
+	WebhookSecret string `yaml:"webhook_secret"`
+	// TestRecipient is who POST /api/messages/test messages when the request
+	// names no one, typically the operator's own number.
+	TestRecipient string `yaml:"test_recipient"`
+	// SendDelay is waited between consecutive sends of a request, e.g.
+	// "2s", so sending to a group isn't flagged as spam. Zero (the default)
+	// sends back to back.
+	SendDelay time.Duration `yaml:"send_delay"`
+	// RateLimitPerMinute caps iMessage sends per minute across all requests
+	// and recipients, allowing bursts of up to as many, so Apple doesn't flag
+	// the account. Zero (the default) means unlimited.
+	RateLimitPerMinute int `yaml:"rate_limit_per_minute"`
+	// RateLimitAction is what a send beyond RateLimitPerMinute does: "queue"
+	// (the default) waits its turn, "reject" fails it right away.
+	RateLimitAction string `yaml:"rate_limit_action"`
 }
 
 // StorageConfig represents the storage configuration
 type StorageConfig struct {
 	Dir string `yaml:"dir"`
+	// Quota caps the total size in bytes of the files in Dir. Writes that
+	// would exceed it are rejected with 507 Insufficient Storage. Zero (the
+	// default) means unlimited.
+	Quota int64 `yaml:"quota"`
+	// EncryptionKey, when set, encrypts file content at rest with AES-256-GCM.
+	// It must be 32 random bytes, base64-encoded. MOWA_STORAGE_ENCRYPTION_KEY
+	// takes precedence so the key can be kept out of the config file.
+	EncryptionKey string `yaml:"encryption_key"`
+	// Notifier selects how `notify` recipients are told about storage
+	// operations: "imessage" (the default), "webhook" or "log".
+	Notifier string `yaml:"notifier"`
+	// WebhookURL receives a JSON POST per notification when Notifier is
+	// "webhook".
+	WebhookURL string `yaml:"webhook_url"`
+	// WebhookHeaders are extra headers sent with every webhook POST, e.g. an
+	// Authorization token for the receiver.
+	WebhookHeaders map[string]string `yaml:"webhook_headers"`
+	// WebhookTimeoutSeconds bounds a single webhook POST. Defaults to
+	// defaultWebhookTimeoutSeconds.
+	WebhookTimeoutSeconds int `yaml:"webhook_timeout_seconds"`
+	// WebhookRetries is how many more times a webhook POST is tried after a
+	// network error, 5xx or 429 response, with a doubling delay starting at
+	// one second. Zero (the default) never retries.
+	WebhookRetries int `yaml:"webhook_retries"`
+	// NotifyTemplate is the text/template for notification messages, with the
+	// fields of storageNotification (e.g. "{{.Operation}} {{.Path}} on
+	// {{.Host}}"). Defaults to defaultStorageNotifyTemplate.
+	NotifyTemplate string `yaml:"notify_template"`
+	// NotifyMessages overrides NotifyTemplate for particular operations,
+	// mapping an operation name such as "POST" or "GET" (in any case) to
+	// its own template, e.g. to word saves and reads differently.
+	// Operations not listed use NotifyTemplate.
+	NotifyMessages map[string]string `yaml:"notify_messages"`
+	// DirMode and FileMode are octal permission strings (e.g. "0775") for
+	// directories and files created in Dir. They default to 0755 and 0644 and
+	// are applied exactly, regardless of the process umask.
+	DirMode  string `yaml:"dir_mode"`
+	FileMode string `yaml:"file_mode"`
+	// UseFileLocks takes advisory flock(2) locks around reads (shared) and
+	// writes (exclusive), so mowa cooperates with other programs that lock
+	// files in Dir. Unix only.
+	UseFileLocks bool `yaml:"use_file_locks"`
+	// MaxPathDepth caps how many components (directories and the file name)
+	// a storage path may have, e.g. 2 allows "/docs/a.txt" but not
+	// "/docs/2024/a.txt". Zero (the default) means unlimited.
+	MaxPathDepth int `yaml:"max_path_depth"`
+	// StrictNames rejects storage paths with names that are legal but hard
+	// to manage: control characters, a trailing dot or space, or a name
+	// Windows reserves (CON, NUL, COM1, ...). See checkStrictName.
+	StrictNames bool `yaml:"strict_names"`
+	// SelfCheck writes, reads back and deletes a temporary file in Dir at
+	// startup, and refuses to start if any step fails, like the -selfcheck
+	// flag.
+	SelfCheck bool `yaml:"self_check"`
+	// CacheEntries enables an in-memory LRU cache of up to this many file
+	// contents for reads, dropped when mowa writes a file and re-read when a
+	// file's size or modification time changes. Zero (the default) disables it.
+	CacheEntries int `yaml:"cache_entries"`
+	// MaxConcurrentReads caps how many file reads (GETs and batch reads) run
+	// at once, bounding the memory and disk I/O a burst of large reads can
+	// take. Further reads wait briefly for a slot and then get 503. Zero (the
+	// default) means unlimited.
+	MaxConcurrentReads int `yaml:"max_concurrent_reads"`
+	// ExpiryFile persists when files saved with a ttl expire. Without it
+	// expiries are kept in memory only, and files still due to expire at a
+	// restart become permanent.
+	ExpiryFile string `yaml:"expiry_file"`
+	// ExpirySweepSeconds is how often expired files are deleted. Defaults to
+	// defaultExpirySweepSeconds. Expired files read as not found meanwhile.
+	ExpirySweepSeconds int `yaml:"expiry_sweep_seconds"`
+	// TrackDownloads counts successful reads of each file (GETs and batch
+	// reads), reported by POST /api/storage/stat. Off by default.
+	TrackDownloads bool `yaml:"track_downloads"`
+	// DownloadsFile persists the counts, rewritten within a few seconds of a
+	// read, and at once when a limit changes. Without it they are kept in
+	// memory only and start over at a restart.
+	DownloadsFile string `yaml:"downloads_file"`
+	// DownloadLimitAction is what happens to a file saved with maxDownloads
+	// once it has been read that often: "gone" (the default) keeps it but
+	// answers further reads with 410 Gone, "delete" deletes it.
+	DownloadLimitAction string `yaml:"download_limit_action"`
+	// AllowExpandEnv lets GET requests set expandEnv to have ${VAR}
+	// placeholders in a file replaced with the server's environment. Off by
+	// default: anyone who can write a file could then read the server's
+	// environment, secrets included.
+	AllowExpandEnv bool `yaml:"allow_expand_env"`
+	// IndexFile is the file GET /api/storage/{path} serves when path is a
+	// directory. Defaults to defaultIndexFile.
+	IndexFile string `yaml:"index_file"`
+	// TreeMaxDepth caps how many levels below its path GET
+	// /api/storage/tree descends. Defaults to defaultTreeMaxDepth.
+	TreeMaxDepth int `yaml:"tree_max_depth"`
+	// TreeMaxNodes caps how many files and directories GET
+	// /api/storage/tree returns; the tree is cut off there. Defaults to
+	// defaultTreeMaxNodes.
+	TreeMaxNodes int `yaml:"tree_max_nodes"`
+	// MaxListEntries caps how many entries are read from any one directory
+	// when listing it, so a huge directory can't exhaust memory; the
+	// listing is marked truncated instead. Defaults to
+	// defaultMaxListEntries.
+	MaxListEntries int `yaml:"max_list_entries"`
+
+	// dirMode and fileMode are DirMode and FileMode parsed by loadConfig.
+	dirMode  os.FileMode
+	fileMode os.FileMode
 }
 
 // MessageRequest represents the request to send messages
 // @Description Request to send messages to recipients
 type MessageRequest struct {
-	// @Description List of phone numbers or group names to send messages to
-	// @Example ["+1234567890", "family", "+0987654321"]
+	// @Description List of phone numbers, group names or group chats ("chat:<name>") to send messages to
+	// @Example ["+1234567890", "family", "chat:My Family"]
 	To []string `json:"to" binding:"required"`
-	// @Description The message content to send
+	// @Description The message content to send (required unless template is given)
 	// @Example "Hello from Mowa API!"
-	Message string `json:"message" binding:"required"`
+	Message string `json:"message"`
+	// @Description Name of a messages.templates entry to render instead of sending message
+	// @Example "disk-alert"
+	Template string `json:"template,omitempty"`
+	// @Description Values for the template's {{.placeholders}}
+	// @Example {"host": "macmini", "percent": "93"}
+	Vars map[string]string `json:"vars,omitempty"`
+	// @Description Split a message longer than messages.max_length into numbered parts instead of rejecting it
+	Split bool `json:"split,omitempty"`
 }
 
 // MessageResponse represents the response from sending messages
@@ -74,6 +438,15 @@ type MessageRequest struct {
 type MessageResponse struct {
 	// @Description List of results for each recipient
 	Results []MessageResult `json:"results"`
+	// @Description Recipients listed more than once, directly or through groups; each was messaged only once
+	// @Example ["+1234567890"]
+	Duplicates []string `json:"duplicates,omitempty"`
+	// @Description Recipients that failed validation (see their result for why), and groups without members
+	// @Example ["+1555"]
+	Invalid []string `json:"invalid,omitempty"`
+	// @Description How long sending took in seconds, including any messages.send_delay between sends
+	// @Example 4.2
+	DurationSeconds float64 `json:"durationSeconds"`
 }
 
 // MessageResult represents the result of sending a message to one recipient
@@ -86,6 +459,138 @@ type MessageResult struct {
 	Success bool `json:"success"`
 	// @Description Error message if the message failed to send
 	Error *string `json:"error,omitempty"`
+	// @Description Part number (1-based) when the message was split into parts
+	// @Example 2
+	Part int `json:"part,omitempty"`
+	// @Description The group the recipient was expanded from, if any
+	// @Example "family"
+	ExpandedFrom string `json:"expandedFrom,omitempty"`
+}
+
+// FailedMessage is a send that failed and can be retried
+// @Description A message that failed to send
+type FailedMessage struct {
+	// @Description Identifier to retry this message by
+	// @Example "9f86d081884c7d65"
+	ID string `json:"id"`
+	// @Description The recipient the message failed to reach
+	// @Example "+1234567890"
+	Recipient string `json:"recipient"`
+	// @Description The message (or, for a split message, the part) that failed
+	// @Example "Hello from Mowa API!"
+	Message string `json:"message"`
+	// @Description Why the most recent attempt failed
+	// @Example "AppleScript error: buddy not found"
+	Error string `json:"error"`
+	// @Description When the most recent attempt failed
+	// @Example "2024-05-01T12:00:00Z"
+	FailedAt time.Time `json:"failedAt"`
+	// @Description How many times sending has been attempted
+	// @Example 1
+	Attempts int `json:"attempts"`
+}
+
+// FailedMessagesResponse lists the failed messages
+// @Description Messages that failed to send, oldest first
+type FailedMessagesResponse struct {
+	Failed []FailedMessage `json:"failed"`
+}
+
+// RetryMessagesRequest selects failed messages to retry
+// @Description Failed messages to retry
+type RetryMessagesRequest struct {
+	// @Description IDs of the failed messages to retry; all of them when omitted
+	// @Example ["9f86d081884c7d65"]
+	IDs []string `json:"ids"`
+}
+
+// RetryResult is the outcome of retrying one failed message
+// @Description Result of retrying a failed message
+type RetryResult struct {
+	// @Description The failed message's ID
+	// @Example "9f86d081884c7d65"
+	ID string `json:"id"`
+	// @Description The recipient, empty for an unknown ID
+	// @Example "+1234567890"
+	Recipient string `json:"recipient,omitempty"`
+	// @Description Whether the message was sent this time
+	Success bool `json:"success"`
+	// @Description Error message if it failed again or the ID is unknown
+	Error *string `json:"error,omitempty"`
+}
+
+// RetryMessagesResponse represents the results of a retry
+// @Description Results of retrying failed messages
+type RetryMessagesResponse struct {
+	Results []RetryResult `json:"results"`
+}
+
+// SentMessage is one send through the messages API, as kept in the send log
+// @Description A message that was sent, and how it went for each recipient
+type SentMessage struct {
+	// @Description Identifier of the send
+	// @Example "9f86d081884c7d65"
+	ID string `json:"id"`
+	// @Description When the message was sent
+	// @Example "2024-05-01T12:00:00Z"
+	SentAt time.Time `json:"sentAt"`
+	// @Description Recipients as requested, before groups were expanded
+	// @Example ["family", "+1234567890"]
+	To []string `json:"to"`
+	// @Description The message that was sent (whole, even if it was split into parts)
+	// @Example "Hello from Mowa API!"
+	Message string `json:"message"`
+	// @Description Result for each recipient (and part)
+	Results []MessageResult `json:"results"`
+}
+
+// SendLogResponse lists recent sends
+// @Description Recent sends, newest first
+type SendLogResponse struct {
+	Sends []SentMessage `json:"sends"`
+	// @Description Number of sends in the log
+	// @Example 120
+	Total int `json:"total"`
+}
+
+// TestMessageRequest represents the request to send a test message
+// @Description Who to send the test message to
+type TestMessageRequest struct {
+	// @Description Recipient of the test message; defaults to messages.test_recipient
+	// @Example "+1234567890"
+	To string `json:"to,omitempty"`
+}
+
+// ValidateRecipientsRequest represents the request to validate recipients
+// @Description Recipients to validate without sending anything
+type ValidateRecipientsRequest struct {
+	// @Description List of phone numbers or group names to validate
+	// @Example ["+1234567890", "family"]
+	To []string `json:"to"`
+}
+
+// ValidateRecipientsResponse represents the result of validating recipients
+// @Description Validation result for every recipient after group expansion
+type ValidateRecipientsResponse struct {
+	// @Description Whether every recipient is valid
+	Valid bool `json:"valid"`
+	// @Description Result for each recipient, with groups expanded to their members
+	Results []RecipientValidation `json:"results"`
+}
+
+// RecipientValidation represents the validation result for one recipient
+// @Description Validation result for a single recipient
+type RecipientValidation struct {
+	// @Description The phone number as it would be messaged
+	// @Example "+1234567890"
+	Recipient string `json:"recipient"`
+	// @Description The group the recipient was expanded from, if any
+	// @Example "family"
+	Group string `json:"group,omitempty"`
+	// @Description Whether the recipient can be messaged
+	Valid bool `json:"valid"`
+	// @Description Why the recipient is invalid
+	Error string `json:"error,omitempty"`
 }
 
 // UptimeResponse represents the system uptime response
@@ -94,8 +599,8 @@ type UptimeResponse struct {
 	// @Description Human-readable uptime string
 	// @Example "2 days, 3 hours, 45 minutes"
 	Uptime string `json:"uptime"`
-	// @Description Uptime in seconds
-	// @Example 176700
+	// @Description Uptime in seconds, with sub-second precision when read natively; whole minutes when parsed from the uptime command
+	// @Example 176734.52
 	UptimeSeconds float64 `json:"uptimeSeconds"`
 	// @Description Formatted uptime string (same as uptime)
 	// @Example "2 days, 3 hours, 45 minutes"
@@ -114,6 +619,42 @@ type StorageRequest struct {
 	// @Description List of phone numbers or group names to notify about the operation result
 	// @Example ["some-group", "+1234567890"]
 	Notify []string `json:"notify,omitempty"`
+	// @Description Byte offset to start reading from (GET only). When offset or length is set, only that range is returned, base64-encoded.
+	// @Example 1024
+	Offset *int64 `json:"offset,omitempty"`
+	// @Description Maximum number of bytes to read (GET only). Reads past the end of the file are clamped to it.
+	// @Example 4096
+	Length *int64 `json:"length,omitempty"`
+	// @Description Return only the last N lines of the file (GET only). Cannot be combined with offset/length.
+	// @Example 50
+	Tail *int `json:"tail,omitempty"`
+	// @Description First line to return, 1-based (GET only). Defaults to 1 when only endLine is set. Cannot be combined with offset/length/tail.
+	// @Example 10
+	StartLine *int `json:"startLine,omitempty"`
+	// @Description Last line to return, inclusive (GET only). Defaults to the end of the file; values past it are clamped.
+	// @Example 20
+	EndLine *int `json:"endLine,omitempty"`
+	// @Description Stream the file's raw bytes instead of embedding them in JSON (GET only), with a Content-Type guessed from the file's extension or content. Cannot be combined with offset/length, tail or line ranges.
+	// @Example true
+	Raw bool `json:"raw,omitempty"`
+	// @Description Parse the file and return the parsed value in data instead of content (GET only). Only "json" is supported; a file that isn't valid JSON gets 422. Cannot be combined with raw, offset/length, tail or line ranges.
+	// @Example "json"
+	Parse string `json:"parse,omitempty"`
+	// @Description Replace ${VAR} placeholders in the content with the server's environment variables before returning it (GET only); unset variables become empty. Only allowed when storage.allow_expand_env is set. Cannot be combined with raw, offset/length, tail or line ranges.
+	// @Example true
+	ExpandEnv bool `json:"expandEnv,omitempty"`
+	// @Description Only save if the file hasn't been modified since this time (POST only), e.g. the modTime from the read being edited; otherwise 412. Takes precedence over an If-Unmodified-Since header.
+	// @Example "2024-05-01T12:00:00Z"
+	IfModTime string `json:"ifModTime,omitempty"`
+	// @Description Modification time to give the saved or touched file (POST and touch only), e.g. the original's when syncing. Defaults to the current time.
+	// @Example "2024-04-30T08:15:00Z"
+	ModTime string `json:"modTime,omitempty"`
+	// @Description Delete the saved file this long after the save (POST only), as a Go duration. Saving without ttl makes the file permanent again.
+	// @Example "24h"
+	TTL string `json:"ttl,omitempty"`
+	// @Description Let the saved file be read only this many times (POST only), e.g. 1 for a one-time link; after that reads get 410 Gone or the file is deleted, per storage.download_limit_action. Saving without maxDownloads lifts the limit.
+	// @Example 1
+	MaxDownloads *int64 `json:"maxDownloads,omitempty"`
 }
 
 // StorageResponse represents the response from storage operations
@@ -123,8 +664,262 @@ type StorageResponse struct {
 	Success bool `json:"success"`
 	// @Description File content (for GET operations) or success message (for POST operations)
 	Content string `json:"content,omitempty"`
+	// @Description Encoding of content when it is not plain text: "base64" for byte ranges and for binary files
+	// @Example "base64"
+	Encoding string `json:"encoding,omitempty"`
+	// @Description When the file was last modified, in RFC 3339 (UTC), for GET operations and successful or precondition-failed saves
+	// @Example "2024-05-01T12:00:00Z"
+	ModTime string `json:"modTime,omitempty"`
+	// @Description Size of the whole file in bytes (as stored, before any base64 encoding), for GET operations and successful or precondition-failed saves. For byte ranges, tail and line ranges it is still the size of the whole file.
+	// @Example 1024
+	Size *int64 `json:"size,omitempty"`
+	// @Description The file's parsed content, for GET operations with parse set (content is omitted then)
+	Data json.RawMessage `json:"data,omitempty" swaggertype:"object"`
+	// @Description When the file expires and is deleted, in RFC 3339 (UTC), for saves with a ttl
+	// @Example "2024-05-02T12:00:00Z"
+	ExpiresAt string `json:"expiresAt,omitempty"`
 	// @Description Error message if the operation failed
 	Error string `json:"error,omitempty"`
+	// @Description Machine-readable reason the operation failed, when clients may want to react to it: "disk_full" when a save failed because the disk holding the storage directory is full
+	// @Example "disk_full"
+	Code string `json:"code,omitempty"`
+}
+
+// HealthResponse represents the result of a health check
+// @Description Server health
+type HealthResponse struct {
+	// @Description "ok" when every check passed, "unhealthy" otherwise
+	// @Example "ok"
+	Status string `json:"status"`
+	// @Description Whether a file could be created in the storage directory; omitted when storage is disabled
+	// @Example true
+	StorageWritable *bool `json:"storageWritable,omitempty"`
+	// @Description What failed, when unhealthy
+	Error string `json:"error,omitempty"`
+}
+
+// StorageUsageResponse represents the space used by the storage directory
+// @Description Total size and file count of the storage directory
+type StorageUsageResponse struct {
+	// @Description Total size of all stored files in bytes (as stored on disk)
+	// @Example 1048576
+	TotalBytes int64 `json:"totalBytes"`
+	// @Description Number of stored files
+	// @Example 42
+	Files int `json:"files"`
+	// @Description Configured storage.quota in bytes, omitted when unlimited
+	// @Example 1073741824
+	QuotaBytes int64 `json:"quotaBytes,omitempty"`
+}
+
+// StorageTreeNode is a file or directory in a directory tree
+// @Description A file or directory, with a directory's contents nested under children
+type StorageTreeNode struct {
+	// @Description Base name of the file or directory
+	// @Example "report.txt"
+	Name string `json:"name"`
+	// @Description "file" or "directory"
+	// @Example "file"
+	Type string `json:"type"`
+	// @Description Size of a file in bytes
+	// @Example 1024
+	Size *int64 `json:"size,omitempty"`
+	// @Description When a file was last modified, in RFC 3339 (UTC)
+	// @Example "2024-05-01T12:00:00Z"
+	ModTime string `json:"modTime,omitempty"`
+	// @Description Contents of a directory, sorted by name
+	Children []*StorageTreeNode `json:"children,omitempty"`
+	// @Description Set on a directory whose contents were left out, or only partly listed, because of the depth or node limit; fetch its own tree to see them
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// StorageTreeResponse represents a directory tree
+// @Description Nested tree of the files and directories under a directory
+type StorageTreeResponse struct {
+	// @Description Whether the tree was built
+	Success bool `json:"success"`
+	// @Description The directory, with everything under it up to the depth and node limits
+	Tree *StorageTreeNode `json:"tree,omitempty"`
+	// @Description Number of files and directories in the tree, not counting its root
+	// @Example 42
+	Nodes int `json:"nodes"`
+	// @Description Whether any directory in the tree is truncated
+	Truncated bool `json:"truncated,omitempty"`
+	// @Description Error message if the tree could not be built
+	Error string `json:"error,omitempty"`
+}
+
+// StoragePatchRequest represents a find/replace edit of a stored text file
+// @Description Request to edit part of a stored file in place
+type StoragePatchRequest struct {
+	// @Description File path relative to storage directory
+	// @Example "/config/database.yaml"
+	Path string `json:"path"`
+	// @Description Exact text to find (required unless appendLine is set)
+	// @Example "port: 5432"
+	Find string `json:"find"`
+	// @Description Text to replace it with (may be empty to delete)
+	// @Example "port: 6432"
+	Replace string `json:"replace"`
+	// @Description Replace every occurrence instead of only the first
+	// @Example false
+	All bool `json:"all,omitempty"`
+	// @Description A line to append to the file, created if missing, instead of a find/replace; a newline is added after it
+	// @Example "2024-05-01T12:00:00Z deploy finished"
+	AppendLine *string `json:"appendLine,omitempty"`
+	// @Description List of phone numbers or group names to notify about the operation result
+	// @Example ["some-group", "+1234567890"]
+	Notify []string `json:"notify,omitempty"`
+}
+
+// StorageExistsResponse represents the response from an existence check
+// @Description Whether a path exists in the storage directory
+type StorageExistsResponse struct {
+	// @Description Whether a file or directory exists at the path
+	Exists bool `json:"exists"`
+}
+
+// StorageStatResponse represents a file's metadata
+// @Description Metadata of a file in the storage directory
+type StorageStatResponse struct {
+	// @Description Whether the file was found
+	Success bool `json:"success"`
+	// @Description The path, as requested
+	// @Example "/shares/slides.pdf"
+	Path string `json:"path,omitempty"`
+	// @Description Size of the file in bytes
+	// @Example 1024
+	Size int64 `json:"size,omitempty"`
+	// @Description When the file was last modified, in RFC 3339 (UTC)
+	// @Example "2024-05-01T12:00:00Z"
+	ModTime string `json:"modTime,omitempty"`
+	// @Description When the file expires, in RFC 3339 (UTC), if it was saved with a ttl
+	// @Example "2024-05-02T12:00:00Z"
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// @Description How many times the file has been read successfully; omitted unless storage.track_downloads is on
+	// @Example 3
+	Downloads *int64 `json:"downloads,omitempty"`
+	// @Description When the file was last read, in RFC 3339 (UTC); omitted if it never was or downloads aren't tracked
+	// @Example "2024-05-01T13:30:00Z"
+	LastAccess string `json:"lastAccess,omitempty"`
+	// @Description How many times the file may be read in all, if it was saved with maxDownloads
+	// @Example 5
+	MaxDownloads *int64 `json:"maxDownloads,omitempty"`
+	// @Description Error message if the file couldn't be described
+	Error string `json:"error,omitempty"`
+}
+
+// StorageMove is one source/destination pair of a batch move
+// @Description A file or directory to move, and where to
+type StorageMove struct {
+	// @Description Existing file or directory, relative to the storage directory
+	// @Example "/inbox/report.pdf"
+	Source string `json:"source"`
+	// @Description New path, relative to the storage directory; must not exist yet. Missing parent directories are created.
+	// @Example "/archive/2024/report.pdf"
+	Destination string `json:"destination"`
+}
+
+// StorageMoveBatchRequest represents a request to move many files at once
+// @Description Moves to perform, in order
+type StorageMoveBatchRequest struct {
+	// @Description Moves to perform, in order (required, at most 1000). A path may appear in only one move.
+	Moves []StorageMove `json:"moves"`
+	// @Description Stop at the first failed move and move everything already moved back where it was
+	// @Example false
+	AllOrNothing bool `json:"allOrNothing,omitempty"`
+}
+
+// StorageMoveResult reports the outcome of one move in a batch
+// @Description Outcome of one move
+type StorageMoveResult struct {
+	// @Description Source path as requested
+	Source string `json:"source"`
+	// @Description Destination path as requested
+	Destination string `json:"destination"`
+	// @Description Whether the file is now at the destination
+	Success bool `json:"success"`
+	// @Description Whether the move was done and then undone because a later move failed (allOrNothing)
+	RolledBack bool `json:"rolledBack,omitempty"`
+	// @Description Why the move was rejected, failed or not attempted
+	Error string `json:"error,omitempty"`
+}
+
+// StorageMoveBatchResponse represents the outcome of a batch move
+// @Description Per-move results of a batch move
+type StorageMoveBatchResponse struct {
+	// @Description Whether every move succeeded
+	Success bool `json:"success"`
+	// @Description One result per requested move, in request order
+	Results []StorageMoveResult `json:"results,omitempty"`
+	// @Description Error message if the request as a whole was rejected
+	Error string `json:"error,omitempty"`
+}
+
+// StorageBatchReadRequest represents a request to read several files at once
+// @Description Files to read in one request
+type StorageBatchReadRequest struct {
+	// @Description File paths relative to the storage directory (required, at most 100)
+	// @Example ["/dashboard/cpu.json", "/dashboard/disk.json"]
+	Paths []string `json:"paths"`
+}
+
+// StorageBatchReadResponse represents the files read by a batch read
+// @Description Content or error of each requested file
+type StorageBatchReadResponse struct {
+	// @Description Whether every file was read
+	Success bool `json:"success"`
+	// @Description One entry per requested path, keyed by the path as requested, shaped like a GET /api/storage response
+	Files map[string]StorageResponse `json:"files,omitempty"`
+	// @Description Error message if the request as a whole was rejected
+	Error string `json:"error,omitempty"`
+}
+
+// StorageGCRequest represents a request to delete old files
+// @Description Which old files to delete
+type StorageGCRequest struct {
+	// @Description Directory to clean up, relative to the storage directory; "/" for all of it
+	// @Example "/exports"
+	Path string `json:"path"`
+	// @Description Delete files last modified more than this many days ago (required, may be fractional)
+	// @Example 30
+	OlderThanDays float64 `json:"olderThanDays"`
+	// @Description Only list the files that would be deleted
+	// @Example true
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// StorageGCResponse represents the outcome of deleting old files
+// @Description Files deleted by a garbage collection
+type StorageGCResponse struct {
+	// @Description Whether every old file was deleted
+	Success bool `json:"success"`
+	// @Description Whether this was a dry run that deleted nothing
+	DryRun bool `json:"dryRun,omitempty"`
+	// @Description Files deleted (or that would be, for a dry run), relative to the storage directory
+	// @Example ["/exports/2024-01-01.csv"]
+	Removed []string `json:"removed,omitempty"`
+	// @Description Old files that could not be deleted
+	Failed []string `json:"failed,omitempty"`
+	// @Description Total size of the removed files in bytes
+	// @Example 1048576
+	FreedBytes int64 `json:"freedBytes"`
+	// @Description Error message if the request as a whole failed
+	Error string `json:"error,omitempty"`
+}
+
+// StorageDiffResponse represents a preview of the changes a save would make
+// @Description Unified diff between a stored file and proposed content
+type StorageDiffResponse struct {
+	// @Description Whether the diff was computed
+	Success bool `json:"success"`
+	// @Description Whether the proposed content differs from the file
+	Changed bool `json:"changed"`
+	// @Description Whether the file doesn't exist yet, so saving would create it
+	NewFile bool `json:"newFile,omitempty"`
+	// @Description Unified diff from the current file to the proposed content; empty when unchanged
+	// @Example "--- a/config.yaml\n+++ b/config.yaml\n@@ -1 +1 @@\n-port: 5432\n+port: 6432\n"
+	Diff string `json:"diff"`
 }
 
 // UpdateRequest represents the request to self-update the running binary
@@ -255,6 +1050,45 @@ type ReminderErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// RootResponse describes the server and the routes it serves
+// @Description Server version and registered routes
+type RootResponse struct {
+	// @Description Server name
+	// @Example "mowa"
+	Name string `json:"name"`
+	// @Description Server version
+	// @Example "v1.2.0"
+	Version string `json:"version"`
+	// @Description Operator-configured banner (server.banner), omitted when unset
+	// @Example "staging - mac-mini-2"
+	Banner string `json:"banner,omitempty"`
+	// @Description Registered routes, sorted by path
+	Routes []RouteDescription `json:"routes"`
+}
+
+// RouteDescription is one registered path and the methods it accepts
+// @Description A registered route
+type RouteDescription struct {
+	// @Description Route path, with Echo-style parameters
+	// @Example "/api/reminders/:id"
+	Path string `json:"path"`
+	// @Description HTTP methods registered for the path, sorted
+	// @Example ["DELETE","PATCH"]
+	Methods []string `json:"methods"`
+}
+
+// ErrorResponse is the body of errors not produced by a handler itself, such as
+// an unknown route (404) or an unsupported method (405)
+// @Description Generic error response
+type ErrorResponse struct {
+	// @Description Human-readable error message
+	// @Example "Not Found"
+	Error string `json:"error"`
+	// @Description ID of the request, also sent as X-Request-Id and logged with any internal error
+	// @Example "Ztu0hxGgvSbMAUMUPJzCNFYVBbTmtVvW"
+	RequestID string `json:"requestId,omitempty"`
+}
+
 // MowaError represents custom errors
 // @Description Custom error response
 type MowaError struct {
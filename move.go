@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxBatchMoves caps the number of moves in one batch request.
+const maxBatchMoves = 1000
+
+// errMoveDestinationExists is returned when something appeared at a move's
+// destination between validation and the move itself.
+var errMoveDestinationExists = errors.New("destination already exists")
+
+// resolvedMove is a validated move with both paths resolved inside the storage
+// directory.
+type resolvedMove struct {
+	source      string
+	destination string
+}
+
+// @Summary Move files in a batch
+// @Description Move or rename many files and directories inside the storage directory in one request. Every move is validated before anything is moved: sources must exist, destinations must not, and no path may appear in more than one move; if any move is invalid, nothing is moved and the response is 400 with the reason on each invalid move. Moves then run in order, creating missing parent directories, and each gets its own result. By default a failed move doesn't stop the others. With allOrNothing, the first failure stops the batch and every completed move is reversed (best effort: a move that can't be undone is reported in its result).
+// @Tags storage
+// @Accept json
+// @Produce json
+// @Param request body StorageMoveBatchRequest true "Moves to perform"
+// @Success 200 {object} StorageMoveBatchResponse "Moves attempted; see success and the per-move results"
+// @Failure 400 {object} StorageMoveBatchResponse "Bad request - invalid body, or at least one invalid move (nothing was moved)"
+// @Router /api/storage/move-batch [post]
+func handleStorageMoveBatch(c echo.Context) error {
+	var req StorageMoveBatchRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageMoveBatchResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if len(req.Moves) == 0 {
+		return c.JSON(http.StatusBadRequest, StorageMoveBatchResponse{
+			Success: false,
+			Error:   "moves is required",
+		})
+	}
+	if len(req.Moves) > maxBatchMoves {
+		return c.JSON(http.StatusBadRequest, StorageMoveBatchResponse{
+			Success: false,
+			Error:   fmt.Sprintf("at most %d moves are allowed per request", maxBatchMoves),
+		})
+	}
+
+	results := make([]StorageMoveResult, len(req.Moves))
+	for i, move := range req.Moves {
+		results[i] = StorageMoveResult{Source: move.Source, Destination: move.Destination}
+	}
+
+	moves, invalid := planMoves(c, req.Moves, results)
+	if invalid > 0 {
+		return c.JSON(http.StatusBadRequest, StorageMoveBatchResponse{
+			Success: false,
+			Results: results,
+			Error:   fmt.Sprintf("%d of %d moves are invalid; nothing was moved", invalid, len(req.Moves)),
+		})
+	}
+
+	// Hold every involved path for the whole batch, in sorted order so two
+	// overlapping batches can't deadlock, and so a rollback isn't raced.
+	var paths []string
+	for _, move := range moves {
+		paths = append(paths, move.source, move.destination)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		unlock := storageLocks.lock(path)
+		defer unlock()
+	}
+
+	success := true
+	for i, move := range moves {
+		err := moveStorageEntry(move.source, move.destination)
+		if err == nil {
+			results[i].Success = true
+			continue
+		}
+
+		success = false
+		switch {
+		case errors.Is(err, errMoveDestinationExists):
+			results[i].Error = "destination already exists"
+		case os.IsNotExist(err):
+			results[i].Error = "source not found"
+		default:
+			logErrorf("Failed to move %s to %s: %v", move.source, move.destination, err)
+			results[i].Error = "failed to move"
+		}
+
+		if req.AllOrNothing {
+			rollbackMoves(moves[:i], results[:i])
+			for j := i + 1; j < len(moves); j++ {
+				results[j].Error = "not attempted: an earlier move failed"
+			}
+			break
+		}
+	}
+
+	return c.JSON(http.StatusOK, StorageMoveBatchResponse{
+		Success: success,
+		Results: results,
+	})
+}
+
+// planMoves validates every move before any is made, recording the reason for
+// each invalid one in results. It returns the resolved moves and the number of
+// invalid ones.
+func planMoves(c echo.Context, requested []StorageMove, results []StorageMoveResult) ([]resolvedMove, int) {
+	storageDir, _ := filepath.Abs(storageRoot(c))
+
+	moves := make([]resolvedMove, len(requested))
+	seen := make(map[string]bool)
+	invalid := 0
+	for i, move := range requested {
+		if reason := checkMove(c, move, storageDir, seen, &moves[i]); reason != "" {
+			results[i].Error = reason
+			invalid++
+		}
+	}
+	return moves, invalid
+}
+
+// checkMove validates one move and resolves it into out, returning why it is
+// invalid or "" when it is fine. seen collects the paths of earlier moves so
+// no path is used twice in a batch.
+func checkMove(c echo.Context, move StorageMove, storageDir string, seen map[string]bool, out *resolvedMove) string {
+	if move.Source == "" || move.Destination == "" {
+		return "source and destination are required"
+	}
+
+	source, err := validateAndResolvePath(c, move.Source)
+	if err != nil {
+		return "source: " + httpErrorMessage(err)
+	}
+	destination, err := validateAndResolvePath(c, move.Destination)
+	if err != nil {
+		return "destination: " + httpErrorMessage(err)
+	}
+	*out = resolvedMove{source: source, destination: destination}
+
+	switch {
+	case source == storageDir:
+		return "the storage directory itself cannot be moved"
+	case source == destination:
+		return "source and destination are the same"
+	case strings.HasPrefix(destination, source+string(filepath.Separator)):
+		return "a directory cannot be moved into itself"
+	case seen[source] || seen[destination]:
+		return "a path may appear in only one move"
+	}
+	seen[source] = true
+	seen[destination] = true
+
+	if _, err := os.Lstat(source); err != nil {
+		return "source not found"
+	}
+	if _, err := os.Lstat(destination); err == nil {
+		return "destination already exists"
+	}
+	return ""
+}
+
+// httpErrorMessage returns the message of a validateAndResolvePath error.
+func httpErrorMessage(err error) string {
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		if msg, ok := httpErr.Message.(string); ok {
+			return msg
+		}
+	}
+	return err.Error()
+}
+
+// moveStorageEntry moves a file or directory to destination, creating its
+// missing parents, carries over any expiries and download counts and drops
+// both paths from the file cache. It never
+// replaces an existing destination.
+func moveStorageEntry(source, destination string) error {
+	if _, err := os.Lstat(destination); err == nil {
+		return errMoveDestinationExists
+	}
+	if _, err := os.Lstat(source); err != nil {
+		return err
+	}
+	if err := mkdirStorage(filepath.Dir(destination)); err != nil {
+		return err
+	}
+	defer invalidateCachedFile(source)
+	defer invalidateCachedFile(destination)
+	if err := os.Rename(source, destination); err != nil {
+		return err
+	}
+	storageExpiry.move(source, destination)
+	storageDownloads.move(source, destination)
+	return nil
+}
+
+// rollbackMoves undoes completed moves, newest first, updating their results.
+// Parent directories created for a destination are left in place.
+func rollbackMoves(moves []resolvedMove, results []StorageMoveResult) {
+	for i := len(moves) - 1; i >= 0; i-- {
+		if !results[i].Success {
+			continue
+		}
+		if err := moveStorageEntry(moves[i].destination, moves[i].source); err != nil {
+			logErrorf("Failed to move %s back to %s: %v", moves[i].destination, moves[i].source, err)
+			results[i].Error = "a later move failed, and this move could not be undone"
+			continue
+		}
+		results[i].Success = false
+		results[i].RolledBack = true
+		results[i].Error = "undone because a later move failed"
+	}
+}
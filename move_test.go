@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// doMoveBatch posts body to the batch move handler and decodes the response.
+func doMoveBatch(t *testing.T, body string) (int, StorageMoveBatchResponse) {
+	t.Helper()
+	rec := doStorageJSON(t, handleStorageMoveBatch, http.MethodPost, "/api/storage/move-batch", body)
+	var resp StorageMoveBatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+// writeStorageFiles creates the named files (relative to dir) with their names
+// as content.
+func writeStorageFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// assertExists fails unless each name (relative to dir) exists, or doesn't
+// when want is false.
+func assertExists(t *testing.T, dir string, want bool, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		_, err := os.Lstat(filepath.Join(dir, name))
+		if got := err == nil; got != want {
+			t.Errorf("%s exists = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestHandleStorageMoveBatch(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "a.txt", "b.txt", "photos/1.jpg")
+
+	code, resp := doMoveBatch(t, `{"moves": [
+		{"source": "/a.txt", "destination": "/archive/2024/a.txt"},
+		{"source": "/b.txt", "destination": "/b-renamed.txt"},
+		{"source": "/photos", "destination": "/archive/photos"}
+	]}`)
+	if code != http.StatusOK || !resp.Success || len(resp.Results) != 3 {
+		t.Fatalf("got %d %+v, want 200 and three successes", code, resp)
+	}
+	for _, result := range resp.Results {
+		if !result.Success || result.Error != "" {
+			t.Errorf("result %+v, want success", result)
+		}
+	}
+	assertExists(t, dir, true, "archive/2024/a.txt", "b-renamed.txt", "archive/photos/1.jpg")
+	assertExists(t, dir, false, "a.txt", "b.txt", "photos")
+}
+
+// TestHandleStorageMoveBatchValidation checks a batch with any invalid move is
+// rejected as a whole, with the reason on each invalid move.
+func TestHandleStorageMoveBatchValidation(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "a.txt", "b.txt", "taken.txt", "dir/x.txt")
+
+	code, resp := doMoveBatch(t, `{"moves": [
+		{"source": "/a.txt", "destination": "/moved.txt"},
+		{"source": "/missing.txt", "destination": "/m.txt"},
+		{"source": "/b.txt", "destination": "/taken.txt"},
+		{"source": "/../etc/passwd", "destination": "/p.txt"},
+		{"source": "/dir", "destination": "/dir/sub"},
+		{"source": "/taken.txt", "destination": "/moved.txt"},
+		{"source": "/b.txt", "destination": ""}
+	]}`)
+	if code != http.StatusBadRequest || resp.Success {
+		t.Fatalf("got %d %+v, want 400", code, resp)
+	}
+	wantErrors := []string{
+		"",
+		"source not found",
+		"destination already exists",
+		"source: invalid path: contains forbidden characters or directory traversal",
+		"a directory cannot be moved into itself",
+		"a path may appear in only one move",
+		"source and destination are required",
+	}
+	for i, want := range wantErrors {
+		if resp.Results[i].Error != want {
+			t.Errorf("move %d error = %q, want %q", i, resp.Results[i].Error, want)
+		}
+	}
+	assertExists(t, dir, true, "a.txt", "b.txt", "taken.txt")
+	assertExists(t, dir, false, "moved.txt")
+
+	for _, body := range []string{`{}`, `{"moves": []}`, `not json`} {
+		if code, _ := doMoveBatch(t, body); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, code)
+		}
+	}
+}
+
+// TestHandleStorageMoveBatchPartialFailure checks a failed move doesn't stop
+// the rest by default, and that allOrNothing undoes the completed moves.
+func TestHandleStorageMoveBatchPartialFailure(t *testing.T) {
+	// A file where the destination's parent directory should go makes the
+	// second move fail only once it is attempted.
+	body := func(allOrNothing bool) string {
+		flag := ""
+		if allOrNothing {
+			flag = `, "allOrNothing": true`
+		}
+		return `{"moves": [
+			{"source": "/a.txt", "destination": "/new/a.txt"},
+			{"source": "/b.txt", "destination": "/blocker/b.txt"},
+			{"source": "/c.txt", "destination": "/new/c.txt"}
+		]` + flag + `}`
+	}
+
+	t.Run("best effort", func(t *testing.T) {
+		dir := useTempStorage(t)
+		writeStorageFiles(t, dir, "a.txt", "b.txt", "c.txt", "blocker")
+
+		code, resp := doMoveBatch(t, body(false))
+		if code != http.StatusOK || resp.Success {
+			t.Fatalf("got %d %+v, want 200 and success false", code, resp)
+		}
+		if !resp.Results[0].Success || resp.Results[1].Success || resp.Results[1].Error != "failed to move" || !resp.Results[2].Success {
+			t.Errorf("results %+v, want only the second move to fail", resp.Results)
+		}
+		assertExists(t, dir, true, "new/a.txt", "b.txt", "new/c.txt")
+	})
+
+	t.Run("all or nothing", func(t *testing.T) {
+		dir := useTempStorage(t)
+		writeStorageFiles(t, dir, "a.txt", "b.txt", "c.txt", "blocker")
+
+		code, resp := doMoveBatch(t, body(true))
+		if code != http.StatusOK || resp.Success {
+			t.Fatalf("got %d %+v, want 200 and success false", code, resp)
+		}
+		first, third := resp.Results[0], resp.Results[2]
+		if first.Success || !first.RolledBack {
+			t.Errorf("first move %+v, want rolled back", first)
+		}
+		if third.Success || third.Error != "not attempted: an earlier move failed" {
+			t.Errorf("third move %+v, want not attempted", third)
+		}
+		assertExists(t, dir, true, "a.txt", "b.txt", "c.txt")
+		assertExists(t, dir, false, "new/a.txt", "new/c.txt")
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// responseFormat is how an endpoint that can answer either way responds: a
+// structured JSON object, or the bare value (plain text or raw file content).
+type responseFormat int
+
+const (
+	formatJSON responseFormat = iota
+	formatPlain
+)
+
+// negotiateFormat picks the response format from the request's Accept header,
+// and notes in Vary that it did. application/json asks for JSON; text/plain or
+// application/octet-stream for the bare value; the higher q-value wins.
+// Wildcards such as */* state no preference, so without an explicit one the
+// endpoint's usual format, fallback, is kept.
+func negotiateFormat(c echo.Context, fallback responseFormat) responseFormat {
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+
+	jsonQ, plainQ := -1.0, -1.0
+	for _, part := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case echo.MIMEApplicationJSON:
+			jsonQ = max(jsonQ, q)
+		case echo.MIMETextPlain, echo.MIMEOctetStream:
+			plainQ = max(plainQ, q)
+		}
+	}
+
+	switch {
+	case jsonQ > plainQ && jsonQ > 0:
+		return formatJSON
+	case plainQ > jsonQ && plainQ > 0:
+		return formatPlain
+	}
+	return fallback
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := []struct {
+		accept   string
+		fallback responseFormat
+		want     responseFormat
+	}{
+		{"", formatJSON, formatJSON},
+		{"", formatPlain, formatPlain},
+		{"*/*", formatPlain, formatPlain},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", formatPlain, formatPlain},
+		{"application/json", formatPlain, formatJSON},
+		{"text/plain", formatJSON, formatPlain},
+		{"application/octet-stream", formatJSON, formatPlain},
+		{"text/plain;q=0.5, application/json", formatPlain, formatJSON},
+		{"application/json;q=0.2, text/plain;q=0.9", formatJSON, formatPlain},
+		{"application/json, text/plain", formatPlain, formatPlain},
+		{"application/json;q=0", formatPlain, formatPlain},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAccept, tc.accept)
+		rec := httptest.NewRecorder()
+		if got := negotiateFormat(echo.New().NewContext(req, rec), tc.fallback); got != tc.want {
+			t.Errorf("Accept %q (fallback %d): got %d, want %d", tc.accept, tc.fallback, got, tc.want)
+		}
+		if rec.Header().Get(echo.HeaderVary) != echo.HeaderAccept {
+			t.Errorf("Accept %q: Vary = %q, want Accept", tc.accept, rec.Header().Get(echo.HeaderVary))
+		}
+	}
+}
+
+func TestStorageAcceptNegotiation(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(target, body, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		e := echo.New()
+		e.GET("/api/storage", handleStorage)
+		e.GET("/api/storage/*", handleStorageWithPath)
+		req := httptest.NewRequest(http.MethodGet, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAccept, accept)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/api/storage/notes.txt", "", "application/json")
+	var resp StorageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || !resp.Success || resp.Content != "hello" {
+		t.Errorf("URL path with Accept JSON: got %d %s, want the structured response", rec.Code, rec.Body)
+	}
+	if rec := serve("/api/storage/notes.txt", "", "*/*"); rec.Body.String() != "hello" {
+		t.Errorf("URL path with */*: got %s, want the raw content", rec.Body)
+	}
+
+	if rec := serve("/api/storage", `{"path":"/notes.txt"}`, "text/plain"); rec.Body.String() != "hello" {
+		t.Errorf("JSON payload with Accept text/plain: got %s, want the raw content", rec.Body)
+	}
+	// JSON-only options keep the structured response.
+	rec = serve("/api/storage", `{"path":"/notes.txt","tail":1}`, "text/plain")
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Content != "hello" {
+		t.Errorf("tail with Accept text/plain: got %d %s, want the structured response", rec.Code, rec.Body)
+	}
+}
+
+func TestGetUptimePlainText(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/uptime", nil)
+	req.Header.Set(echo.HeaderAccept, "text/plain")
+	rec := httptest.NewRecorder()
+	if err := handleGetUptime(echo.New().NewContext(req, rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code == http.StatusOK && (strings.HasPrefix(rec.Body.String(), "{") || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), echo.MIMETextPlain)) {
+		t.Errorf("got %s %q, want the formatted uptime as plain text", rec.Header().Get(echo.HeaderContentType), rec.Body)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Notifier delivers a notification message to recipients, reporting the
+// outcome per recipient like sendMessages does.
+type Notifier interface {
+	Notify(recipients []string, message string) []MessageResult
+}
+
+// Notifier backends selectable with storage.notifier.
+const (
+	notifierIMessage = "imessage"
+	notifierWebhook  = "webhook"
+	notifierLog      = "log"
+	notifierEmail    = "email"
+)
+
+// defaultWebhookTimeoutSeconds bounds a single webhook notification POST when
+// storage.webhook_timeout_seconds is not set.
+const defaultWebhookTimeoutSeconds = 10
+
+// webhookRetryDelay is the pause before the first webhook retry; it doubles
+// with every further attempt. A variable so tests can shorten it.
+var webhookRetryDelay = time.Second
+
+// storageNotifier sends storage operation notifications. It defaults to
+// iMessage and is replaced at startup by initStorageNotifier, or by tests with
+// a fake.
+var storageNotifier Notifier = imessageNotifier{}
+
+// initStorageNotifier sets storageNotifier from storage.notifier.
+func initStorageNotifier() error {
+	notifier, err := newNotifier(appConfig.Storage)
+	if err != nil {
+		return err
+	}
+	storageNotifier = notifier
+	return nil
+}
+
+// newNotifier builds the notifier backend selected by cfg.
+func newNotifier(cfg StorageConfig) (Notifier, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Notifier)) {
+	case "", notifierIMessage:
+		return imessageNotifier{}, nil
+	case notifierWebhook:
+		if strings.TrimSpace(cfg.WebhookURL) == "" {
+			return nil, fmt.Errorf("storage.notifier is %q but storage.webhook_url is not set", notifierWebhook)
+		}
+		timeout := cfg.WebhookTimeoutSeconds
+		if timeout <= 0 {
+			timeout = defaultWebhookTimeoutSeconds
+		}
+		return webhookNotifier{
+			url:     cfg.WebhookURL,
+			headers: cfg.WebhookHeaders,
+			retries: cfg.WebhookRetries,
+			client:  &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		}, nil
+	case notifierLog:
+		return logNotifier{}, nil
+	case notifierEmail:
+		if appConfig == nil || !appConfig.Email.isEnabled() {
+			return nil, fmt.Errorf("storage.notifier is %q but email.host is not set", notifierEmail)
+		}
+		return emailNotifier{}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage.notifier %q (expected %s, %s, %s or %s)", cfg.Notifier, notifierIMessage, notifierWebhook, notifierLog, notifierEmail)
+	}
+}
+
+// imessageNotifier sends notifications through the Messages app, or by email
+// to email addresses when email is configured.
+type imessageNotifier struct{}
+
+func (imessageNotifier) Notify(recipients []string, message string) []MessageResult {
+	return sendMessages(recipients, message)
+}
+
+// webhookNotifier POSTs each notification as JSON ({"recipients": [...],
+// "message": "..."}) to a URL, with any configured extra headers (e.g. for
+// authentication). Delivery is a single request, retried up to retries times
+// on transient failures, so every recipient shares its outcome.
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+	retries int
+	client  *http.Client
+}
+
+func (w webhookNotifier) Notify(recipients []string, message string) []MessageResult {
+	err := w.post(recipients, message)
+	delay := webhookRetryDelay
+	for attempt := 1; attempt <= w.retries && err != nil && isTransientWebhookError(err); attempt++ {
+		logWarnf("Webhook notification failed (%v); retrying in %s (%d/%d)", err, delay, attempt, w.retries)
+		time.Sleep(delay)
+		delay *= 2
+		err = w.post(recipients, message)
+	}
+
+	results := make([]MessageResult, 0, len(recipients))
+	for _, recipient := range recipients {
+		result := MessageResult{Recipient: recipient, Success: err == nil}
+		if err != nil {
+			errorMsg := err.Error()
+			result.Error = &errorMsg
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (w webhookNotifier) post(recipients []string, message string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"recipients": recipients,
+		"message":    message,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range w.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return &webhookError{err: fmt.Errorf("webhook request failed: %w", err), transient: true}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &webhookError{
+			err:       fmt.Errorf("webhook returned %d", resp.StatusCode),
+			transient: resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		}
+	}
+	return nil
+}
+
+// webhookError is a failed webhook delivery. Network errors, 5xx responses
+// and 429 Too Many Requests are transient and worth retrying; other responses
+// (e.g. 401 for a bad token) will fail the same way again.
+type webhookError struct {
+	err       error
+	transient bool
+}
+
+func (e *webhookError) Error() string { return e.err.Error() }
+
+func (e *webhookError) Unwrap() error { return e.err }
+
+// isTransientWebhookError reports whether a webhook delivery may succeed when
+// retried.
+func isTransientWebhookError(err error) bool {
+	var webhookErr *webhookError
+	return errors.As(err, &webhookErr) && webhookErr.transient
+}
+
+// logNotifier only writes notifications to the log, which is useful on hosts
+// without Messages or to dry-run notification settings.
+type logNotifier struct{}
+
+func (logNotifier) Notify(recipients []string, message string) []MessageResult {
+	results := make([]MessageResult, 0, len(recipients))
+	for _, recipient := range recipients {
+		logInfof("Notification for %s: %s", recipient, message)
+		results = append(results, MessageResult{Recipient: recipient, Success: true})
+	}
+	return results
+}
+
+// defaultStorageNotifyTemplate renders storage notifications when
+// storage.notify_template is not set, e.g. "report.txt saved successfully" or
+// "Failed to GET report.txt: find file".
+const defaultStorageNotifyTemplate = `{{if .Success}}{{.FileName}} {{.Message}}{{else}}Failed to {{.Operation}} {{.FileName}}: {{.Message}}{{end}}`
+
+// storageNotification is what a storage notification template is rendered
+// with.
+type storageNotification struct {
+	// FileName is the base name of the file, e.g. "report.txt".
+	FileName string
+	// Path is the file's path within the storage directory of the request
+	// (see storageRoot), e.g. "/docs/report.txt".
+	Path string
+	// Operation is the storage operation, e.g. "GET", "POST" or "PATCH".
+	Operation string
+	// Success reports whether the operation succeeded.
+	Success bool
+	// Message is the outcome, e.g. "saved successfully", or on failure what
+	// could not be done, e.g. "find file".
+	Message string
+	// Time is when the notification was sent.
+	Time time.Time
+	// Host is this machine's hostname.
+	Host string
+}
+
+// parseNotifyTemplate parses a storage.notify_template and renders it once
+// with sample values, so a reference to a field storageNotification doesn't
+// have is rejected at load time rather than on the first notification.
+func parseNotifyTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("notify_template").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, storageNotification{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// formatStorageNotification renders the notification for an operation on the
+// file at path, relative to the request's storage directory, with the
+// operation's storage.notify_messages template, or else
+// storage.notify_template, falling back to the default wording if the
+// configured template can't be rendered.
+func formatStorageNotification(operation, path string, success bool, message string) string {
+	text := defaultStorageNotifyTemplate
+	if appConfig != nil {
+		if perOperation, ok := appConfig.Storage.NotifyMessages[operation]; ok {
+			text = perOperation
+		} else if appConfig.Storage.NotifyTemplate != "" {
+			text = appConfig.Storage.NotifyTemplate
+		}
+	}
+
+	data := storageNotification{
+		FileName:  filepath.Base(path),
+		Path:      path,
+		Operation: operation,
+		Success:   success,
+		Message:   message,
+		Time:      time.Now(),
+		Host:      heartbeatHostname(),
+	}
+
+	var out strings.Builder
+	tmpl, err := parseNotifyTemplate(text)
+	if err == nil {
+		err = tmpl.Execute(&out, data)
+	}
+	if err != nil {
+		logWarnf("Failed to render the %s notification template, using the default: %v", operation, err)
+		out.Reset()
+		template.Must(template.New("default").Parse(defaultStorageNotifyTemplate)).Execute(&out, data)
+	}
+	return out.String()
+}
+
+// storageRelativePath returns fullPath as a path within the storage
+// directory, with a leading slash, or fullPath itself if it lies outside it.
+func storageRelativePath(fullPath string) string {
+	if appConfig == nil {
+		return fullPath
+	}
+	return relativePathIn(appConfig.Storage.Dir, fullPath)
+}
+
+// requestRelativePath is storageRelativePath within the request's storage
+// directory (see storageRoot), as the client addresses files.
+func requestRelativePath(c echo.Context, fullPath string) string {
+	return relativePathIn(storageRoot(c), fullPath)
+}
+
+// relativePathIn returns fullPath as a path within dir, with a leading slash,
+// or fullPath itself if it lies outside it.
+func relativePathIn(dir, fullPath string) string {
+	storageDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fullPath
+	}
+	rel, err := filepath.Rel(storageDir, fullPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return fullPath
+	}
+	if rel == "." {
+		return "/"
+	}
+	return "/" + filepath.ToSlash(rel)
+}
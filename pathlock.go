@@ -0,0 +1,44 @@
+package main
+
+import "sync"
+
+// pathLocks serializes writes to the same storage path while letting writes to
+// different paths run in parallel. Entries are reference-counted and dropped
+// once nobody holds or waits for them, so the map only ever holds paths with a
+// write in flight.
+type pathLocks struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// storageLocks guards every read-modify-write of a stored file (save, patch),
+// keyed by its resolved absolute path.
+var storageLocks = &pathLocks{locks: make(map[string]*pathLock)}
+
+// lock blocks until path is free and returns the function that releases it.
+func (p *pathLocks) lock(path string) (unlock func()) {
+	p.mu.Lock()
+	l, ok := p.locks[path]
+	if !ok {
+		l = &pathLock{}
+		p.locks[path] = l
+	}
+	l.refs++
+	p.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		p.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(p.locks, path)
+		}
+		p.mu.Unlock()
+	}
+}
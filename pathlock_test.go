@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentPatchesSamePath fires many PATCHes at one file at once. Each
+// inserts one "x" before END, so any lost update shows up as a missing x.
+func TestConcurrentPatchesSamePath(t *testing.T) {
+	dir := useTempStorage(t)
+	path := filepath.Join(dir, "counter.txt")
+	if err := os.WriteFile(path, []byte("END"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := doStorageJSON(t, handleStoragePatch, http.MethodPatch, "/api/storage", `{"path":"/counter.txt","find":"END","replace":"xEND"}`)
+			if rec.Code != http.StatusOK {
+				t.Errorf("patch: status %d: %s", rec.Code, rec.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("x", writers) + "END"; string(got) != want {
+		t.Errorf("got %d updates, want %d", strings.Count(string(got), "x"), writers)
+	}
+	if n := len(storageLocks.locks); n != 0 {
+		t.Errorf("%d path locks left behind", n)
+	}
+}
+
+// TestPathLocksIndependentPaths checks a held lock on one path does not block
+// another path, but does block the same path.
+func TestPathLocksIndependentPaths(t *testing.T) {
+	locks := &pathLocks{locks: make(map[string]*pathLock)}
+	unlockA := locks.lock("/a")
+
+	done := make(chan struct{})
+	go func() {
+		locks.lock("/b")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock on /b blocked behind /a")
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		locks.lock("/a")()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second lock on /a acquired while the first was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlockA()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second lock on /a never acquired after unlock")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Default permissions for directories and files created in storage, used when
+// storage.dir_mode / storage.file_mode are not set.
+const (
+	defaultStorageDirMode  os.FileMode = 0755
+	defaultStorageFileMode os.FileMode = 0644
+)
+
+// parseFileMode parses an octal permission string such as "0775" or "700".
+// Only permission bits are accepted; setuid, setgid and sticky are not.
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an octal mode", s)
+	}
+	if mode > 0777 {
+		return 0, fmt.Errorf("%q has bits outside 0777", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// storageDirMode returns the permissions for directories created in storage.
+func storageDirMode() os.FileMode {
+	if appConfig != nil && appConfig.Storage.dirMode != 0 {
+		return appConfig.Storage.dirMode
+	}
+	return defaultStorageDirMode
+}
+
+// storageFileMode returns the permissions for files written to storage.
+func storageFileMode() os.FileMode {
+	if appConfig != nil && appConfig.Storage.fileMode != 0 {
+		return appConfig.Storage.fileMode
+	}
+	return defaultStorageFileMode
+}
+
+// mkdirStorage creates dir and any missing parents with storageDirMode. The
+// new directories are chmod'ed afterwards so the configured mode applies
+// exactly, rather than being narrowed by the process umask.
+func mkdirStorage(dir string) error {
+	var missing []string
+	for p := dir; ; p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); !os.IsNotExist(err) {
+			break
+		}
+		missing = append(missing, p)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+
+	mode := storageDirMode()
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	for _, p := range missing {
+		if err := os.Chmod(p, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStorageFileAtomic replaces path with data by writing a temporary file
+// in the same directory and renaming it over the original, so readers see
+// either the old content or the new, never a partial write.
+func writeStorageFileAtomic(path string, data []byte) error {
+	// With file locks on, hold the original exclusively until it has been
+	// replaced, so cooperating readers finish with the old content first.
+	if appConfig != nil && appConfig.Storage.UseFileLocks {
+		if old, err := openLockedFile(path, os.O_WRONLY, 0); err == nil {
+			defer old.Close()
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, storageFileMode()); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// writeStorageFile writes data to path with storageFileMode, applied with an
+// explicit chmod for the same umask reason as mkdirStorage. The file is only
+// truncated once any configured file lock is held.
+func writeStorageFile(path string, data []byte) error {
+	mode := storageFileMode()
+	f, err := openLockedFile(path, os.O_WRONLY|os.O_CREATE, mode)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// parseTrustedProxies turns server.trusted_proxies entries, each an IP address
+// or a CIDR range, into networks. A bare address trusts just that host.
+func parseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", entry)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
+
+// newIPExtractor decides how the client IP (the access log's remote_ip, and
+// anything else using RealIP) is determined. Without trusted proxies it is the
+// direct peer address and X-Forwarded-For is ignored, since any client could
+// forge it. With them, X-Forwarded-For is followed back through the trusted
+// proxies only; Echo's default trust of loopback and private ranges is turned
+// off so only what is configured counts.
+func newIPExtractor(cfg ServerConfig) (echo.IPExtractor, error) {
+	proxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range proxies {
+		options = append(options, echo.TrustIPRange(proxy))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
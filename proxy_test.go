@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewIPExtractor(t *testing.T) {
+	request := func(remote, xff string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote + ":54321"
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		return req
+	}
+
+	direct, err := newIPExtractor(ServerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without trusted proxies a forged header is ignored, even from loopback.
+	if got := direct(request("127.0.0.1", "203.0.113.7")); got != "127.0.0.1" {
+		t.Errorf("no trusted proxies: client IP = %s, want 127.0.0.1", got)
+	}
+
+	proxied, err := newIPExtractor(ServerConfig{TrustedProxies: []string{"10.0.0.5", "192.168.1.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct{ remote, xff, want string }{
+		{"10.0.0.5", "203.0.113.7", "203.0.113.7"},               // trusted proxy
+		{"192.168.1.20", "203.0.113.7, 10.0.0.5", "203.0.113.7"}, // chain of trusted proxies
+		{"10.0.0.6", "203.0.113.7", "10.0.0.6"},                  // not a trusted proxy
+		{"127.0.0.1", "203.0.113.7", "127.0.0.1"},                // loopback not trusted implicitly
+		{"10.0.0.5", "198.51.100.1, 203.0.113.7", "203.0.113.7"}, // spoofed left-most entry ignored
+	}
+	for _, tc := range cases {
+		if got := proxied(request(tc.remote, tc.xff)); got != tc.want {
+			t.Errorf("remote %s, XFF %q: client IP = %s, want %s", tc.remote, tc.xff, got, tc.want)
+		}
+	}
+
+	if _, err := newIPExtractor(ServerConfig{TrustedProxies: []string{"proxy.local"}}); err == nil {
+		t.Error("expected an error for a hostname")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// quotaRemainingHeader reports how many bytes of the storage quota are left
+// after a write. It is only sent when a quota is configured.
+const quotaRemainingHeader = "X-Storage-Quota-Remaining"
+
+// storageQuota tracks how many bytes the storage directory uses against the
+// configured storage.quota. Usage is computed once by walking the directory at
+// startup and then maintained incrementally on every write, so enforcing the
+// quota never requires re-walking the tree. Files changed behind mowa's back
+// are only picked up on the next restart.
+type storageQuota struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+}
+
+// storageUsage is the active quota tracker, or nil when no quota is configured.
+var storageUsage *storageQuota
+
+// initStorageQuota sets up storageUsage from the loaded config, walking the
+// storage directory to establish the current usage. A missing storage
+// directory simply means nothing is stored yet.
+func initStorageQuota() error {
+	storageUsage = nil
+	if appConfig == nil || appConfig.Storage.Quota <= 0 {
+		return nil
+	}
+
+	used, err := directorySize(appConfig.Storage.Dir)
+	if err != nil {
+		return err
+	}
+
+	storageUsage = &storageQuota{limit: appConfig.Storage.Quota, used: used}
+	logInfof("Storage quota: %d of %d bytes used", used, appConfig.Storage.Quota)
+	return nil
+}
+
+// directorySize sums the sizes of all regular files under dir.
+func directorySize(dir string) (int64, error) {
+	total, _, err := directoryUsage(dir)
+	return total, err
+}
+
+// directoryUsage sums the sizes of all regular files under dir and counts them.
+// A missing dir is empty.
+func directoryUsage(dir string) (total int64, files int, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path == dir {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		files++
+		return nil
+	})
+	return total, files, err
+}
+
+// reserve accounts for a change of delta bytes, refusing growth that would
+// push usage past the limit. Shrinking (a negative delta) always succeeds.
+func (q *storageQuota) reserve(delta int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if delta > 0 && q.used+delta > q.limit {
+		return false
+	}
+	q.used += delta
+	return true
+}
+
+// release undoes a reservation whose write did not happen.
+func (q *storageQuota) release(delta int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.used -= delta
+}
+
+// remaining returns the number of bytes still available, never negative (the
+// directory may already be over a quota lowered since the last start).
+func (q *storageQuota) remaining() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.used >= q.limit {
+		return 0
+	}
+	return q.limit - q.used
+}
+
+// setQuotaHeader reports the remaining quota on the response, if one is
+// configured. API keys with their own storage_dir aren't told, as the quota
+// is shared by all of them and what is left would reveal the others' usage.
+func setQuotaHeader(c echo.Context) {
+	if storageUsage == nil || storageRoot(c) != appConfig.Storage.Dir {
+		return
+	}
+	c.Response().Header().Set(quotaRemainingHeader, strconv.FormatInt(storageUsage.remaining(), 10))
+}
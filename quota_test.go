@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestDirectorySize(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"one": 10, "a/two": 20, "a/b/three": 30} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := directorySize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 60 {
+		t.Errorf("directorySize = %d, want 60", got)
+	}
+
+	// A storage directory that doesn't exist yet is simply empty.
+	if got, err := directorySize(filepath.Join(dir, "missing")); err != nil || got != 0 {
+		t.Errorf("missing dir: directorySize = %d, %v; want 0, nil", got, err)
+	}
+}
+
+func TestSaveFileEnforcesQuota(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.WriteFile(filepath.Join(dir, "existing.txt"), make([]byte, 6), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	appConfig.Storage.Quota = 10
+	if err := initStorageQuota(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storageUsage = nil })
+
+	// 6 used + 4 new = exactly the quota.
+	rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/new.txt","content":"abcd"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("write within quota: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(quotaRemainingHeader); got != "0" {
+		t.Errorf("remaining header = %q, want 0", got)
+	}
+
+	// Any growth now exceeds it, and nothing is written.
+	rec = doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/more.txt","content":"x"}`)
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Fatalf("write over quota: status = %d, want 507", rec.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "more.txt")); !os.IsNotExist(err) {
+		t.Errorf("rejected write left a file behind (stat err %v)", err)
+	}
+
+	// Overwriting with smaller content frees space.
+	rec = doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/existing.txt","content":"ab"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("shrinking overwrite: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(quotaRemainingHeader); got != "4" {
+		t.Errorf("remaining header after shrink = %q, want 4", got)
+	}
+}
+
+func TestStorageUsageReport(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"a.txt": 10, "sub/b.txt": 5} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	if err := handleStorageUsage(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/storage/usage", nil), rec)); err != nil {
+		t.Fatal(err)
+	}
+	var report StorageUsageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalBytes != 15 || report.Files != 2 || report.QuotaBytes != 0 {
+		t.Errorf("usage = %+v, want 15 bytes in 2 files and no quota", report)
+	}
+
+	// Within the TTL the cached report is served even after a write.
+	if err := os.WriteFile(filepath.Join(dir, "c.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if cached, _ := storageUsageReport(dir); cached.Files != 2 {
+		t.Errorf("cached files = %d, want 2", cached.Files)
+	}
+	delete(usageCache.reports, dir)
+	if fresh, _ := storageUsageReport(dir); fresh.Files != 3 || fresh.TotalBytes != 16 {
+		t.Errorf("fresh usage = %+v, want 16 bytes in 3 files", fresh)
+	}
+}
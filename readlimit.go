@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// readSlotWait is how long a storage read waits for a free slot before it is
+// turned away with 503. A variable so tests don't have to wait.
+var readSlotWait = 2 * time.Second
+
+// storageReadSlots bounds how many storage reads run at once when
+// storage.max_concurrent_reads is set; nil means unlimited.
+var storageReadSlots chan struct{}
+
+// initStorageReadLimit sets up the read limit from the configuration.
+func initStorageReadLimit() {
+	storageReadSlots = nil
+	if n := appConfig.Storage.MaxConcurrentReads; n > 0 {
+		storageReadSlots = make(chan struct{}, n)
+	}
+}
+
+// acquireReadSlot waits up to readSlotWait for a storage read slot. It returns
+// a function releasing the slot, or an error to return to the client when none
+// came free in time. Unlike server.max_concurrent_requests, a burst of reads
+// queues briefly rather than failing at once, since a read usually finishes
+// quickly.
+func acquireReadSlot(c echo.Context) (release func(), err error) {
+	if storageReadSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case storageReadSlots <- struct{}{}:
+		return func() { <-storageReadSlots }, nil
+	default:
+	}
+
+	timer := time.NewTimer(readSlotWait)
+	defer timer.Stop()
+	select {
+	case storageReadSlots <- struct{}{}:
+		return func() { <-storageReadSlots }, nil
+	case <-timer.C:
+	case <-c.Request().Context().Done():
+	}
+	c.Response().Header().Set("Retry-After", "1")
+	return nil, echo.NewHTTPError(http.StatusServiceUnavailable, "too many storage reads in progress, try again shortly")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestStorageReadLimit(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "a.txt")
+
+	appConfig.Storage.MaxConcurrentReads = 1
+	initStorageReadLimit()
+	t.Cleanup(func() {
+		appConfig.Storage.MaxConcurrentReads = 0
+		initStorageReadLimit()
+	})
+	oldWait := readSlotWait
+	readSlotWait = 10 * time.Millisecond
+	t.Cleanup(func() { readSlotWait = oldWait })
+
+	read := func() *httptest.ResponseRecorder {
+		e := echo.New()
+		e.HTTPErrorHandler = jsonErrorHandler
+		e.GET("/api/storage/*", handleStorageWithPath)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/storage/a.txt", nil))
+		return rec
+	}
+
+	// Hold the only slot, as a slow read would.
+	release, err := acquireReadSlot(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := read(); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("saturated: status %d, Retry-After %q; want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := doStorageJSON(t, handleStorageBatchRead, http.MethodPost, "/api/storage/batch-read", `{"paths":["/a.txt"]}`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("batch read while saturated: status %d, want 503", rec.Code)
+	}
+
+	// A read that comes in while the slot is held gets it once freed.
+	done := make(chan *httptest.ResponseRecorder)
+	readSlotWait = time.Minute
+	go func() { done <- read() }()
+	time.Sleep(10 * time.Millisecond)
+	release()
+	if rec := <-done; rec.Code != http.StatusOK {
+		t.Errorf("queued read: status %d, want 200", rec.Code)
+	}
+	if rec := read(); rec.Code != http.StatusOK {
+		t.Errorf("after release: status %d, want 200", rec.Code)
+	}
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -90,25 +90,21 @@ func runReminder(script string, input interface{}) (json.RawMessage, *reminderOp
 	}
 
 	timeout := reminderTimeout()
-	output, timedOut, err := runOSAScript(timeout, "-l", "JavaScript", "-e", script, argJSON)
+	output, timedOut, err := runOSAScript(context.Background(), timeout, "-l", "JavaScript", "-e", script, argJSON)
 	if timedOut {
-		log.Printf("Reminders script timed out after %s; killed osascript", timeout)
+		logWarnf("Reminders script timed out after %s; killed osascript", timeout)
 		return nil, &reminderOpError{http.StatusInternalServerError, err.Error()}
 	}
 	if err != nil {
 		// A non-zero exit here means the script threw before it could emit an
-		// envelope (e.g. TCC permission denied). Surface the raw output.
-		msg := strings.TrimSpace(string(output))
-		if msg == "" {
-			msg = err.Error()
-		}
-		log.Printf("Reminders script failed: %v; output: %s", err, msg)
-		return nil, &reminderOpError{http.StatusInternalServerError, msg}
+		// envelope (e.g. TCC permission denied). Surface its error output.
+		logWarnf("Reminders script failed: %v", err)
+		return nil, &reminderOpError{http.StatusInternalServerError, commandFailure(err)}
 	}
 
 	var env jxaEnvelope
 	if e := json.Unmarshal(bytes.TrimSpace(output), &env); e != nil {
-		log.Printf("Reminders script produced unparseable output: %s", string(output))
+		logWarnf("Reminders script produced unparseable output: %s", string(output))
 		return nil, &reminderOpError{http.StatusInternalServerError, "failed to parse Reminders output"}
 	}
 	if !env.OK {
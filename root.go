@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// routeList groups the routes registered on e by path, sorted by path, each
+// with its methods sorted. It is built on every request, so it always matches
+// what the server actually serves.
+func routeList(e *echo.Echo) []RouteDescription {
+	methods := map[string][]string{}
+	for _, r := range e.Routes() {
+		methods[r.Path] = append(methods[r.Path], r.Method)
+	}
+
+	routes := make([]RouteDescription, 0, len(methods))
+	for path, m := range methods {
+		sort.Strings(m)
+		routes = append(routes, RouteDescription{Path: path, Methods: m})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+	return routes
+}
+
+// rootHandler describes the server at /. Clients asking for JSON get the
+// banner, version and registered routes; browsers are sent to the Swagger UI
+// when it is enabled, and everything else gets the same information as plain
+// text, with the banner on top.
+func rootHandler(e *echo.Echo, swagger bool, banner string) echo.HandlerFunc {
+	banner = strings.TrimSpace(banner)
+	return func(c echo.Context) error {
+		if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) {
+			return c.JSON(http.StatusOK, RootResponse{
+				Name:    "mowa",
+				Version: version,
+				Banner:  banner,
+				Routes:  routeList(e),
+			})
+		}
+
+		if swagger {
+			return c.Redirect(http.StatusMovedPermanently, "/swagger/index.html")
+		}
+
+		var b strings.Builder
+		if banner != "" {
+			fmt.Fprintf(&b, "%s\n\n", banner)
+		}
+		fmt.Fprintf(&b, "mowa %s\n\nEndpoints:\n", version)
+		for _, r := range routeList(e) {
+			fmt.Fprintf(&b, "  %-20s %s\n", strings.Join(r.Methods, ","), r.Path)
+		}
+		return c.String(http.StatusOK, b.String())
+	}
+}
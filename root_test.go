@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRootListsRegisteredRoutes(t *testing.T) {
+	newServer := func(swagger bool) *echo.Echo {
+		e := echo.New()
+		e.GET("/", rootHandler(e, swagger, ""))
+		e.GET("/api/health", handleHealth)
+		e.PATCH("/api/reminders/:id", handleUpdateReminder)
+		e.DELETE("/api/reminders/:id", handleDeleteReminder)
+		return e
+	}
+	get := func(e *echo.Echo, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if accept != "" {
+			req.Header.Set(echo.HeaderAccept, accept)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(newServer(true), "application/json")
+	var body RootResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	if len(body.Routes) != 3 {
+		t.Fatalf("routes = %+v, want 3", body.Routes)
+	}
+	reminder := body.Routes[2]
+	if reminder.Path != "/api/reminders/:id" || strings.Join(reminder.Methods, ",") != "DELETE,PATCH" {
+		t.Errorf("route = %+v", reminder)
+	}
+
+	if rec := get(newServer(true), ""); rec.Code != http.StatusMovedPermanently {
+		t.Errorf("swagger enabled: status = %d, want redirect", rec.Code)
+	}
+
+	rec = get(newServer(false), "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/api/health") {
+		t.Errorf("swagger disabled: %d %q", rec.Code, rec.Body)
+	}
+	if strings.HasPrefix(rec.Body.String(), "\n") {
+		t.Errorf("no banner: body starts with a blank line: %q", rec.Body)
+	}
+}
+
+func TestRootShowsBanner(t *testing.T) {
+	e := echo.New()
+	e.GET("/", rootHandler(e, false, "  staging - mac-mini-2\n"))
+	e.GET("/api/health", handleHealth)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	text := rec.Body.String()
+	if !strings.HasPrefix(text, "staging - mac-mini-2\n\nmowa ") || !strings.Contains(text, "/api/health") {
+		t.Errorf("text = %q, want the banner above the version and endpoints", text)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	var body RootResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Banner != "staging - mac-mini-2" || len(body.Routes) != 2 {
+		t.Errorf("json = %+v", body)
+	}
+}
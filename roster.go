@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rosterFilePrefix marks a group member as a file listing the actual members,
+// one per line, e.g. "@/etc/mowa/family.txt". The file is read when the group
+// is expanded, so edits apply without restarting mowa.
+const rosterFilePrefix = "@"
+
+// rosterEntry is a parsed roster file, along with the size and modification
+// time it had when read.
+type rosterEntry struct {
+	size    int64
+	modTime time.Time
+	members []string
+}
+
+// rosterCache keeps parsed roster files so they are only re-read once they
+// change.
+type rosterCache struct {
+	mu      sync.Mutex
+	entries map[string]rosterEntry
+}
+
+var rosters = &rosterCache{entries: make(map[string]rosterEntry)}
+
+// members returns the recipients listed in the roster file at path, re-reading
+// it only when its size or modification time changed.
+func (r *rosterCache) members(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.entries[path]; ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.members, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	members := parseRoster(data)
+	r.entries[path] = rosterEntry{size: info.Size(), modTime: info.ModTime(), members: members}
+	return members, nil
+}
+
+// parseRoster returns the recipients in a roster file: one per line, ignoring
+// blank lines and lines starting with #.
+func parseRoster(data []byte) []string {
+	var members []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		members = append(members, line)
+	}
+	return members
+}
+
+// groupMembers returns the members of the configured group name, with roster
+// files replaced by the recipients they list. A roster that can't be read is
+// logged and contributes no members. ok is false when no such group exists.
+func groupMembers(name string) (members []string, ok bool) {
+	if appConfig == nil {
+		return nil, false
+	}
+	configured, ok := appConfig.Messages.Groups[name]
+	if !ok {
+		return nil, false
+	}
+
+	for _, member := range configured {
+		path, isRoster := strings.CutPrefix(member, rosterFilePrefix)
+		if !isRoster {
+			members = append(members, member)
+			continue
+		}
+		listed, err := rosters.members(path)
+		if err != nil {
+			logWarnf("Failed to read members of group '%s' from %s: %v", name, path, err)
+			continue
+		}
+		members = append(members, listed...)
+	}
+	return members, true
+}
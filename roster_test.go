@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExpandGroupsFromRosterFile checks a group member of the form @path is
+// replaced by the recipients in that file, and that edits to the file are
+// picked up without reloading the config.
+func TestExpandGroupsFromRosterFile(t *testing.T) {
+	roster := filepath.Join(t.TempDir(), "family.txt")
+	if err := os.WriteFile(roster, []byte("# maintained by the family app\n+15550000002\n\n  +15550000003  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev })
+	appConfig = defaultConfig()
+	appConfig.Messages.Groups = map[string][]string{
+		"family": {"+15550000001", "@" + roster},
+		"broken": {"@" + filepath.Join(t.TempDir(), "missing.txt")},
+	}
+
+	got := strings.Join(expandGroups([]string{"family"}), ",")
+	if want := "+15550000001,+15550000002,+15550000003"; got != want {
+		t.Errorf("expanded = %s, want %s", got, want)
+	}
+
+	if err := os.WriteFile(roster, []byte("+15550000004\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(roster, later, later); err != nil {
+		t.Fatal(err)
+	}
+	got = strings.Join(expandGroups([]string{"family"}), ",")
+	if want := "+15550000001,+15550000004"; got != want {
+		t.Errorf("after editing the roster, expanded = %s, want %s", got, want)
+	}
+
+	if resp := validateRecipients([]string{"broken"}); resp.Valid || resp.Results[0].Error != "group has no members" {
+		t.Errorf("unreadable roster: %+v, want a group with no members", resp)
+	}
+}
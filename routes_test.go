@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestRegisterAPIRoutesFeatures checks a disabled feature's routes answer 404
+// while the rest of the API is still served.
+func TestRegisterAPIRoutesFeatures(t *testing.T) {
+	status := func(features FeaturesConfig, method, target string) int {
+		e := echo.New()
+		e.HTTPErrorHandler = jsonErrorHandler
+		registerAPIRoutes(e.Group("/api"), features, nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec.Code
+	}
+
+	off := false
+	noStorage := FeaturesConfig{Storage: &off}
+	if code := status(noStorage, http.MethodGet, "/api/storage/notes.txt"); code != http.StatusNotFound {
+		t.Errorf("storage disabled: raw GET = %d, want 404", code)
+	}
+	if code := status(noStorage, http.MethodPost, "/api/storage/mkdir"); code != http.StatusNotFound {
+		t.Errorf("storage disabled: mkdir = %d, want 404", code)
+	}
+	if code := status(noStorage, http.MethodPost, "/api/messages"); code != http.StatusBadRequest {
+		t.Errorf("storage disabled: messages = %d, want the handler's 400", code)
+	}
+
+	noMessages := FeaturesConfig{Messages: &off}
+	if code := status(noMessages, http.MethodPost, "/api/messages"); code != http.StatusNotFound {
+		t.Errorf("messages disabled: messages = %d, want 404", code)
+	}
+	if code := status(noMessages, http.MethodGet, "/api/messages/failed"); code != http.StatusNotFound {
+		t.Errorf("messages disabled: failed = %d, want 404", code)
+	}
+}
+
+// TestStorageEndpointNames checks the raw route refuses paths that are the
+// URL of a fixed /api/storage/... endpoint, which takes them first, while the
+// JSON API and paths below such a name work as usual.
+func TestStorageEndpointNames(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "usage/a.txt", "docs/usage")
+
+	e := echo.New()
+	registerAPIRoutes(e.Group("/api"), FeaturesConfig{}, nil)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader("x")))
+		return rec
+	}
+
+	for _, tc := range []struct {
+		method, target string
+		want           int
+	}{
+		{http.MethodGet, "/api/storage/usage/a.txt", http.StatusOK},
+		{http.MethodGet, "/api/storage/docs/usage", http.StatusOK},
+		{http.MethodGet, "/api/storage/usage/", http.StatusBadRequest},
+		{http.MethodGet, "/api/storage/.//tree", http.StatusBadRequest},
+		{http.MethodPut, "/api/storage/usage", http.StatusBadRequest},
+		{http.MethodPut, "/api/storage/stat", http.StatusBadRequest},
+		{http.MethodPut, "/api/storage/zip.txt", http.StatusOK},
+	} {
+		if rec := do(tc.method, tc.target); rec.Code != tc.want {
+			t.Errorf("%s %s: status = %d, want %d: %s", tc.method, tc.target, rec.Code, tc.want, rec.Body)
+		}
+	}
+	if rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/stat","content":"x"}`); rec.Code != http.StatusOK {
+		t.Errorf("saving /stat with the JSON API: status = %d, want 200", rec.Code)
+	}
+}
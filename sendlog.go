@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxSendLogEntries caps how many sends are kept for GET /api/messages/status;
+// the send log file is compacted down to them once it holds twice as many.
+const maxSendLogEntries = 1000
+
+// defaultSendLogLimit is how many sends GET /api/messages/status returns when
+// no limit is given.
+const defaultSendLogLimit = 50
+
+// sendLogStore records every send through the messages API, newest last. It
+// is kept in memory and, when messages.send_log_file is set, appended to that
+// file as JSON lines so the history survives restarts.
+type sendLogStore struct {
+	mu      sync.Mutex
+	path    string
+	entries []SentMessage
+	// lines is how many entries the file holds, including ones already
+	// dropped from entries, to know when to compact it.
+	lines int
+}
+
+var sendLog = &sendLogStore{}
+
+// initSendLog loads the sends persisted in messages.send_log_file, if
+// configured. A missing file is an empty history.
+func initSendLog() error {
+	return sendLog.load(appConfig.Messages.SendLogFile)
+}
+
+// load replaces the store's entries with the latest maxSendLogEntries in path
+// and appends future sends there. An empty path keeps the store in memory
+// only.
+func (s *sendLogStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path, s.entries, s.lines = path, nil, 0
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry SentMessage
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A line cut short by a crash mid-append is skipped rather than
+			// making the whole history unreadable.
+			logWarnf("Skipping malformed line %d of %s: %v", s.lines+1, path, err)
+			continue
+		}
+		s.lines++
+		s.entries = append(s.entries, entry)
+		if len(s.entries) > maxSendLogEntries {
+			s.entries = s.entries[1:]
+		}
+	}
+	return scanner.Err()
+}
+
+// add records a send, dropping the oldest beyond maxSendLogEntries.
+func (s *sendLogStore) add(entry SentMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entry)
+	if over := len(s.entries) - maxSendLogEntries; over > 0 {
+		s.entries = append([]SentMessage(nil), s.entries[over:]...)
+	}
+	s.append(entry)
+}
+
+// page returns up to limit sends, newest first, skipping the offset newest
+// ones, along with how many sends are recorded in total.
+func (s *sendLogStore) page(limit, offset int) ([]SentMessage, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sends := []SentMessage{}
+	for i := len(s.entries) - 1 - offset; i >= 0 && len(sends) < limit; i-- {
+		sends = append(sends, s.entries[i])
+	}
+	return sends, len(s.entries)
+}
+
+// append writes entry to the send log file, compacting the file once it holds
+// twice maxSendLogEntries. The caller must hold s.mu. Failures are logged: the
+// send already happened, so a write error must not fail it.
+func (s *sendLogStore) append(entry SentMessage) {
+	if s.path == "" {
+		return
+	}
+	if s.lines+1 > 2*maxSendLogEntries {
+		s.compact()
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logErrorf("Failed to encode send log entry: %v", err)
+		return
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		logErrorf("Failed to write send log to %s: %v", s.path, err)
+		return
+	}
+	s.lines++
+}
+
+// compact rewrites the send log file with only the entries kept in memory,
+// replacing it atomically. The caller must hold s.mu.
+func (s *sendLogStore) compact() {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		logErrorf("Failed to write send log to %s: %v", s.path, err)
+		return
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, entry := range s.entries {
+		if err = enc.Encode(entry); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o600)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logErrorf("Failed to write send log to %s: %v", s.path, err)
+		return
+	}
+	s.lines = len(s.entries)
+}
+
+// recordSend adds a send of message to to the send log, with the results of
+// every recipient (and part).
+func recordSend(to []string, message string, results []MessageResult) {
+	sendLog.add(SentMessage{
+		ID:      newDeadLetterID(),
+		SentAt:  time.Now().UTC(),
+		To:      to,
+		Message: message,
+		Results: results,
+	})
+}
+
+// @Summary List sent messages
+// @Description Page through the history of sends through POST /api/messages and POST /api/messages/retry, newest first, with every recipient's result. The latest 1000 sends are kept; set messages.send_log_file to keep them across restarts.
+// @Tags messages
+// @Produce json
+// @Param limit query int false "Number of sends to return (default 50, at most 1000)"
+// @Param offset query int false "Number of newest sends to skip, to page further back"
+// @Success 200 {object} SendLogResponse "Recent sends"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid limit or offset"
+// @Router /api/messages/status [get]
+func handleMessageStatus(c echo.Context) error {
+	limit, err := queryInt(c, "limit", defaultSendLogLimit)
+	if err != nil || limit < 1 || limit > maxSendLogEntries {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "limit must be a number from 1 to " + strconv.Itoa(maxSendLogEntries),
+		})
+	}
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "offset must be a non-negative number",
+		})
+	}
+
+	sends, total := sendLog.page(limit, offset)
+	return c.JSON(http.StatusOK, SendLogResponse{Sends: sends, Total: total})
+}
+
+// queryInt parses the integer query parameter name, returning def when it is
+// absent.
+func queryInt(c echo.Context, name string, def int) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New(name + " must be a number")
+	}
+	return n, nil
+}
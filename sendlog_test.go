@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestMessageStatus sends two messages, then pages through the send log,
+// newest first, and checks the history survives a reload from disk.
+func TestMessageStatus(t *testing.T) {
+	prev := appConfig
+	appConfig = defaultConfig()
+	appConfig.Messages.Groups = map[string][]string{"family": {"+15550000001"}}
+	t.Cleanup(func() { appConfig = prev })
+	useTempDeadLetters(t)
+	path := filepath.Join(t.TempDir(), "sent.jsonl")
+	if err := sendLog.load(path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sendLog.load("") })
+	fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	doMessagesJSON(t, handleSendMessages, http.MethodPost, `{"to":["family"],"message":"first"}`)
+	doMessagesJSON(t, handleSendMessages, http.MethodPost, `{"to":["+15550000002","+1555"],"message":"second"}`)
+
+	status := func(query string) (int, SendLogResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/messages/status"+query, nil)
+		if err := handleMessageStatus(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		var resp SendLogResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := status("")
+	if code != http.StatusOK || resp.Total != 2 || len(resp.Sends) != 2 {
+		t.Fatalf("got %d %+v, want both sends", code, resp)
+	}
+	latest := resp.Sends[0]
+	if latest.Message != "second" || len(latest.Results) != 2 || !latest.Results[0].Success || latest.Results[1].Success {
+		t.Errorf("latest send = %+v, want second with one success and one failure", latest)
+	}
+	if first := resp.Sends[1]; first.To[0] != "family" || first.Results[0].ExpandedFrom != "family" {
+		t.Errorf("first send = %+v, want the group as requested", first)
+	}
+
+	if err := sendLog.load(path); err != nil {
+		t.Fatalf("reloading: %v", err)
+	}
+	if _, resp := status("?limit=1&offset=1"); len(resp.Sends) != 1 || resp.Sends[0].Message != "first" || resp.Total != 2 {
+		t.Errorf("after reload, second page = %+v, want the first send", resp)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=abc", "?offset=-1"} {
+		if code, _ := status(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, code)
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"flag"
 	"fmt"
 	"html"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -258,7 +257,7 @@ func ensureUpdateCheckAgent(binaryPath, configPath, schedule, home string) (chan
 	if loaded {
 		if out, err := runLaunchctl("bootout", serviceTarget); err != nil {
 			// Non-fatal: bootstrap below reports the real problem if there is one.
-			log.Printf("note: %v\n%s", err, indent(out))
+			logInfof("note: %v\n%s", err, indent(out))
 		}
 	}
 	if out, err := runLaunchctl("bootstrap", fmt.Sprintf("gui/%d", os.Getuid()), plistPath); err != nil {
@@ -276,26 +275,26 @@ func ensureUpdateCheckAgent(binaryPath, configPath, schedule, home string) (chan
 // launchd interaction must never take the HTTP server down with it.
 func ensureUpdateCheckAgentAtStartup(configPath string) {
 	if _, err := exec.LookPath("launchctl"); err != nil {
-		log.Printf("⚠️ software_update_check is enabled but launchctl is unavailable; cannot schedule the update check: %v", err)
+		logWarnf("⚠️ software_update_check is enabled but launchctl is unavailable; cannot schedule the update check: %v", err)
 		return
 	}
 	home, err := os.UserHomeDir()
 	if err != nil {
-		log.Printf("⚠️ could not resolve home directory to schedule the update check: %v", err)
+		logWarnf("⚠️ could not resolve home directory to schedule the update check: %v", err)
 		return
 	}
 	absConfig, err := filepath.Abs(configPath)
 	if err != nil {
-		log.Printf("⚠️ could not resolve config path to schedule the update check: %v", err)
+		logWarnf("⚠️ could not resolve config path to schedule the update check: %v", err)
 		return
 	}
 	changed, err := ensureUpdateCheckAgent(defaultBinaryLocation(), absConfig, appConfig.SoftwareUpdateCheck.Schedule, home)
 	if err != nil {
-		log.Printf("⚠️ could not install the update-check agent: %v", err)
+		logWarnf("⚠️ could not install the update-check agent: %v", err)
 		return
 	}
 	if changed {
-		log.Printf("✅ Installed %s (runs `mowa check-updates` daily at %s)", updateCheckLabel, scheduleOrDefault(appConfig.SoftwareUpdateCheck.Schedule))
+		logInfof("✅ Installed %s (runs `mowa check-updates` daily at %s)", updateCheckLabel, scheduleOrDefault(appConfig.SoftwareUpdateCheck.Schedule))
 	}
 }
 
@@ -1,25 +1,41 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/labstack/echo/v4"
 )
 
 // @Summary Handle storage operations
-// @Description Handle both GET and POST requests for storage operations with JSON payload. Optionally send notifications about operation results via iMessage.
+// @Description Handle both GET and POST requests for storage operations with JSON payload. Optionally send notifications about operation results through the configured notifier (iMessage by default). A GET with raw set, or whose Accept header asks for text/plain or application/octet-stream rather than JSON, streams the file itself instead of a JSON response.
 // @Tags storage
 // @Accept json
 // @Produce json
+// @Produce octet-stream
 // @Param request body StorageRequest true "Storage request"
+// @Param If-Unmodified-Since header string false "Only save if the file hasn't changed since this HTTP date (POST only)"
 // @Success 200 {object} StorageResponse "Storage operation completed successfully"
 // @Failure 400 {object} StorageResponse "Bad request - invalid input"
 // @Failure 404 {object} StorageResponse "File not found"
+// @Failure 412 {object} StorageResponse "The file changed since ifModTime / If-Unmodified-Since (POST only)"
+// @Failure 507 {object} StorageResponse "Storage quota exceeded, or the disk is full (code disk_full)"
 // @Failure 500 {object} StorageResponse "Internal server error"
 // @Router /api/storage [get]
 // @Router /api/storage [post]
@@ -28,7 +44,7 @@ func handleStorage(c echo.Context) error {
 
 	// Parse JSON body for both GET and POST requests
 	if err := c.Bind(&req); err != nil {
-		log.Printf("Failed to parse request body: %v", err)
+		logDebugf("Failed to parse request body: %v", err)
 		return c.JSON(http.StatusBadRequest, StorageResponse{
 			Success: false,
 			Error:   "invalid request body",
@@ -50,235 +66,1759 @@ func handleStorage(c echo.Context) error {
 		})
 	}
 
-	return processStorageRequest(c, req.Path, req.Content, req.Notify)
+	// A byte range only makes sense for reads and must be well-formed
+	if (req.Offset != nil && *req.Offset < 0) || (req.Length != nil && *req.Length < 0) {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "offset and length must not be negative",
+		})
+	}
+
+	if req.Tail != nil {
+		if *req.Tail <= 0 {
+			return c.JSON(http.StatusBadRequest, StorageResponse{
+				Success: false,
+				Error:   "tail must be a positive number of lines",
+			})
+		}
+		if req.Offset != nil || req.Length != nil {
+			return c.JSON(http.StatusBadRequest, StorageResponse{
+				Success: false,
+				Error:   "tail cannot be combined with offset or length",
+			})
+		}
+	}
+
+	if req.StartLine != nil || req.EndLine != nil {
+		if (req.StartLine != nil && *req.StartLine < 1) || (req.EndLine != nil && *req.EndLine < 1) {
+			return c.JSON(http.StatusBadRequest, StorageResponse{
+				Success: false,
+				Error:   "startLine and endLine must be positive line numbers",
+			})
+		}
+		if req.StartLine != nil && req.EndLine != nil && *req.StartLine > *req.EndLine {
+			return c.JSON(http.StatusBadRequest, StorageResponse{
+				Success: false,
+				Error:   "startLine must not be after endLine",
+			})
+		}
+		if req.Offset != nil || req.Length != nil || req.Tail != nil {
+			return c.JSON(http.StatusBadRequest, StorageResponse{
+				Success: false,
+				Error:   "startLine/endLine cannot be combined with offset, length or tail",
+			})
+		}
+	}
+
+	if req.Raw && (req.Offset != nil || req.Length != nil || req.Tail != nil || req.StartLine != nil || req.EndLine != nil) {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "raw cannot be combined with offset, length, tail or startLine/endLine",
+		})
+	}
+
+	if req.Parse != "" {
+		if req.Parse != "json" {
+			return c.JSON(http.StatusBadRequest, StorageResponse{
+				Success: false,
+				Error:   `parse must be "json"`,
+			})
+		}
+		if req.Raw || req.Offset != nil || req.Length != nil || req.Tail != nil || req.StartLine != nil || req.EndLine != nil {
+			return c.JSON(http.StatusBadRequest, StorageResponse{
+				Success: false,
+				Error:   "parse cannot be combined with raw, offset, length, tail or startLine/endLine",
+			})
+		}
+	}
+
+	if req.ExpandEnv {
+		if !appConfig.Storage.AllowExpandEnv {
+			return c.JSON(http.StatusForbidden, StorageResponse{
+				Success: false,
+				Error:   "expandEnv is disabled; set storage.allow_expand_env to enable it",
+			})
+		}
+		if req.Raw || req.Offset != nil || req.Length != nil || req.Tail != nil || req.StartLine != nil || req.EndLine != nil {
+			return c.JSON(http.StatusBadRequest, StorageResponse{
+				Success: false,
+				Error:   "expandEnv cannot be combined with raw, offset, length, tail or startLine/endLine",
+			})
+		}
+	}
+
+	// A plain read can also be asked for raw through Accept; the JSON-only
+	// options keep the structured response.
+	if c.Request().Method == http.MethodGet && !req.Raw && req.Parse == "" && !req.ExpandEnv &&
+		req.Offset == nil && req.Length == nil && req.Tail == nil && req.StartLine == nil && req.EndLine == nil {
+		req.Raw = negotiateFormat(c, formatJSON) == formatPlain
+	}
+
+	return processStorageRequest(c, req)
+}
+
+// maxRawUploadBytes caps the body of a PUT/POST to the raw URL storage route.
+const maxRawUploadBytes = 256 << 20
+
+// @Summary Handle storage operations with URL path
+// @Description Handle GET requests for storage operations where path is provided in URL. Clients that ask for application/json in Accept get the structured StorageResponse instead of the raw content. A directory is answered with its index file (storage.index_file, index.html by default) served as its own type, so the route can host a static website. A path that is the URL of a fixed storage endpoint, such as /usage, is rejected with 400, as the endpoint takes it first; use the JSON API for such files.
+// @Tags storage
+// @Produce text/plain
+// @Produce json
+// @Param path path string true "File path" default(/example.txt)
+// @Param download query bool false "Serve as an attachment so browsers save the file instead of displaying it"
+// @Param contentType query string false "Content-Type to serve the file with instead of text/plain" example(application/json)
+// @Success 200 {string} string "File content"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path"
+// @Failure 403 {object} StorageResponse "Directory without an index file"
+// @Failure 404 {object} StorageResponse "File not found"
+// @Failure 405 {object} StorageResponse "Method not allowed - only GET, HEAD, PUT and POST are supported"
+// @Failure 500 {object} StorageResponse "Internal server error"
+// @Router /api/storage/{path} [get]
+func handleStorageWithPath(c echo.Context) error {
+	// Extract path from URL parameter
+	pathParam := c.Param("*")
+	if pathParam == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+
+	// Ensure path starts with /
+	path := "/" + strings.TrimPrefix(pathParam, "/")
+	// Explicitly check for empty normalized path (i.e., "/")
+	if path == "/" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+
+	// The fixed storage endpoints, like GET /api/storage/usage, take their
+	// URLs first, so a file by one of their names can't be used here.
+	if isStorageEndpoint(c.Echo(), path) {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   fmt.Sprintf("%s is the URL of a storage endpoint; use the JSON API for this file", path),
+		})
+	}
+
+	switch c.Request().Method {
+	case http.MethodGet:
+		// For URL path approach, return raw file content
+		return processStorageRequestRaw(c, path)
+	case http.MethodHead:
+		return processStorageRequestHead(c, path)
+	case http.MethodPut, http.MethodPost:
+		return handleStorageRawUpload(c, path)
+	default:
+		c.Response().Header().Set(echo.HeaderAllow, "GET, HEAD, PUT, POST")
+		return c.JSON(http.StatusMethodNotAllowed, StorageResponse{
+			Success: false,
+			Error:   "method not allowed - use GET to read, or PUT/POST with the file as the body to write",
+		})
+	}
+}
+
+// isStorageEndpoint reports whether the storage path names a fixed
+// /api/storage/... endpoint registered on e, such as /usage.
+func isStorageEndpoint(e *echo.Echo, path string) bool {
+	target := "/api/storage" + filepath.ToSlash(filepath.Clean(path))
+	for _, route := range e.Routes() {
+		if route.Path == target && !strings.HasSuffix(route.Path, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// @Summary Upload a file with URL path
+// @Description Write the request body to the file at the path in the URL, creating directories as needed and replacing any existing file, e.g. `curl -T report.pdf http://localhost:8080/api/storage/docs/report.pdf`. The body is stored byte for byte whatever its Content-Type, which is not kept; pass contentType when reading it back. Honors If-Unmodified-Since like POST /api/storage. Limited to 256 MiB.
+// @Tags storage
+// @Accept octet-stream
+// @Produce json
+// @Param path path string true "File path" default(/example.txt)
+// @Param If-Unmodified-Since header string false "Only save if the file hasn't changed since this HTTP date"
+// @Success 200 {object} StorageResponse "File saved"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path"
+// @Failure 412 {object} StorageResponse "The file changed since If-Unmodified-Since"
+// @Failure 413 {object} StorageResponse "Body too large"
+// @Failure 500 {object} StorageResponse "Internal server error"
+// @Failure 507 {object} StorageResponse "Storage quota exceeded, or the disk is full (code disk_full)"
+// @Router /api/storage/{path} [put]
+// @Router /api/storage/{path} [post]
+func handleStorageRawUpload(c echo.Context, path string) error {
+	// Uploads of up to maxRawUploadBytes can outlast the read timeout.
+	extendUploadDeadline(c)
+
+	fullPath, err := validateAndResolvePath(c, path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	since, err := unmodifiedSince(c, "")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxRawUploadBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, StorageResponse{
+				Success: false,
+				Error:   fmt.Sprintf("file is larger than %d bytes", maxRawUploadBytes),
+			})
+		}
+		logWarnf("Failed to read uploaded file: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "failed to read request body",
+		})
+	}
+
+	return handleSaveFile(c, fullPath, string(content), nil, saveOptions{since: since})
+}
+
+// @Summary Check whether a file exists
+// @Description Resolve a path inside the storage directory and report whether anything exists there. Only stats the path; file content is never read.
+// @Tags storage
+// @Accept json
+// @Produce json
+// @Param request body StorageRequest true "Storage request (only path is used)"
+// @Success 200 {object} StorageExistsResponse "Existence check completed"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path"
+// @Failure 500 {object} StorageResponse "Internal server error"
+// @Router /api/storage/exists [post]
+func handleStorageExists(c echo.Context) error {
+	var req StorageRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if req.Path == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+
+	absFullPath, err := validateAndResolvePath(c, req.Path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	// A not-exist error is the "false" answer; anything else (e.g. a
+	// permission error on a parent directory) means we genuinely don't know.
+	if _, err := os.Stat(absFullPath); err != nil {
+		if os.IsNotExist(err) {
+			return c.JSON(http.StatusOK, StorageExistsResponse{Exists: false})
+		}
+		logErrorf("Failed to stat %s: %v", absFullPath, err)
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to check file",
+		})
+	}
+
+	// An expired file only lingers until the next sweep
+	if storageExpiry.expired(absFullPath) {
+		return c.JSON(http.StatusOK, StorageExistsResponse{Exists: false})
+	}
+	return c.JSON(http.StatusOK, StorageExistsResponse{Exists: true})
+}
+
+// @Summary Create a directory
+// @Description Create a directory (and any missing parents) inside the storage directory, e.g. to pre-create a folder structure before uploads. Succeeds if the directory already exists.
+// @Tags storage
+// @Accept json
+// @Produce json
+// @Param request body StorageRequest true "Storage request (only path is used)"
+// @Success 200 {object} StorageResponse "Directory created or already present"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path"
+// @Failure 409 {object} StorageResponse "A file already exists at the path or one of its parents"
+// @Failure 500 {object} StorageResponse "Internal server error"
+// @Router /api/storage/mkdir [post]
+func handleStorageMkdir(c echo.Context) error {
+	var req StorageRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if req.Path == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+
+	absFullPath, err := validateAndResolvePath(c, req.Path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	if err := mkdirStorage(absFullPath); err != nil {
+		// MkdirAll fails with ENOTDIR (or EEXIST for the final component) when
+		// a file is in the way; report that as a conflict, not a server error.
+		if errors.Is(err, syscall.ENOTDIR) || errors.Is(err, os.ErrExist) {
+			return c.JSON(http.StatusConflict, StorageResponse{
+				Success: false,
+				Error:   "a file already exists at this path",
+			})
+		}
+		logErrorf("Failed to create directory %s: %v", absFullPath, err)
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to create directory",
+		})
+	}
+
+	return c.JSON(http.StatusOK, StorageResponse{Success: true})
+}
+
+// @Summary Empty a file
+// @Description Truncate an existing file to zero length in place, keeping its permissions and inode, e.g. to clear a log file without deleting and recreating it. Optionally send notifications about the result.
+// @Tags storage
+// @Accept json
+// @Produce json
+// @Param request body StorageRequest true "Storage request (path and notify are used)"
+// @Success 200 {object} StorageResponse "File emptied"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path or not a file"
+// @Failure 404 {object} StorageResponse "File not found"
+// @Failure 500 {object} StorageResponse "Internal server error"
+// @Router /api/storage/truncate [post]
+func handleStorageTruncate(c echo.Context) error {
+	var req StorageRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if req.Path == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+
+	if req.Notify != nil && len(req.Notify) == 0 {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "notify field cannot be empty - either omit it or provide at least one recipient",
+		})
+	}
+
+	fullPath, err := validateAndResolvePath(c, req.Path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	unlock := storageLocks.lock(fullPath)
+	defer unlock()
+
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) {
+		if len(req.Notify) > 0 {
+			go sendStorageNotification(req.Notify, "TRUNCATE", requestRelativePath(c, fullPath), false, "find file")
+		}
+		return c.JSON(http.StatusNotFound, StorageResponse{
+			Success: false,
+			Error:   "file not found",
+		})
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "only files can be truncated",
+		})
+	}
+
+	defer invalidateCachedFile(fullPath)
+	if err := truncateStorageFile(fullPath, info); err != nil {
+		logErrorf("Failed to truncate file %s: %v", fullPath, err)
+		if len(req.Notify) > 0 {
+			go sendStorageNotification(req.Notify, "TRUNCATE", requestRelativePath(c, fullPath), false, "truncate file")
+		}
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to truncate file",
+		})
+	}
+
+	setQuotaHeader(c)
+	if len(req.Notify) > 0 {
+		go sendStorageNotification(req.Notify, "TRUNCATE", requestRelativePath(c, fullPath), true, "emptied successfully")
+	}
+
+	return c.JSON(http.StatusOK, StorageResponse{
+		Success: true,
+		Content: "File emptied successfully",
+	})
+}
+
+// truncateStorageFile empties the file at path in place and credits the freed
+// space to the quota. With encryption at rest an empty file is still a sealed
+// blob, which is written over the old content in place instead. The caller must
+// hold the path's storageLocks lock.
+func truncateStorageFile(path string, info os.FileInfo) error {
+	var err error
+	var size int64
+	if storageCipher != nil {
+		var sealed []byte
+		if sealed, err = sealStorageData(nil); err == nil {
+			err = writeStorageFile(path, sealed)
+		}
+		size = int64(len(sealed))
+	} else {
+		var f *os.File
+		if f, err = openLockedFile(path, os.O_WRONLY, 0); err == nil {
+			err = f.Truncate(0)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Shrinking always fits, so the reservation of the (negative) size
+	// difference cannot fail.
+	if storageUsage != nil {
+		storageUsage.reserve(size - info.Size())
+	}
+	return nil
+}
+
+// @Summary Edit part of a file
+// @Description Apply a find/replace to an existing file without re-uploading it. The edited file is written atomically, so readers never see a half-written file. With appendLine instead of find, the line and a newline are appended to the file, which is created if missing, e.g. for log files; concurrent appends never interleave. appendLine is not available with storage encryption.
+// @Tags storage
+// @Accept json
+// @Produce json
+// @Param request body StoragePatchRequest true "Find/replace or line to apply"
+// @Success 200 {object} StorageResponse "File updated"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path, missing find, or an appendLine with a newline"
+// @Failure 404 {object} StorageResponse "File not found"
+// @Failure 409 {object} StorageResponse "The find text is not in the file"
+// @Failure 507 {object} StorageResponse "Storage quota exceeded"
+// @Failure 500 {object} StorageResponse "Internal server error"
+// @Router /api/storage [patch]
+func handleStoragePatch(c echo.Context) error {
+	var req StoragePatchRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if req.Path == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+	if req.AppendLine != nil && req.Find != "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "find and appendLine cannot be used together",
+		})
+	}
+	if req.AppendLine == nil && req.Find == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "find is required",
+		})
+	}
+	if req.Notify != nil && len(req.Notify) == 0 {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "notify field cannot be empty - either omit it or provide at least one recipient",
+		})
+	}
+
+	fullPath, err := validateAndResolvePath(c, req.Path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+	if req.AppendLine != nil {
+		return appendStorageLine(c, fullPath, *req.AppendLine, req.Notify)
+	}
+
+	// Hold the path for the whole read-modify-write so concurrent edits
+	// can't overwrite each other.
+	unlock := storageLocks.lock(fullPath)
+	defer unlock()
+
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		if len(req.Notify) > 0 {
+			go sendStorageNotification(req.Notify, "PATCH", requestRelativePath(c, fullPath), false, "find file")
+		}
+		return c.JSON(http.StatusNotFound, StorageResponse{
+			Success: false,
+			Error:   "file not found",
+		})
+	}
+
+	content, err := readStoredFile(fullPath)
+	if err != nil {
+		logErrorf("Failed to read file %s: %v", fullPath, err)
+		if len(req.Notify) > 0 {
+			go sendStorageNotification(req.Notify, "PATCH", requestRelativePath(c, fullPath), false, "read file")
+		}
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to read file",
+		})
+	}
+
+	if !bytes.Contains(content, []byte(req.Find)) {
+		return c.JSON(http.StatusConflict, StorageResponse{
+			Success: false,
+			Error:   "find text not found in file",
+		})
+	}
+	n := 1
+	if req.All {
+		n = -1
+	}
+	patched := bytes.Replace(content, []byte(req.Find), []byte(req.Replace), n)
+
+	data, err := sealStorageData(patched)
+	if err != nil {
+		logErrorf("Failed to encrypt file %s: %v", fullPath, err)
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to save file",
+		})
+	}
+
+	var quotaDelta int64
+	if storageUsage != nil {
+		quotaDelta = int64(len(data)) - info.Size()
+		if !storageUsage.reserve(quotaDelta) {
+			setQuotaHeader(c)
+			if len(req.Notify) > 0 {
+				go sendStorageNotification(req.Notify, "PATCH", requestRelativePath(c, fullPath), false, "storage quota exceeded")
+			}
+			return c.JSON(http.StatusInsufficientStorage, StorageResponse{
+				Success: false,
+				Error:   "storage quota exceeded",
+			})
+		}
+	}
+
+	defer invalidateCachedFile(fullPath)
+	if err := writeStorageFileAtomic(fullPath, data); err != nil {
+		logErrorf("Failed to write file %s: %v", fullPath, err)
+		if storageUsage != nil {
+			storageUsage.release(quotaDelta)
+		}
+		if len(req.Notify) > 0 {
+			go sendStorageNotification(req.Notify, "PATCH", requestRelativePath(c, fullPath), false, "write file")
+		}
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to save file",
+		})
+	}
+
+	setQuotaHeader(c)
+	if len(req.Notify) > 0 {
+		go sendStorageNotification(req.Notify, "PATCH", requestRelativePath(c, fullPath), true, "updated successfully")
+	}
+
+	return c.JSON(http.StatusOK, StorageResponse{
+		Success: true,
+		Content: "File updated successfully",
+	})
+}
+
+// appendStorageLine appends line and a newline to the file at fullPath for
+// PATCH /api/storage, creating the file if it is missing. The file is opened
+// with O_APPEND and the path held for the whole append, so concurrent appends
+// each land whole. A file not ending in a newline gets one first, so the line
+// always starts a line of its own.
+func appendStorageLine(c echo.Context, fullPath, line string, notify []string) error {
+	// An encrypted file is one sealed blob; appending to it would corrupt it.
+	if storageCipher != nil {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "appendLine is not available with storage encryption",
+		})
+	}
+	line = strings.TrimSuffix(line, "\n")
+	if strings.ContainsAny(line, "\r\n") {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "appendLine must be a single line",
+		})
+	}
+
+	unlock := storageLocks.lock(fullPath)
+	defer unlock()
+
+	var size int64
+	info, err := os.Stat(fullPath)
+	switch {
+	case err == nil && !info.Mode().IsRegular():
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is not a file",
+		})
+	case err == nil:
+		size = info.Size()
+	case os.IsNotExist(err):
+		if err := mkdirStorage(filepath.Dir(fullPath)); err != nil {
+			logErrorf("Failed to create directory %s: %v", filepath.Dir(fullPath), err)
+			return saveFileFailed(c, "PATCH", fullPath, notify, "create directory", err)
+		}
+	default:
+		logErrorf("Failed to stat file %s: %v", fullPath, err)
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to save file",
+		})
+	}
+
+	f, err := openLockedFile(fullPath, os.O_RDWR|os.O_APPEND|os.O_CREATE, storageFileMode())
+	if err != nil {
+		logErrorf("Failed to open file %s: %v", fullPath, err)
+		return saveFileFailed(c, "PATCH", fullPath, notify, "open file", err)
+	}
+	defer f.Close()
+
+	data := []byte(line + "\n")
+	if size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, size-1); err == nil && last[0] != '\n' {
+			data = append([]byte("\n"), data...)
+		}
+	}
+
+	if storageUsage != nil && !storageUsage.reserve(int64(len(data))) {
+		setQuotaHeader(c)
+		if len(notify) > 0 {
+			go sendStorageNotification(notify, "PATCH", requestRelativePath(c, fullPath), false, "storage quota exceeded")
+		}
+		return c.JSON(http.StatusInsufficientStorage, StorageResponse{
+			Success: false,
+			Error:   "storage quota exceeded",
+		})
+	}
+
+	defer invalidateCachedFile(fullPath)
+	if _, err := f.Write(data); err != nil {
+		logErrorf("Failed to append to file %s: %v", fullPath, err)
+		if storageUsage != nil {
+			storageUsage.release(int64(len(data)))
+		}
+		return saveFileFailed(c, "PATCH", fullPath, notify, "write file", err)
+	}
+	if size == 0 {
+		// A new file gets the configured mode exactly, despite the umask.
+		if err := os.Chmod(fullPath, storageFileMode()); err != nil {
+			logWarnf("Failed to set the mode of %s: %v", fullPath, err)
+		}
+	}
+
+	setQuotaHeader(c)
+	if len(notify) > 0 {
+		go sendStorageNotification(notify, "PATCH", requestRelativePath(c, fullPath), true, "appended successfully")
+	}
+
+	return c.JSON(http.StatusOK, StorageResponse{
+		Success: true,
+		Content: "Line appended successfully",
+	})
+}
+
+// validateAndResolvePath validates the path and resolves it to an absolute path within the storage directory
+// of the request (see storageRoot)
+func validateAndResolvePath(c echo.Context, path string) (string, error) {
+	// Validate path to prevent directory traversal attacks
+	if !isValidPath(path) {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid path: contains forbidden characters or directory traversal")
+	}
+
+	if max := appConfig.Storage.MaxPathDepth; max > 0 {
+		if depth := pathDepth(path); depth > max {
+			return "", echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("path is %d levels deep, over the limit of %d", depth, max))
+		}
+	}
+
+	if appConfig.Storage.StrictNames {
+		for _, name := range strings.Split(path, "/") {
+			if err := checkStrictName(name); err != nil {
+				return "", echo.NewHTTPError(http.StatusBadRequest, "invalid path: "+err.Error())
+			}
+		}
+	}
+
+	// Construct full file path
+	root := storageRoot(c)
+	fullPath := filepath.Join(root, path)
+
+	// Ensure the path is within the storage directory
+	storageDir, err := filepath.Abs(root)
+	if err != nil {
+		logErrorf("Failed to resolve storage directory %s: %v", root, err)
+		return "", echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	absFullPath, err := filepath.Abs(fullPath)
+	if err != nil {
+		logErrorf("Failed to resolve file path %s: %v", fullPath, err)
+		return "", echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	}
+
+	// Compared up to a separator, so one key's storage directory can't
+	// reach into a sibling sharing its name as a prefix.
+	if absFullPath != storageDir && !strings.HasPrefix(absFullPath, storageDir+string(filepath.Separator)) {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "path is outside of storage directory")
+	}
+
+	return absFullPath, nil
+}
+
+// windowsReservedNames are the device names Windows won't use for a file,
+// with or without an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// checkStrictName returns why name, one component of a storage path, is
+// refused under storage.strict_names, or nil. Empty and "." components, which
+// repeated slashes and "/./" produce, are fine.
+func checkStrictName(name string) error {
+	if name == "" || name == "." {
+		return nil
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("name %q contains a control character", name)
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return fmt.Errorf("name %q ends with a dot or space", name)
+	}
+	base, _, _ := strings.Cut(name, ".")
+	if windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+		return fmt.Errorf("name %q is reserved on Windows", name)
+	}
+	return nil
+}
+
+// pathDepth counts the components of a storage path, ignoring empty ones
+// from repeated or trailing slashes: "/" is 0 deep and "/docs/a.txt" 2.
+func pathDepth(path string) int {
+	depth := 0
+	for _, component := range strings.Split(path, "/") {
+		if component != "" && component != "." {
+			depth++
+		}
+	}
+	return depth
+}
+
+// processStorageRequest handles the common logic for storage operations
+func processStorageRequest(c echo.Context, req StorageRequest) error {
+	absFullPath, err := validateAndResolvePath(c, req.Path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	// Handle based on HTTP method
+	switch c.Request().Method {
+	case http.MethodGet:
+		release, err := acquireReadSlot(c)
+		if err != nil {
+			return err
+		}
+		defer release()
+		// Return file content in a structured response
+		return recordDownload(c, absFullPath, func() error {
+			return handleGetFile(c, absFullPath, req)
+		})
+	case http.MethodPost:
+		since, err := unmodifiedSince(c, req.IfModTime)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, StorageResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+		modTime, err := parseModTime(req.ModTime)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, StorageResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+				return c.JSON(http.StatusBadRequest, StorageResponse{
+					Success: false,
+					Error:   `ttl must be a positive duration such as "30m" or "24h"`,
+				})
+			}
+		}
+		var maxDownloads int64
+		if req.MaxDownloads != nil {
+			if maxDownloads = *req.MaxDownloads; maxDownloads <= 0 {
+				return c.JSON(http.StatusBadRequest, StorageResponse{
+					Success: false,
+					Error:   "maxDownloads must be a positive number",
+				})
+			}
+		}
+		return handleSaveFile(c, absFullPath, req.Content, req.Notify, saveOptions{since: since, modTime: modTime, ttl: ttl, maxDownloads: maxDownloads})
+	default:
+		return c.JSON(http.StatusMethodNotAllowed, StorageResponse{
+			Success: false,
+			Error:   "method not allowed",
+		})
+	}
+}
+
+// storagePathError converts a validateAndResolvePath error (an
+// echo.NewHTTPError) into the structured StorageResponse used by the JSON API.
+func storagePathError(c echo.Context, err error) error {
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		return c.JSON(httpErr.Code, StorageResponse{
+			Success: false,
+			Error:   httpErr.Message.(string),
+		})
+	}
+	return err
+}
+
+// processStorageRequestRaw handles the common logic for raw file access
+func processStorageRequestRaw(c echo.Context, path string) error {
+	absFullPath, err := validateAndResolvePath(c, path)
+	if err != nil {
+		// For raw file access, return the error directly (it's already an echo.NewHTTPError)
+		return err
+	}
+
+	absFullPath, isIndex, err := directoryIndex(c, absFullPath)
+	if err != nil {
+		return err
+	}
+
+	release, err := acquireReadSlot(c)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Clients asking for JSON get the same response as GET /api/storage
+	if negotiateFormat(c, formatPlain) == formatJSON {
+		return recordDownload(c, absFullPath, func() error {
+			return handleGetFile(c, absFullPath, StorageRequest{Path: path})
+		})
+	}
+
+	download, contentType, err := rawReadOptions(c)
+	if err != nil {
+		return err
+	}
+	if isIndex && c.QueryParam("contentType") == "" {
+		// An index page is served as what it is, e.g. HTML.
+		contentType = ""
+	}
+
+	// Return raw file content
+	return recordDownload(c, absFullPath, func() error {
+		return handleGetFileRaw(c, absFullPath, download, contentType)
+	})
+}
+
+// defaultIndexFile is served for raw reads of a directory when
+// storage.index_file is not set.
+const defaultIndexFile = "index.html"
+
+// directoryIndex returns the path to serve for a raw read of fullPath: the
+// directory's index file when fullPath is a directory, else fullPath itself.
+// isIndex reports which. A directory without an index is refused with 403.
+func directoryIndex(c echo.Context, fullPath string) (path string, isIndex bool, err error) {
+	info, err := os.Stat(fullPath)
+	if err != nil || !info.IsDir() {
+		return fullPath, false, nil
+	}
+	name := appConfig.Storage.IndexFile
+	if name == "" {
+		name = defaultIndexFile
+	}
+	index := filepath.Join(fullPath, name)
+	// A linked index is only served if it stays inside the storage directory.
+	if info, err := os.Stat(index); err == nil && info.Mode().IsRegular() && withinStorageDir(c, index) && !storageExpiry.expired(index) {
+		return index, true, nil
+	}
+	return "", false, echo.NewHTTPError(http.StatusForbidden, "directory has no "+name+"; list it with GET /api/storage/tree")
+}
+
+// rawReadOptions parses the query parameters of a raw read.
+func rawReadOptions(c echo.Context) (download bool, contentType string, err error) {
+	// ?download=1 asks the browser to save the file rather than render it
+	download, _ = strconv.ParseBool(c.QueryParam("download"))
+
+	// ?contentType=... overrides the text/plain default, for files whose
+	// extension (or lack of one) doesn't say what they are
+	contentType = echo.MIMETextPlainCharsetUTF8
+	if override := c.QueryParam("contentType"); override != "" {
+		mediaType, params, err := mime.ParseMediaType(override)
+		if err != nil {
+			return false, "", echo.NewHTTPError(http.StatusBadRequest, "invalid contentType")
+		}
+		contentType = mime.FormatMediaType(mediaType, params)
+	}
+	return download, contentType, nil
+}
+
+// @Summary Get file headers with URL path
+// @Description Answer with the headers GET /api/storage/{path} would send (Content-Type, Content-Length, Last-Modified, ETag and, with download, Content-Disposition) but no body, without reading the file. A HEAD request does not count as a download.
+// @Tags storage
+// @Param path path string true "File path" default(/example.txt)
+// @Param download query bool false "Include the Content-Disposition header a download would get"
+// @Param contentType query string false "Content-Type to report instead of text/plain" example(application/json)
+// @Success 200 "File exists"
+// @Failure 400 "Bad request - invalid path or not a file"
+// @Failure 403 "Directory without an index file"
+// @Failure 404 "File not found"
+// @Failure 410 "File has reached its download limit"
+// @Router /api/storage/{path} [head]
+func processStorageRequestHead(c echo.Context, path string) error {
+	absFullPath, err := validateAndResolvePath(c, path)
+	if err != nil {
+		return err
+	}
+
+	absFullPath, isIndex, err := directoryIndex(c, absFullPath)
+	if err != nil {
+		return err
+	}
+
+	download, contentType, err := rawReadOptions(c)
+	if err != nil {
+		return err
+	}
+	if isIndex && c.QueryParam("contentType") == "" {
+		contentType = guessContentType(absFullPath, nil)
+	}
+
+	info, err := os.Stat(absFullPath)
+	if os.IsNotExist(err) || storageExpiry.expired(absFullPath) {
+		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		return echo.NewHTTPError(http.StatusBadRequest, "not a file")
+	}
+	// Only report the file as there if a GET would serve it
+	if entry, _ := storageDownloads.get(absFullPath); entry.Max > 0 && entry.Count >= entry.Max {
+		return echo.NewHTTPError(http.StatusGone, errDownloadLimitReached.Error())
+	}
+
+	setRawFileHeaders(c, absFullPath, info, download)
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(storedContentSize(info), 10))
+	c.Response().WriteHeader(http.StatusOK)
+	return nil
+}
+
+// setRawFileHeaders sets the headers describing a raw read of the file at
+// fullPath, shared by GET and HEAD.
+func setRawFileHeaders(c echo.Context, fullPath string, info os.FileInfo, download bool) {
+	header := c.Response().Header()
+	if download {
+		header.Set(echo.HeaderContentDisposition, attachmentDisposition(fullPath))
+	}
+	// Clients send this back as If-Unmodified-Since for a conditional save.
+	header.Set(echo.HeaderLastModified, info.ModTime().UTC().Format(http.TimeFormat))
+	header.Set("ETag", fileETag(info))
+}
+
+// fileETag derives an entity tag from a file's modification time and size,
+// which change whenever it is saved, so it costs a stat rather than a hash of
+// the content.
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// attachmentDisposition builds a Content-Disposition header that downloads
+// fullPath under its base name. FormatMediaType quotes the name, or encodes it
+// per RFC 2231 when it is not plain ASCII.
+func attachmentDisposition(fullPath string) string {
+	if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(fullPath)}); disposition != "" {
+		return disposition
+	}
+	return "attachment"
+}
+
+// handleGetFile retrieves a file from storage and returns a structured response
+func handleGetFile(c echo.Context, fullPath string, req StorageRequest) error {
+	notify := req.Notify
+
+	// Check if file exists; an expired one is as good as gone, and a path
+	// through a file, like a.txt/b, names nothing
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) || storageExpiry.expired(fullPath) {
+		// Send notification if requested
+		if len(notify) > 0 {
+			go sendStorageNotification(notify, "GET", requestRelativePath(c, fullPath), false, "find file")
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+	}
+	if err != nil {
+		logErrorf("Failed to stat file %s: %v", fullPath, err)
+		if len(notify) > 0 {
+			go sendStorageNotification(notify, "GET", requestRelativePath(c, fullPath), false, "read file")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+	}
+
+	// raw streams the file itself, as GET /api/storage/{path} does, sparing
+	// large files the JSON (and base64) round trip.
+	if req.Raw {
+		if err := handleGetFileRaw(c, fullPath, false, ""); err != nil {
+			if len(notify) > 0 {
+				go sendStorageNotification(notify, "GET", requestRelativePath(c, fullPath), false, "read file")
+			}
+			return err
+		}
+		if len(notify) > 0 {
+			go sendStorageNotification(notify, "GET", requestRelativePath(c, fullPath), true, "retrieved successfully")
+		}
+		return nil
+	}
+
+	// A byte range returns only that slice of the file, base64-encoded since
+	// an arbitrary cut can split a multibyte character or land in binary data.
+	if req.Offset != nil || req.Length != nil {
+		return handleGetFileRange(c, fullPath, info, req)
+	}
+	if req.Tail != nil {
+		return handleGetFileTail(c, fullPath, info, req)
+	}
+	if req.StartLine != nil || req.EndLine != nil {
+		return handleGetFileLines(c, fullPath, info, req)
+	}
+
+	// Read file content
+	content, err := readStoredFileCached(fullPath, info)
+	if err != nil {
+		// Log the real error for debugging, but don't expose it to the client
+		logErrorf("Failed to read file %s: %v", fullPath, err)
+
+		// Since we already checked that the file exists with os.Stat(),
+		// any read error is likely due to permissions, I/O issues, etc.
+		response := StorageResponse{
+			Success: false,
+			Error:   "failed to read file",
+		}
+
+		// Send notification if requested
+		if len(notify) > 0 {
+			go sendStorageNotification(notify, "GET", requestRelativePath(c, fullPath), false, "read file")
+		}
+
+		return c.JSON(http.StatusInternalServerError, response)
+	}
+
+	if req.ExpandEnv {
+		content = expandEnvPlaceholders(content)
+	}
+
+	var response StorageResponse
+	if req.Parse == "json" {
+		// Unmarshalling into a RawMessage validates the whole file but keeps
+		// it as is, so large numbers don't lose precision as float64s.
+		var data json.RawMessage
+		if err := json.Unmarshal(content, &data); err != nil {
+			if len(notify) > 0 {
+				go sendStorageNotification(notify, "GET", requestRelativePath(c, fullPath), false, "parse file as JSON")
+			}
+			return c.JSON(http.StatusUnprocessableEntity, StorageResponse{
+				Success: false,
+				Error:   "file is not valid JSON: " + err.Error(),
+			})
+		}
+		response = StorageResponse{
+			Success: true,
+			Data:    data,
+			ModTime: formatModTime(info),
+			Size:    contentSize(info),
+		}
+	} else {
+		response = fileContentResponse(content, info)
+	}
+
+	// Send notification if requested
+	if len(notify) > 0 {
+		go sendStorageNotification(notify, "GET", requestRelativePath(c, fullPath), true, "retrieved successfully")
+	}
+
+	return c.JSON(http.StatusOK, response)
 }
 
-// @Summary Handle storage operations with URL path
-// @Description Handle GET requests for storage operations where path is provided in URL
-// @Tags storage
-// @Produce text/plain
-// @Param path path string true "File path" default(/example.txt)
-// @Success 200 {string} string "File content"
-// @Failure 400 {object} StorageResponse "Bad request - invalid path"
-// @Failure 404 {object} StorageResponse "File not found"
-// @Failure 500 {object} StorageResponse "Internal server error"
-// @Router /api/storage/{path} [get]
-func handleStorageWithPath(c echo.Context) error {
-	// Extract path from URL parameter
-	pathParam := c.Param("*")
-	if pathParam == "" {
+// envPlaceholder matches a ${VAR} placeholder.
+var envPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvPlaceholders replaces the ${VAR} placeholders in content with the
+// server's environment variables, unset ones with nothing. Unlike os.Expand it
+// leaves bare $VAR and $1 alone, so prices or shell snippets in a file survive.
+func expandEnvPlaceholders(content []byte) []byte {
+	return envPlaceholder.ReplaceAllFunc(content, func(placeholder []byte) []byte {
+		return []byte(os.Getenv(string(placeholder[2 : len(placeholder)-1])))
+	})
+}
+
+// handleGetFileRange serves the byte range described by req.Offset and
+// req.Length. A missing offset starts at the beginning of the file and a
+// missing length reads to the end; a length running past the end of the file
+// is clamped to it, so a client can page through a growing log with a fixed
+// length.
+func handleGetFileRange(c echo.Context, fullPath string, info os.FileInfo, req StorageRequest) error {
+	var offset int64
+	if req.Offset != nil {
+		offset = *req.Offset
+	}
+	if info == nil || info.IsDir() {
 		return c.JSON(http.StatusBadRequest, StorageResponse{
 			Success: false,
-			Error:   "path is required",
+			Error:   "byte ranges can only be read from files",
 		})
 	}
-
-	// Ensure path starts with /
-	path := "/" + strings.TrimPrefix(pathParam, "/")
-	// Explicitly check for empty normalized path (i.e., "/")
-	if path == "/" {
+	size := storedContentSize(info)
+	if offset > size {
 		return c.JSON(http.StatusBadRequest, StorageResponse{
 			Success: false,
-			Error:   "path is required",
+			Error:   fmt.Sprintf("offset %d is beyond the end of the file (%d bytes)", offset, size),
 		})
 	}
 
-	// Only GET requests are supported for URL path approach
-	if c.Request().Method != http.MethodGet {
-		return c.JSON(http.StatusMethodNotAllowed, StorageResponse{
+	length := size - offset
+	if req.Length != nil && *req.Length < length {
+		length = *req.Length
+	}
+
+	data, err := readFileRange(fullPath, offset, length)
+	if err != nil {
+		logErrorf("Failed to read range of file %s: %v", fullPath, err)
+		if len(req.Notify) > 0 {
+			go sendStorageNotification(req.Notify, "GET", requestRelativePath(c, fullPath), false, "read file")
+		}
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
 			Success: false,
-			Error:   "method not allowed - use POST /api/storage with JSON payload for file creation",
+			Error:   "failed to read file",
 		})
 	}
 
-	// For URL path approach, return raw file content
-	return processStorageRequestRaw(c, path)
+	if len(req.Notify) > 0 {
+		go sendStorageNotification(req.Notify, "GET", requestRelativePath(c, fullPath), true, "retrieved successfully")
+	}
+
+	return c.JSON(http.StatusOK, StorageResponse{
+		Success:  true,
+		Content:  base64.StdEncoding.EncodeToString(data),
+		Encoding: "base64",
+		ModTime:  formatModTime(info),
+		Size:     contentSize(info),
+	})
 }
 
-// validateAndResolvePath validates the path and resolves it to an absolute path within the storage directory
-func validateAndResolvePath(path string) (string, error) {
-	// Validate path to prevent directory traversal attacks
-	if !isValidPath(path) {
-		return "", echo.NewHTTPError(http.StatusBadRequest, "invalid path: contains forbidden characters or directory traversal")
+// handleGetFileTail serves the last req.Tail lines of a file as text. A file
+// with fewer lines is returned whole.
+func handleGetFileTail(c echo.Context, fullPath string, info os.FileInfo, req StorageRequest) error {
+	if info == nil || info.IsDir() {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "tail can only be read from files",
+		})
 	}
 
-	// Construct full file path
-	fullPath := filepath.Join(appConfig.Storage.Dir, path)
-
-	// Ensure the path is within the storage directory
-	storageDir, err := filepath.Abs(appConfig.Storage.Dir)
+	data, err := readLastLines(fullPath, *req.Tail)
 	if err != nil {
-		log.Printf("Failed to resolve storage directory %s: %v", appConfig.Storage.Dir, err)
-		return "", echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+		logErrorf("Failed to tail file %s: %v", fullPath, err)
+		if len(req.Notify) > 0 {
+			go sendStorageNotification(req.Notify, "GET", requestRelativePath(c, fullPath), false, "read file")
+		}
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to read file",
+		})
 	}
 
-	absFullPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		log.Printf("Failed to resolve file path %s: %v", fullPath, err)
-		return "", echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+	if len(req.Notify) > 0 {
+		go sendStorageNotification(req.Notify, "GET", requestRelativePath(c, fullPath), true, "retrieved successfully")
 	}
 
-	if !strings.HasPrefix(absFullPath, storageDir) {
-		return "", echo.NewHTTPError(http.StatusBadRequest, "path is outside of storage directory")
+	return c.JSON(http.StatusOK, StorageResponse{
+		Success: true,
+		Content: string(data),
+		ModTime: formatModTime(info),
+		Size:    contentSize(info),
+	})
+}
+
+// contentSize returns a file's size in bytes, as a client reading it sees it,
+// for StorageResponse.Size.
+func contentSize(info os.FileInfo) *int64 {
+	size := storedContentSize(info)
+	return &size
+}
+
+// fileContentResponse returns the whole content of a file in a structured
+// response. Binary content would be mangled by the JSON string, so it is
+// base64-encoded instead.
+func fileContentResponse(content []byte, info os.FileInfo) StorageResponse {
+	response := StorageResponse{
+		Success: true,
+		Content: string(content),
+		ModTime: formatModTime(info),
+		Size:    contentSize(info),
 	}
+	if looksBinary(content) {
+		response.Content = base64.StdEncoding.EncodeToString(content)
+		response.Encoding = "base64"
+	}
+	return response
+}
 
-	return absFullPath, nil
+// formatModTime renders a file's modification time for StorageResponse.ModTime.
+func formatModTime(info os.FileInfo) string {
+	return info.ModTime().UTC().Format(time.RFC3339)
 }
 
-// processStorageRequest handles the common logic for storage operations
-func processStorageRequest(c echo.Context, path string, content string, notify []string) error {
-	absFullPath, err := validateAndResolvePath(path)
+// binarySniffLen is how much of a file looksBinary checks for NUL bytes,
+// matching the heuristic tools like git and grep use.
+const binarySniffLen = 1024
+
+// looksBinary reports whether content should be treated as binary: it has a
+// NUL byte near the start, or is not valid UTF-8 and so can't be carried in a
+// JSON string intact.
+func looksBinary(content []byte) bool {
+	sniff := content
+	if len(sniff) > binarySniffLen {
+		sniff = sniff[:binarySniffLen]
+	}
+	return bytes.IndexByte(sniff, 0) >= 0 || !utf8.Valid(content)
+}
+
+// handleGetFileLines returns an inclusive, 1-based range of lines of a file.
+// An endLine past the end of the file is clamped to it; a startLine past it
+// is an error, since there is nothing to return.
+func handleGetFileLines(c echo.Context, fullPath string, info os.FileInfo, req StorageRequest) error {
+	if info == nil || info.IsDir() {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "lines can only be read from files",
+		})
+	}
+
+	start, end := 1, 0
+	if req.StartLine != nil {
+		start = *req.StartLine
+	}
+	if req.EndLine != nil {
+		end = *req.EndLine
+	}
+
+	data, lines, err := readLineRange(fullPath, start, end)
 	if err != nil {
-		// Convert echo.NewHTTPError to JSON response for structured API
-		if httpErr, ok := err.(*echo.HTTPError); ok {
-			return c.JSON(httpErr.Code, StorageResponse{
-				Success: false,
-				Error:   httpErr.Message.(string),
-			})
+		logErrorf("Failed to read lines of %s: %v", fullPath, err)
+		if len(req.Notify) > 0 {
+			go sendStorageNotification(req.Notify, "GET", requestRelativePath(c, fullPath), false, "read file")
 		}
-		return err
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to read file",
+		})
 	}
-
-	// Handle based on HTTP method
-	switch c.Request().Method {
-	case http.MethodGet:
-		// Return file content in a structured response
-		return handleGetFile(c, absFullPath, notify)
-	case http.MethodPost:
-		return handleSaveFile(c, absFullPath, content, notify)
-	default:
-		return c.JSON(http.StatusMethodNotAllowed, StorageResponse{
+	if start > lines {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
 			Success: false,
-			Error:   "method not allowed",
+			Error:   fmt.Sprintf("startLine %d is past the end of the file (%d lines)", start, lines),
 		})
 	}
+
+	if len(req.Notify) > 0 {
+		go sendStorageNotification(req.Notify, "GET", requestRelativePath(c, fullPath), true, "retrieved successfully")
+	}
+
+	return c.JSON(http.StatusOK, StorageResponse{
+		Success: true,
+		Content: string(data),
+		ModTime: formatModTime(info),
+		Size:    contentSize(info),
+	})
 }
 
-// processStorageRequestRaw handles the common logic for raw file access
-func processStorageRequestRaw(c echo.Context, path string) error {
-	absFullPath, err := validateAndResolvePath(path)
+// readLineRange returns lines start through end (1-based, inclusive) of the
+// file at path, keeping their line endings, and stops reading once end is
+// reached; end <= 0 reads to the end of the file. lines is the number of lines
+// read, so lines < start means the file is shorter than start.
+func readLineRange(path string, start, end int) (data []byte, lines int, err error) {
+	var r io.Reader
+	if storageCipher != nil {
+		plain, err := readStoredFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		r = bytes.NewReader(plain)
+	} else {
+		f, err := openLockedFile(path, os.O_RDONLY, 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	br := bufio.NewReader(r)
+	var out bytes.Buffer
+	for end <= 0 || lines < end {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			lines++
+			if lines >= start {
+				out.Write(line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, lines, err
+		}
+	}
+	return out.Bytes(), lines, nil
+}
+
+// tailChunkSize is how much readLastLines reads per step while scanning
+// backwards for line breaks.
+const tailChunkSize = 4096
+
+// readLastLines returns the last n lines of the file at path, reading
+// backwards from the end in tailChunkSize steps so only the tail of a large
+// log is ever loaded. A newline terminating the final line does not count as
+// the start of an extra, empty line.
+func readLastLines(path string, n int) ([]byte, error) {
+	// Encrypted content can't be read from the middle, so the tail is found in
+	// the decrypted file instead.
+	if storageCipher != nil {
+		plain, err := readStoredFile(path)
+		if err != nil {
+			return nil, err
+		}
+		start, err := lastLinesStart(bytes.NewReader(plain), int64(len(plain)), n)
+		if err != nil {
+			return nil, err
+		}
+		return plain[start:], nil
+	}
+
+	f, err := openLockedFile(path, os.O_RDONLY, 0)
 	if err != nil {
-		// For raw file access, return the error directly (it's already an echo.NewHTTPError)
-		return err
+		return nil, err
 	}
+	defer f.Close()
 
-	// Return raw file content
-	return handleGetFileRaw(c, absFullPath)
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	start, err := lastLinesStart(f, size, n)
+	if err != nil {
+		return nil, err
+	}
+	return readFileRange(path, start, size-start)
 }
 
-// handleGetFile retrieves a file from storage and returns a structured response
-func handleGetFile(c echo.Context, fullPath string, notify []string) error {
-	// Check if file exists
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		// Send notification if requested
-		if len(notify) > 0 {
-			go sendStorageNotification(notify, "GET", fullPath, false, "find file")
+// lastLinesStart scans r (of the given size) backwards for the n-th line
+// break and returns the offset right after it, where the last n lines start.
+// If there are fewer than n lines the scan reaches offset 0.
+func lastLinesStart(r io.ReaderAt, size int64, n int) (int64, error) {
+	newlines := 0
+	buf := make([]byte, tailChunkSize)
+	for pos := size; pos > 0; {
+		chunk := int64(tailChunkSize)
+		if pos < chunk {
+			chunk = pos
+		}
+		pos -= chunk
+		if _, err := r.ReadAt(buf[:chunk], pos); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		for i := chunk - 1; i >= 0; i-- {
+			if buf[i] != '\n' || pos+i == size-1 {
+				continue
+			}
+			newlines++
+			if newlines == n {
+				return pos + i + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// readFileRange reads exactly length bytes starting at offset. The caller is
+// responsible for keeping the range within the file.
+func readFileRange(path string, offset, length int64) ([]byte, error) {
+	// Encrypted content has to be decrypted as a whole before slicing.
+	if storageCipher != nil {
+		plain, err := readStoredFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if offset+length > int64(len(plain)) {
+			return nil, io.ErrUnexpectedEOF
 		}
+		return plain[offset : offset+length], nil
+	}
+
+	f, err := openLockedFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, length)
+	n, err := f.ReadAt(buf, offset)
+	// ReadAt reports io.EOF when the read ends exactly at the end of the file;
+	// only a short read is an actual problem (e.g. the file shrank meanwhile).
+	if err != nil && !(errors.Is(err, io.EOF) && int64(n) == length) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// handleGetFileRaw retrieves a file from storage and returns just the content.
+// An empty contentType is guessed from the file's extension or content. Files
+// that can't be served from the read cache and aren't encrypted are streamed
+// from disk rather than loaded into memory.
+func handleGetFileRaw(c echo.Context, fullPath string, download bool, contentType string) error {
+	// Check if file exists; an expired one is as good as gone, and a path
+	// through a file, like a.txt/b, names nothing
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) || storageExpiry.expired(fullPath) {
 		return echo.NewHTTPError(http.StatusNotFound, "file not found")
 	}
 
-	// Read file content
-	content, err := os.ReadFile(fullPath)
+	var content []byte
+	var f *os.File
+	if err == nil {
+		if streamFromDisk(info) {
+			f, err = openLockedFile(fullPath, os.O_RDONLY, 0)
+		} else {
+			content, err = readStoredFileCached(fullPath, info)
+		}
+	}
 	if err != nil {
 		// Log the real error for debugging, but don't expose it to the client
-		log.Printf("Failed to read file %s: %v", fullPath, err)
+		logErrorf("Failed to read file %s: %v", fullPath, err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+	}
 
-		// Since we already checked that the file exists with os.Stat(),
-		// any read error is likely due to permissions, I/O issues, etc.
-		response := StorageResponse{
-			Success: false,
-			Error:   "failed to read file",
-		}
+	setRawFileHeaders(c, fullPath, info, download)
 
-		// Send notification if requested
-		if len(notify) > 0 {
-			go sendStorageNotification(notify, "GET", fullPath, false, "read file")
+	if f == nil {
+		if contentType == "" {
+			contentType = guessContentType(fullPath, content)
 		}
+		c.Response().Header().Set(echo.HeaderContentLength, strconv.Itoa(len(content)))
+		// Return just the file content
+		return c.Blob(http.StatusOK, contentType, content)
+	}
 
-		return c.JSON(http.StatusInternalServerError, response)
+	defer f.Close()
+	// Size the download from the open file, which is what gets streamed even
+	// if the path is replaced meanwhile.
+	if opened, err := f.Stat(); err == nil {
+		c.Response().Header().Set(echo.HeaderContentLength, strconv.FormatInt(opened.Size(), 10))
 	}
+	r := bufio.NewReader(f)
+	if contentType == "" {
+		// Peek returns what it could read along with an error for short
+		// files, which is all there is to sniff.
+		head, _ := r.Peek(sniffLen)
+		contentType = guessContentType(fullPath, head)
+	}
+	return c.Stream(http.StatusOK, contentType, r)
+}
 
-	// Return the actual file content in a structured response
-	response := StorageResponse{
-		Success: true,
-		Content: string(content),
+// streamFromDisk reports whether a file is served straight from disk: it must
+// be a regular, unencrypted file the read cache wouldn't hold anyway.
+func streamFromDisk(info os.FileInfo) bool {
+	if storageCipher != nil || !info.Mode().IsRegular() {
+		return false
 	}
+	return storageFileCache == nil || info.Size() > maxCachedFileSize
+}
 
-	// Send notification if requested
-	if len(notify) > 0 {
-		go sendStorageNotification(notify, "GET", fullPath, true, "retrieved successfully")
+// sniffLen is how much content http.DetectContentType looks at.
+const sniffLen = 512
+
+// guessContentType picks a Content-Type for a file from its extension, or
+// else by sniffing head, the start of its content.
+func guessContentType(fullPath string, head []byte) string {
+	if byExt := mime.TypeByExtension(filepath.Ext(fullPath)); byExt != "" {
+		return byExt
 	}
+	if len(head) > sniffLen {
+		head = head[:sniffLen]
+	}
+	return http.DetectContentType(head)
+}
 
-	return c.JSON(http.StatusOK, response)
+// unmodifiedSince returns the save precondition of a request: the ifModTime
+// field (RFC 3339, as returned in modTime) or else the If-Unmodified-Since
+// header. It returns nil when the save is unconditional.
+func unmodifiedSince(c echo.Context, ifModTime string) (*time.Time, error) {
+	if ifModTime != "" {
+		since, err := time.Parse(time.RFC3339, ifModTime)
+		if err != nil {
+			return nil, errors.New("ifModTime must be an RFC 3339 time, as returned in modTime")
+		}
+		return &since, nil
+	}
+	if header := c.Request().Header.Get("If-Unmodified-Since"); header != "" {
+		since, err := http.ParseTime(header)
+		if err != nil {
+			return nil, errors.New("If-Unmodified-Since must be an HTTP date")
+		}
+		return &since, nil
+	}
+	return nil, nil
 }
 
-// handleGetFileRaw retrieves a file from storage and returns just the content
-func handleGetFileRaw(c echo.Context, fullPath string) error {
-	// Check if file exists
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		return echo.NewHTTPError(http.StatusNotFound, "file not found")
+// parseModTime parses a request's modTime field, returning nil when it is
+// empty.
+func parseModTime(modTime string) (*time.Time, error) {
+	if modTime == "" {
+		return nil, nil
 	}
+	t, err := time.Parse(time.RFC3339, modTime)
+	if err != nil {
+		return nil, errors.New("modTime must be an RFC 3339 time")
+	}
+	return &t, nil
+}
 
-	// Read file content
-	content, err := os.ReadFile(fullPath)
+// changedSince reports why the file at path no longer matches a client's
+// copy read at since, or "" when it is unchanged. Modification times are
+// compared to the second, the precision of modTime and HTTP dates, so two
+// writes within the same second can't be told apart.
+func changedSince(path string, since time.Time) string {
+	info, err := os.Stat(path)
 	if err != nil {
-		// Log the real error for debugging, but don't expose it to the client
-		log.Printf("Failed to read file %s: %v", fullPath, err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "failed to read file")
+		return "file no longer exists"
 	}
+	if info.ModTime().Truncate(time.Second).After(since) {
+		return "file has been modified since " + since.UTC().Format(time.RFC3339)
+	}
+	return ""
+}
 
-	// Return just the file content
-	return c.String(http.StatusOK, string(content))
+// saveOptions are the optional conditions and attributes of a save.
+type saveOptions struct {
+	// since, when set, only lets the save happen if the file hasn't changed
+	// since then, so concurrent edits aren't silently overwritten; otherwise
+	// it fails with 412 Precondition Failed.
+	since *time.Time
+	// modTime, when set, is given to the saved file, e.g. to keep the
+	// original's when syncing.
+	modTime *time.Time
+	// ttl, when positive, makes the file expire that long after the save.
+	// Without one, the saved file is permanent, even if the file it replaced
+	// was due to expire.
+	ttl time.Duration
+	// maxDownloads, when positive, limits how many times the file can be
+	// read. Without one, any limit the replaced file had is lifted.
+	maxDownloads int64
 }
 
-// handleSaveFile saves a file to storage
-func handleSaveFile(c echo.Context, fullPath string, content string, notify []string) error {
-	// Create directory if it doesn't exist
-	dir := filepath.Dir(fullPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		log.Printf("Failed to create directory %s: %v", dir, err)
-		response := StorageResponse{
-			Success: false,
-			Error:   "failed to save file",
+// handleSaveFile saves a file to storage, as adjusted by opts.
+func handleSaveFile(c echo.Context, fullPath string, content string, notify []string, opts saveOptions) error {
+	// Serialize with other writes to this path: the quota accounting reads
+	// the old size before replacing the file, and the precondition must hold
+	// until the write is done.
+	unlock := storageLocks.lock(fullPath)
+	defer unlock()
+
+	if opts.since != nil {
+		if reason := changedSince(fullPath, *opts.since); reason != "" {
+			if len(notify) > 0 {
+				go sendStorageNotification(notify, "POST", requestRelativePath(c, fullPath), false, "save file (it changed since it was read)")
+			}
+			response := StorageResponse{
+				Success: false,
+				Error:   reason,
+			}
+			if info, err := os.Stat(fullPath); err == nil {
+				response.ModTime = formatModTime(info)
+				response.Size = contentSize(info)
+			}
+			return c.JSON(http.StatusPreconditionFailed, response)
 		}
+	}
 
-		// Send notification if requested
+	// Encrypt before anything else so the quota is charged for what actually
+	// lands on disk.
+	data, err := sealStorageData([]byte(content))
+	if err != nil {
+		logErrorf("Failed to encrypt file %s: %v", fullPath, err)
 		if len(notify) > 0 {
-			go sendStorageNotification(notify, "POST", fullPath, false, "create directory")
+			go sendStorageNotification(notify, "POST", requestRelativePath(c, fullPath), false, "encrypt file")
 		}
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to save file",
+		})
+	}
 
-		return c.JSON(http.StatusInternalServerError, response)
+	// Charge the size difference against the quota before writing, so
+	// overwriting a file with a smaller one always fits.
+	var quotaDelta int64
+	if storageUsage != nil {
+		quotaDelta = int64(len(data))
+		if info, err := os.Stat(fullPath); err == nil && info.Mode().IsRegular() {
+			quotaDelta -= info.Size()
+		}
+		if !storageUsage.reserve(quotaDelta) {
+			setQuotaHeader(c)
+			if len(notify) > 0 {
+				go sendStorageNotification(notify, "POST", requestRelativePath(c, fullPath), false, "storage quota exceeded")
+			}
+			return c.JSON(http.StatusInsufficientStorage, StorageResponse{
+				Success: false,
+				Error:   "storage quota exceeded",
+			})
+		}
 	}
 
-	// Write file content
-	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-		log.Printf("Failed to write file %s: %v", fullPath, err)
-		response := StorageResponse{
-			Success: false,
-			Error:   "failed to save file",
+	// Create directory if it doesn't exist
+	dir := filepath.Dir(fullPath)
+	if err := mkdirStorage(dir); err != nil {
+		logErrorf("Failed to create directory %s: %v", dir, err)
+		if storageUsage != nil {
+			storageUsage.release(quotaDelta)
 		}
+		return saveFileFailed(c, "POST", fullPath, notify, "create directory", err)
+	}
 
-		// Send notification if requested
-		if len(notify) > 0 {
-			go sendStorageNotification(notify, "POST", fullPath, false, "write file")
+	// Write file content
+	defer invalidateCachedFile(fullPath)
+	if err := saveFileData(fullPath, data); err != nil {
+		logErrorf("Failed to write file %s: %v", fullPath, err)
+		if storageUsage != nil {
+			storageUsage.release(quotaDelta)
 		}
+		return saveFileFailed(c, "POST", fullPath, notify, "write file", err)
+	}
 
-		return c.JSON(http.StatusInternalServerError, response)
+	// The access time is left alone (a zero time means unchanged). A failure
+	// doesn't undo the save; the modTime in the response shows what the file
+	// ended up with.
+	if opts.modTime != nil {
+		if err := os.Chtimes(fullPath, time.Time{}, *opts.modTime); err != nil {
+			logWarnf("Failed to set modification time of %s: %v", fullPath, err)
+		}
 	}
 
+	setQuotaHeader(c)
 	response := StorageResponse{
 		Success: true,
 		Content: "File saved successfully",
 	}
+	if opts.ttl > 0 {
+		expiresAt := time.Now().Add(opts.ttl)
+		storageExpiry.set(fullPath, expiresAt)
+		response.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	} else {
+		storageExpiry.clear(fullPath)
+	}
+	storageDownloads.limit(fullPath, opts.maxDownloads)
+	// The new modTime lets a client make its next conditional save without
+	// reading the file again.
+	if info, err := os.Stat(fullPath); err == nil {
+		response.ModTime = formatModTime(info)
+		response.Size = contentSize(info)
+	}
 
 	// Send notification if requested
 	if len(notify) > 0 {
-		go sendStorageNotification(notify, "POST", fullPath, true, "saved successfully")
+		go sendStorageNotification(notify, "POST", requestRelativePath(c, fullPath), true, "saved successfully")
 	}
 
 	return c.JSON(http.StatusOK, response)
 }
 
+// forgetStoredFile drops the expiry and download count of the file at path,
+// removed or replaced other than by a save, so neither carries over to a new
+// file there.
+func forgetStoredFile(path string) {
+	storageExpiry.clear(path)
+	storageDownloads.forget(path)
+}
+
+// saveFileData writes a saved file's content to disk. A variable so tests can
+// simulate write failures such as a full disk.
+var saveFileData = writeStorageFile
+
+// storageCodeDiskFull is the StorageResponse code of a save that failed because
+// the disk holding the storage directory is full.
+const storageCodeDiskFull = "disk_full"
+
+// saveFileFailed answers a save, by operation, whose directory or file could
+// not be written, notifying the recipients in notify of what failed. A full
+// disk gets 507 Insufficient Storage with code disk_full, since clients can
+// retry once space is freed; any other error is a plain 500.
+func saveFileFailed(c echo.Context, operation, fullPath string, notify []string, what string, err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		if len(notify) > 0 {
+			go sendStorageNotification(notify, operation, requestRelativePath(c, fullPath), false, what+" (disk is full)")
+		}
+		return c.JSON(http.StatusInsufficientStorage, StorageResponse{
+			Success: false,
+			Error:   "disk is full",
+			Code:    storageCodeDiskFull,
+		})
+	}
+
+	// Send notification if requested
+	if len(notify) > 0 {
+		go sendStorageNotification(notify, operation, requestRelativePath(c, fullPath), false, what)
+	}
+	return c.JSON(http.StatusInternalServerError, StorageResponse{
+		Success: false,
+		Error:   "failed to save file",
+	})
+}
+
 // isValidPath validates that the path doesn't contain dangerous characters or directory traversal
 func isValidPath(path string) bool {
 
@@ -295,8 +1835,10 @@ func isValidPath(path string) bool {
 	return true
 }
 
-// sendStorageNotification sends a notification about storage operations
-func sendStorageNotification(notify []string, operation string, filePath string, success bool, message string) {
+// sendStorageNotification sends a notification about storage operations on
+// the file at path, as the client addresses it (see requestRelativePath), so
+// a tenant's notifications never reveal its storage_dir.
+func sendStorageNotification(notify []string, operation string, path string, success bool, message string) {
 	if len(notify) == 0 {
 		return
 	}
@@ -304,24 +1846,17 @@ func sendStorageNotification(notify []string, operation string, filePath string,
 	// Expand groups to individual recipients
 	expandedRecipients := expandGroups(notify)
 
-	// Create notification message
-	var notificationMessage string
-	fileName := filepath.Base(filePath)
-	if success {
-		notificationMessage = fmt.Sprintf("%s %s", fileName, message)
-	} else {
-		notificationMessage = fmt.Sprintf("Failed to %s %s: %s", operation, fileName, message)
-	}
+	notificationMessage := formatStorageNotification(operation, path, success, message)
 
-	// Send messages to all recipients
-	results := sendMessages(expandedRecipients, notificationMessage)
+	// Deliver through the configured notifier backend
+	results := storageNotifier.Notify(expandedRecipients, notificationMessage)
 
 	// Log the notification results
 	for _, result := range results {
 		if result.Success {
-			log.Printf("Storage notification sent successfully to %s", result.Recipient)
+			logDebugf("Storage notification sent successfully to %s", result.Recipient)
 		} else {
-			log.Printf("Failed to send storage notification to %s: %s", result.Recipient, *result.Error)
+			logWarnf("Failed to send storage notification to %s: %s", result.Recipient, *result.Error)
 		}
 	}
 }
@@ -0,0 +1,1241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// useTempStorage points the package-level config at a fresh temp storage
+// directory for the duration of the test and returns that directory.
+func useTempStorage(t *testing.T) string {
+	t.Helper()
+	prev := appConfig
+	dir := t.TempDir()
+	appConfig = defaultConfig()
+	appConfig.Storage.Dir = dir
+	t.Cleanup(func() { appConfig = prev })
+	return dir
+}
+
+// doStorageJSON runs handler against a JSON request body and returns the
+// recorded response.
+func doStorageJSON(t *testing.T, handler echo.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	if err := handler(e.NewContext(req, rec)); err != nil {
+		e.HTTPErrorHandler(err, e.NewContext(req, rec))
+	}
+	return rec
+}
+
+func TestHandleStorageExists(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.WriteFile(filepath.Join(dir, "present.txt"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"/present.txt", true},
+		{"/missing.txt", false},
+		{"/", true}, // the storage root itself
+	}
+	for _, tc := range cases {
+		rec := doStorageJSON(t, handleStorageExists, http.MethodPost, "/api/storage/exists", `{"path":"`+tc.path+`"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", tc.path, rec.Code, rec.Body.String())
+		}
+		var resp StorageExistsResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: decode: %v", tc.path, err)
+		}
+		if resp.Exists != tc.want {
+			t.Errorf("%s: exists = %v, want %v", tc.path, resp.Exists, tc.want)
+		}
+	}
+
+	// Traversal is rejected before anything is stat'ed.
+	if rec := doStorageJSON(t, handleStorageExists, http.MethodPost, "/api/storage/exists", `{"path":"/../etc/passwd"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("traversal: status = %d, want 400", rec.Code)
+	}
+	if rec := doStorageJSON(t, handleStorageExists, http.MethodPost, "/api/storage/exists", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing path: status = %d, want 400", rec.Code)
+	}
+}
+
+// TestHandleGetFileStatErrors checks a read answers 404 for a path through a
+// file and 500 for other failures to stat it, rather than reading a file it
+// knows nothing about.
+func TestHandleGetFileStatErrors(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "a.txt")
+
+	for path, want := range map[string]int{
+		"/a.txt/b":                     http.StatusNotFound,
+		"/" + strings.Repeat("x", 300): http.StatusInternalServerError,
+	} {
+		for _, extra := range []string{"", `,"tail":1`, `,"offset":0`} {
+			body := `{"path":"` + path + `"` + extra + `}`
+			if rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", body); rec.Code != want {
+				t.Errorf("%.40s: status = %d, want %d", body, rec.Code, want)
+			}
+		}
+	}
+}
+
+func TestHandleStorageByteRange(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.WriteFile(filepath.Join(dir, "log.txt"), []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		body string
+		want string
+	}{
+		{`{"path":"/log.txt","offset":2,"length":3}`, "234"},
+		{`{"path":"/log.txt","offset":7}`, "789"},            // no length: read to the end
+		{`{"path":"/log.txt","length":4}`, "0123"},           // no offset: start at 0
+		{`{"path":"/log.txt","offset":8,"length":50}`, "89"}, // clamped to EOF
+		{`{"path":"/log.txt","offset":10}`, ""},              // exactly at EOF
+	}
+	for _, tc := range cases {
+		rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", tc.body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", tc.body, rec.Code, rec.Body.String())
+		}
+		var resp StorageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Encoding != "base64" {
+			t.Errorf("%s: encoding = %q, want base64", tc.body, resp.Encoding)
+		}
+		got, err := base64.StdEncoding.DecodeString(resp.Content)
+		if err != nil {
+			t.Fatalf("%s: decode content: %v", tc.body, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: content = %q, want %q", tc.body, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"path":"/log.txt","offset":11}`,
+		`{"path":"/log.txt","offset":-1}`,
+		`{"path":"/log.txt","length":-5}`,
+	} {
+		if rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", bad, rec.Code)
+		}
+	}
+}
+
+func TestReadLastLines(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	// A file spanning several chunks, so the backwards scan crosses chunk
+	// boundaries.
+	var big strings.Builder
+	for i := 0; i < 5000; i++ {
+		big.WriteString(strings.Repeat("x", i%7) + "\n")
+	}
+	bigLines := strings.SplitAfter(big.String(), "\n")
+	bigLines = bigLines[:len(bigLines)-1] // drop the empty element after the final "\n"
+
+	cases := []struct {
+		name    string
+		content string
+		n       int
+		want    string
+	}{
+		{"trailing.log", "a\nb\nc\n", 2, "b\nc\n"},
+		{"no-trailing.log", "a\nb\nc", 2, "b\nc"},
+		{"short.log", "a\nb\n", 10, "a\nb\n"}, // fewer lines than requested
+		{"exact.log", "a\nb\n", 2, "a\nb\n"},
+		{"empty.log", "", 3, ""},
+		{"blank-lines.log", "a\n\n\n", 2, "\n\n"},
+		{"big.log", big.String(), 1000, strings.Join(bigLines[len(bigLines)-1000:], "")},
+	}
+	for _, tc := range cases {
+		got, err := readLastLines(write(tc.name, tc.content), tc.n)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: readLastLines(%d) = %q, want %q", tc.name, tc.n, got, tc.want)
+		}
+	}
+}
+
+// fakeNotifier records notifications instead of delivering them.
+type fakeNotifier struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeNotifier) Notify(recipients []string, message string) []MessageResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var results []MessageResult
+	for _, r := range recipients {
+		f.calls = append(f.calls, r+": "+message)
+		results = append(results, MessageResult{Recipient: r, Success: true})
+	}
+	return results
+}
+
+func TestSendStorageNotificationUsesNotifier(t *testing.T) {
+	useTempStorage(t)
+	appConfig.Messages.Groups = map[string][]string{"ops": {"+15550000001", "+15550000002"}}
+
+	fake := &fakeNotifier{}
+	prev := storageNotifier
+	storageNotifier = fake
+	t.Cleanup(func() { storageNotifier = prev })
+
+	sendStorageNotification([]string{"ops"}, "POST", "/report.txt", true, "saved successfully")
+	sendStorageNotification([]string{"+15550000003"}, "GET", "/missing.txt", false, "find file")
+
+	want := []string{
+		"+15550000001: report.txt saved successfully",
+		"+15550000002: report.txt saved successfully",
+		"+15550000003: Failed to GET missing.txt: find file",
+	}
+	if strings.Join(fake.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("notifications = %q, want %q", fake.calls, want)
+	}
+}
+
+func TestSendStorageNotificationTemplate(t *testing.T) {
+	useTempStorage(t)
+	appConfig.Storage.NotifyTemplate = `{{.Operation}} {{.Path}} {{if .Success}}ok{{else}}failed ({{.Message}}){{end}}`
+
+	fake := &fakeNotifier{}
+	prev := storageNotifier
+	storageNotifier = fake
+	t.Cleanup(func() { storageNotifier = prev })
+
+	sendStorageNotification([]string{"+15550000001"}, "POST", "/docs/report.txt", true, "saved successfully")
+	sendStorageNotification([]string{"+15550000001"}, "GET", "/missing.txt", false, "find file")
+
+	want := []string{
+		"+15550000001: POST /docs/report.txt ok",
+		"+15550000001: GET /missing.txt failed (find file)",
+	}
+	if strings.Join(fake.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("notifications = %q, want %q", fake.calls, want)
+	}
+
+	// Per-operation templates take precedence; other operations keep
+	// notify_template.
+	appConfig.Storage.NotifyMessages = map[string]string{"POST": "Saved {{.Path}}"}
+	fake.calls = nil
+	sendStorageNotification([]string{"+15550000001"}, "POST", "/docs/report.txt", true, "saved successfully")
+	sendStorageNotification([]string{"+15550000001"}, "GET", "/missing.txt", false, "find file")
+	want = []string{
+		"+15550000001: Saved /docs/report.txt",
+		"+15550000001: GET /missing.txt failed (find file)",
+	}
+	if strings.Join(fake.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("notifications = %q, want %q", fake.calls, want)
+	}
+
+	if _, err := parseNotifyTemplate("{{.Nope}}"); err == nil {
+		t.Error("unknown field: expected an error")
+	}
+	if _, err := parseNotifyTemplate("{{.FileName"); err == nil {
+		t.Error("unterminated action: expected an error")
+	}
+}
+
+func TestNewNotifier(t *testing.T) {
+	for _, name := range []string{"", "imessage", "log", "LOG"} {
+		if _, err := newNotifier(StorageConfig{Notifier: name}); err != nil {
+			t.Errorf("newNotifier(%q): %v", name, err)
+		}
+	}
+	if _, err := newNotifier(StorageConfig{Notifier: "webhook"}); err == nil {
+		t.Error("webhook notifier without a URL should be rejected")
+	}
+	if _, err := newNotifier(StorageConfig{Notifier: "pager"}); err == nil {
+		t.Error("unknown notifier should be rejected")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got struct {
+		Recipients []string `json:"recipients"`
+		Message    string   `json:"message"`
+	}
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode webhook body: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	n, err := newNotifier(StorageConfig{Notifier: "webhook", WebhookURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := n.Notify([]string{"+15550000001", "+15550000002"}, "report.txt saved successfully")
+	if len(results) != 2 || !results[0].Success || !results[1].Success {
+		t.Fatalf("results = %+v, want two successes", results)
+	}
+	if got.Message != "report.txt saved successfully" || len(got.Recipients) != 2 {
+		t.Errorf("webhook body = %+v", got)
+	}
+
+	status = http.StatusBadGateway
+	results = n.Notify([]string{"+15550000001"}, "hi")
+	if results[0].Success || results[0].Error == nil || !strings.Contains(*results[0].Error, "502") {
+		t.Errorf("results = %+v, want a 502 failure", results)
+	}
+}
+
+func TestWebhookNotifierHeadersAndRetries(t *testing.T) {
+	prevDelay := webhookRetryDelay
+	webhookRetryDelay = time.Millisecond
+	t.Cleanup(func() { webhookRetryDelay = prevDelay })
+
+	var attempts int
+	statuses := []int{http.StatusServiceUnavailable, http.StatusOK}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want the configured header", got)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		w.WriteHeader(statuses[attempts%len(statuses)])
+		attempts++
+	}))
+	defer srv.Close()
+
+	n, err := newNotifier(StorageConfig{
+		Notifier:       "webhook",
+		WebhookURL:     srv.URL,
+		WebhookHeaders: map[string]string{"Authorization": "Bearer secret"},
+		WebhookRetries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results := n.Notify([]string{"+15550000001"}, "hi"); !results[0].Success || attempts != 2 {
+		t.Errorf("results = %+v after %d attempts, want success on the retry", results, attempts)
+	}
+
+	// A client error won't go away by retrying.
+	attempts, statuses = 0, []int{http.StatusUnauthorized}
+	if results := n.Notify([]string{"+15550000001"}, "hi"); results[0].Success || attempts != 1 {
+		t.Errorf("results = %+v after %d attempts, want one failed attempt", results, attempts)
+	}
+
+	attempts, statuses = 0, []int{http.StatusBadGateway}
+	if results := n.Notify([]string{"+15550000001"}, "hi"); results[0].Success || attempts != 3 {
+		t.Errorf("results = %+v after %d attempts, want 3 failed attempts", results, attempts)
+	}
+}
+
+// doStorageRaw routes a GET for target through the raw /api/storage/* handler
+// and returns the recorded response.
+func doStorageRaw(t *testing.T, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	e.Any("/api/storage/*", handleStorageWithPath)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec
+}
+
+func TestRawGetDownload(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.WriteFile(filepath.Join(dir, "report.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := doStorageRaw(t, "/api/storage/report.txt")
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentDisposition) != "" {
+		t.Errorf("plain GET: status %d, Content-Disposition %q; want 200 and none", rec.Code, rec.Header().Get(echo.HeaderContentDisposition))
+	}
+
+	rec = doStorageRaw(t, "/api/storage/report.txt?download=1")
+	if got, want := rec.Header().Get(echo.HeaderContentDisposition), `attachment; filename=report.txt`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	if rec.Body.String() != "hello" {
+		t.Errorf("body = %q, want file content", rec.Body.String())
+	}
+	if got := rec.Header().Get(echo.HeaderContentLength); got != "5" {
+		t.Errorf("Content-Length = %q, want 5", got)
+	}
+
+	rec = doStorageRaw(t, "/api/storage/missing.txt?download=1")
+	if rec.Code != http.StatusNotFound || rec.Header().Get(echo.HeaderContentDisposition) != "" {
+		t.Errorf("missing file: status %d, Content-Disposition %q; want 404 and none", rec.Code, rec.Header().Get(echo.HeaderContentDisposition))
+	}
+}
+
+func TestRawGetContentType(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.WriteFile(filepath.Join(dir, "latest"), []byte(`{"ok":true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		query      string
+		wantStatus int
+		wantType   string
+	}{
+		{"", http.StatusOK, echo.MIMETextPlainCharsetUTF8},
+		{"?contentType=application/json", http.StatusOK, "application/json"},
+		{"?contentType=text/csv%3B%20charset=utf-8", http.StatusOK, "text/csv; charset=utf-8"},
+		{"?contentType=not%20a%20type", http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		rec := doStorageRaw(t, "/api/storage/latest"+tc.query)
+		if rec.Code != tc.wantStatus {
+			t.Errorf("%q: status = %d, want %d", tc.query, rec.Code, tc.wantStatus)
+			continue
+		}
+		if tc.wantType != "" && rec.Header().Get(echo.HeaderContentType) != tc.wantType {
+			t.Errorf("%q: Content-Type = %q, want %q", tc.query, rec.Header().Get(echo.HeaderContentType), tc.wantType)
+		}
+	}
+}
+
+func TestHandleStorageMkdir(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("hi"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/uploads/2024/photos", http.StatusOK},
+		{"/uploads/2024", http.StatusOK}, // already exists
+		{"/file.txt", http.StatusConflict},
+		{"/file.txt/sub", http.StatusConflict},
+		{"/../escape", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		rec := doStorageJSON(t, handleStorageMkdir, http.MethodPost, "/api/storage/mkdir", `{"path":"`+tc.path+`"}`)
+		if rec.Code != tc.wantStatus {
+			t.Errorf("mkdir %q: status = %d, want %d (%s)", tc.path, rec.Code, tc.wantStatus, rec.Body.String())
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, "uploads", "2024", "photos")); err != nil || !info.IsDir() {
+		t.Errorf("directory not created: %v", err)
+	}
+}
+
+// TestSaveFileUsesConfiguredModes checks created directories and files get the
+// configured permissions exactly, even where the umask would narrow them.
+func TestSaveFileUsesConfiguredModes(t *testing.T) {
+	dir := useTempStorage(t)
+	appConfig.Storage.dirMode = 0o775
+	appConfig.Storage.fileMode = 0o660
+
+	rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/shared/team/notes.txt","content":"hi"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("save: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, p := range []string{"shared", "shared/team"} {
+		info, err := os.Stat(filepath.Join(dir, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o775 {
+			t.Errorf("%s mode = %o, want 775", p, info.Mode().Perm())
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, "shared/team/notes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o660 {
+		t.Errorf("file mode = %o, want 660", info.Mode().Perm())
+	}
+
+	// The pre-existing storage root itself is left alone.
+	if info, _ := os.Stat(dir); info.Mode().Perm() == 0o775 {
+		t.Error("existing storage directory should not be chmod'ed")
+	}
+}
+
+// TestRawRouteMethodNotAllowed checks requests to /api/storage/* other than
+// GET, HEAD, PUT and POST get the handler's JSON 405, while the static POST
+// sub-routes still win.
+func TestRawRouteMethodNotAllowed(t *testing.T) {
+	useTempStorage(t)
+	e := echo.New()
+	e.POST("/api/storage/exists", handleStorageExists)
+	e.Any("/api/storage/*", handleStorageWithPath)
+
+	for _, method := range []string{http.MethodDelete, http.MethodPatch} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, "/api/storage/file.txt", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s: status = %d, want 405", method, rec.Code)
+			continue
+		}
+		var resp StorageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Success || !strings.Contains(resp.Error, "method not allowed") {
+			t.Errorf("%s: body = %s, want StorageResponse with method not allowed", method, rec.Body.String())
+		}
+		if rec.Header().Get(echo.HeaderAllow) != "GET, HEAD, PUT, POST" {
+			t.Errorf("%s: Allow = %q, want GET, HEAD, PUT, POST", method, rec.Header().Get(echo.HeaderAllow))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/storage/exists", strings.NewReader(`{"path":"/x"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"exists"`) {
+		t.Errorf("POST /api/storage/exists was not routed to its handler: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestRawRouteUpload checks PUT and POST to /api/storage/* store the body
+// byte for byte, whatever its content type, and the file reads back the same.
+// TestRawHead checks HEAD on the raw route sends GET's headers without a
+// body, and doesn't count as a download.
+func TestRawHead(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.WriteFile(filepath.Join(dir, "report.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	storageDownloads.limit(filepath.Join(dir, "report.txt"), 1)
+	t.Cleanup(func() { storageDownloads.load(false, "") })
+
+	e := echo.New()
+	e.Any("/api/storage/*", handleStorageWithPath)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	head := do(http.MethodHead, "/api/storage/report.txt?download=1")
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Fatalf("HEAD: status %d, body %q; want 200 and no body", head.Code, head.Body.String())
+	}
+	get := do(http.MethodGet, "/api/storage/report.txt?download=1")
+	if get.Code != http.StatusOK {
+		t.Fatalf("GET after HEAD: status %d, want 200 as HEAD took no download", get.Code)
+	}
+	for _, name := range []string{echo.HeaderContentLength, echo.HeaderContentType, echo.HeaderLastModified, "ETag", echo.HeaderContentDisposition} {
+		if got, want := head.Header().Get(name), get.Header().Get(name); got == "" || got != want {
+			t.Errorf("HEAD %s = %q, GET sent %q", name, got, want)
+		}
+	}
+
+	for target, want := range map[string]int{
+		"/api/storage/report.txt":  http.StatusGone,
+		"/api/storage/missing.txt": http.StatusNotFound,
+	} {
+		if rec := do(http.MethodHead, target); rec.Code != want || rec.Body.Len() != 0 {
+			t.Errorf("HEAD %s: status %d, body %q; want %d and no body", target, rec.Code, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestRawGetIndexFile(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "site/index.html", "site/blog/post.txt")
+	if err := os.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("<h1>Hi</h1>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := doStorageRaw(t, "/api/storage/site/")
+	if rec.Code != http.StatusOK || rec.Body.String() != "<h1>Hi</h1>" || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "text/html") {
+		t.Errorf("directory: got %d %q as %q, want index.html as text/html", rec.Code, rec.Body.String(), rec.Header().Get(echo.HeaderContentType))
+	}
+	if rec := doStorageRaw(t, "/api/storage/site?contentType=text/plain"); rec.Header().Get(echo.HeaderContentType) != "text/plain" {
+		t.Errorf("contentType override: Content-Type = %q, want text/plain", rec.Header().Get(echo.HeaderContentType))
+	}
+	if rec := doStorageRaw(t, "/api/storage/site/blog"); rec.Code != http.StatusForbidden {
+		t.Errorf("directory without an index: status = %d, want 403", rec.Code)
+	}
+
+	appConfig.Storage.IndexFile = "post.txt"
+	if rec := doStorageRaw(t, "/api/storage/site/blog"); rec.Code != http.StatusOK {
+		t.Errorf("configured index: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestRawRouteUpload(t *testing.T) {
+	dir := useTempStorage(t)
+	e := echo.New()
+	e.Any("/api/storage/*", handleStorageWithPath)
+
+	upload := func(method, target, contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set(echo.HeaderContentType, contentType)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	binary := []byte{0x89, 'P', 'N', 'G', 0, 1, 2, 0xff}
+	cases := []struct {
+		method, path, contentType string
+		body                      []byte
+	}{
+		{http.MethodPut, "/docs/image.png", "image/png", binary},
+		{http.MethodPost, "/config.json", echo.MIMEApplicationJSON, []byte(`{"path":"/not-a-request"}`)},
+		{http.MethodPut, "/empty.txt", "", nil},
+	}
+	for _, tc := range cases {
+		rec := upload(tc.method, "/api/storage"+tc.path, tc.contentType, tc.body)
+		var resp StorageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK || !resp.Success {
+			t.Errorf("%s %s: %d %s", tc.method, tc.path, rec.Code, rec.Body.String())
+			continue
+		}
+		got, err := os.ReadFile(filepath.Join(dir, tc.path))
+		if err != nil || !bytes.Equal(got, tc.body) {
+			t.Errorf("%s %s: stored %q (%v), want %q", tc.method, tc.path, got, err, tc.body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/storage/docs/image.png", nil))
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), binary) {
+		t.Errorf("read back: %d %q", rec.Code, rec.Body.Bytes())
+	}
+	lastModified := rec.Header().Get(echo.HeaderLastModified)
+
+	// A conditional upload with the Last-Modified of the read succeeds; one
+	// predating it is rejected.
+	req := httptest.NewRequest(http.MethodPut, "/api/storage/docs/image.png", strings.NewReader("v2"))
+	req.Header.Set("If-Unmodified-Since", "Mon, 01 Jan 2001 00:00:00 GMT")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Unmodified-Since: status = %d, want 412", rec.Code)
+	}
+	req = httptest.NewRequest(http.MethodPut, "/api/storage/docs/image.png", strings.NewReader("v2"))
+	req.Header.Set("If-Unmodified-Since", lastModified)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("current If-Unmodified-Since: status = %d, want 200", rec.Code)
+	}
+
+	if rec := upload(http.MethodPut, "/api/storage/../escape.txt", "", []byte("x")); rec.Code == http.StatusOK {
+		t.Errorf("traversal upload succeeded")
+	}
+}
+
+func TestGetFileLineRange(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.WriteFile(filepath.Join(dir, "conf.txt"), []byte("one\ntwo\nthree\nfour\nfive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		body        string
+		wantStatus  int
+		wantContent string
+	}{
+		{`"startLine":2,"endLine":3`, http.StatusOK, "two\nthree\n"},
+		{`"startLine":4`, http.StatusOK, "four\nfive"},
+		{`"endLine":1`, http.StatusOK, "one\n"},
+		{`"startLine":3,"endLine":99`, http.StatusOK, "three\nfour\nfive"},
+		{`"startLine":5,"endLine":5`, http.StatusOK, "five"},
+		{`"startLine":6`, http.StatusBadRequest, ""},
+		{`"startLine":3,"endLine":2`, http.StatusBadRequest, ""},
+		{`"startLine":0`, http.StatusBadRequest, ""},
+		{`"startLine":1,"tail":2`, http.StatusBadRequest, ""},
+	}
+	for _, tc := range cases {
+		rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/conf.txt",`+tc.body+`}`)
+		if rec.Code != tc.wantStatus {
+			t.Errorf("%s: status = %d, want %d (%s)", tc.body, rec.Code, tc.wantStatus, rec.Body.String())
+			continue
+		}
+		if tc.wantStatus != http.StatusOK {
+			continue
+		}
+		var resp StorageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Content != tc.wantContent {
+			t.Errorf("%s: content = %q, want %q", tc.body, resp.Content, tc.wantContent)
+		}
+	}
+}
+
+func TestHandleStoragePatch(t *testing.T) {
+	dir := useTempStorage(t)
+	path := filepath.Join(dir, "db.yaml")
+	if err := os.WriteFile(path, []byte("host: a\nport: 5432\nreplica_port: 5432\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		return doStorageJSON(t, handleStoragePatch, http.MethodPatch, "/api/storage", body)
+	}
+
+	if rec := patch(`{"path":"/db.yaml","find":"5432","replace":"6432"}`); rec.Code != http.StatusOK {
+		t.Fatalf("patch: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := os.ReadFile(path); string(got) != "host: a\nport: 6432\nreplica_port: 5432\n" {
+		t.Errorf("after first-occurrence patch: %q", got)
+	}
+
+	if rec := patch(`{"path":"/db.yaml","find":"port: ","replace":"port: 1","all":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("patch all: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := os.ReadFile(path); string(got) != "host: a\nport: 16432\nreplica_port: 15432\n" {
+		t.Errorf("after replace-all patch: %q", got)
+	}
+
+	cases := []struct {
+		body       string
+		wantStatus int
+	}{
+		{`{"path":"/db.yaml","find":"nope","replace":"x"}`, http.StatusConflict},
+		{`{"path":"/missing.yaml","find":"a","replace":"b"}`, http.StatusNotFound},
+		{`{"path":"/db.yaml","replace":"b"}`, http.StatusBadRequest},
+		{`{"path":"/../db.yaml","find":"a","replace":"b"}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if rec := patch(tc.body); rec.Code != tc.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tc.body, rec.Code, tc.wantStatus)
+		}
+	}
+
+	// The atomic write must not leave temp files behind.
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("storage dir has %d entries, want only db.yaml", len(entries))
+	}
+}
+
+func TestHandleStoragePatchAppendLine(t *testing.T) {
+	dir := useTempStorage(t)
+	patch := func(body string) *httptest.ResponseRecorder {
+		return doStorageJSON(t, handleStoragePatch, http.MethodPatch, "/api/storage", body)
+	}
+
+	// A missing file is created, with its directory.
+	for _, body := range []string{
+		`{"path":"/logs/app.log","appendLine":"started"}`,
+		`{"path":"/logs/app.log","appendLine":"ready\n"}`,
+		`{"path":"/logs/app.log","appendLine":""}`,
+	} {
+		if rec := patch(body); rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "logs", "app.log")); string(got) != "started\nready\n\n" {
+		t.Errorf("after appends: %q", got)
+	}
+
+	// A file without a trailing newline gets one before the line.
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("first"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if rec := patch(`{"path":"/notes.txt","appendLine":"second"}`); rec.Code != http.StatusOK {
+		t.Fatalf("append: status %d: %s", rec.Code, rec.Body.String())
+	}
+	if got, _ := os.ReadFile(path); string(got) != "first\nsecond\n" {
+		t.Errorf("after append to unterminated file: %q", got)
+	}
+
+	for body, want := range map[string]int{
+		`{"path":"/notes.txt","appendLine":"a\nb"}`:         http.StatusBadRequest,
+		`{"path":"/notes.txt","appendLine":"a","find":"b"}`: http.StatusBadRequest,
+		`{"path":"/logs","appendLine":"a"}`:                 http.StatusBadRequest,
+		`{"path":"/../escape.log","appendLine":"a"}`:        http.StatusBadRequest,
+	} {
+		if rec := patch(body); rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, want)
+		}
+	}
+
+	// Concurrent appends each land whole.
+	const writers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec := patch(`{"path":"/concurrent.log","appendLine":"0123456789"}`); rec.Code != http.StatusOK {
+				t.Errorf("concurrent append: status %d: %s", rec.Code, rec.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := os.ReadFile(filepath.Join(dir, "concurrent.log")); string(got) != strings.Repeat("0123456789\n", writers) {
+		t.Errorf("concurrent appends: got %d bytes, want %d lines", len(got), writers)
+	}
+}
+
+func TestGetFileEncodesBinary(t *testing.T) {
+	dir := useTempStorage(t)
+	files := map[string][]byte{
+		"text.txt":  []byte("héllo\n"),
+		"image.png": {0x89, 'P', 'N', 'G', 0x00, 0x01},
+		"latin1":    {'c', 'a', 'f', 0xE9},
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, data := range files {
+		rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/`+name+`"}`)
+		var resp StorageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		got := []byte(resp.Content)
+		if name != "text.txt" {
+			if resp.Encoding != "base64" {
+				t.Errorf("%s: encoding = %q, want base64", name, resp.Encoding)
+				continue
+			}
+			var err error
+			if got, err = base64.StdEncoding.DecodeString(resp.Content); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		} else if resp.Encoding != "" {
+			t.Errorf("%s: encoding = %q, want none", name, resp.Encoding)
+		}
+		if string(got) != string(data) {
+			t.Errorf("%s: content = %q, want %q", name, got, data)
+		}
+	}
+}
+
+func TestGetFileReportsModTime(t *testing.T) {
+	dir := useTempStorage(t)
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{
+		`{"path":"/notes.txt"}`,
+		`{"path":"/notes.txt","tail":1}`,
+		`{"path":"/notes.txt","offset":0,"length":3}`,
+		`{"path":"/notes.txt","startLine":2}`,
+	} {
+		rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", body)
+		var resp StorageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.ModTime != "2024-05-01T12:00:00Z" {
+			t.Errorf("%s: modTime = %q", body, resp.ModTime)
+		}
+		if resp.Size == nil || *resp.Size != 8 {
+			t.Errorf("%s: size = %v, want 8", body, resp.Size)
+		}
+	}
+}
+
+// TestSaveFileIfUnmodified checks conditional saves via ifModTime and
+// If-Unmodified-Since: a stale precondition is rejected with 412 and leaves
+// the file alone, a current one saves and returns the new modTime.
+func TestSaveFileIfUnmodified(t *testing.T) {
+	dir := useTempStorage(t)
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("original"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	save := func(body, header string) (int, StorageResponse) {
+		t.Helper()
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/api/storage", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if header != "" {
+			req.Header.Set("If-Unmodified-Since", header)
+		}
+		rec := httptest.NewRecorder()
+		if err := handleStorage(e.NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		var resp StorageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, resp
+	}
+
+	stale := []struct{ body, header string }{
+		{`{"path":"/notes.txt","content":"lost","ifModTime":"2024-05-01T11:59:59Z"}`, ""},
+		{`{"path":"/notes.txt","content":"lost"}`, "Wed, 01 May 2024 11:00:00 GMT"},
+		// The field wins over the header.
+		{`{"path":"/notes.txt","content":"lost","ifModTime":"2024-04-01T00:00:00Z"}`, "Wed, 01 May 2024 12:00:00 GMT"},
+	}
+	for _, tc := range stale {
+		code, resp := save(tc.body, tc.header)
+		if code != http.StatusPreconditionFailed || resp.ModTime != "2024-05-01T12:00:00Z" {
+			t.Errorf("%s %q: got %d %+v, want 412 with the current modTime", tc.body, tc.header, code, resp)
+		}
+	}
+	if got, _ := os.ReadFile(path); string(got) != "original" {
+		t.Fatalf("stale saves changed the file to %q", got)
+	}
+
+	code, resp := save(`{"path":"/notes.txt","content":"edited"}`, "Wed, 01 May 2024 12:00:00 GMT")
+	if code != http.StatusOK || resp.ModTime == "" {
+		t.Fatalf("current If-Unmodified-Since: got %d %+v, want 200 with a modTime", code, resp)
+	}
+	code, resp = save(`{"path":"/notes.txt","content":"edited again","ifModTime":"`+resp.ModTime+`"}`, "")
+	if code != http.StatusOK {
+		t.Fatalf("chained ifModTime: got %d %+v, want 200", code, resp)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "edited again" {
+		t.Errorf("content = %q, want the last save", got)
+	}
+
+	if code, _ := save(`{"path":"/gone.txt","content":"x","ifModTime":"2024-05-01T12:00:00Z"}`, ""); code != http.StatusPreconditionFailed {
+		t.Errorf("missing file: got %d, want 412", code)
+	}
+	if code, _ := save(`{"path":"/notes.txt","content":"x","ifModTime":"yesterday"}`, ""); code != http.StatusBadRequest {
+		t.Errorf("invalid ifModTime: got %d, want 400", code)
+	}
+	if code, _ := save(`{"path":"/notes.txt","content":"x"}`, "yesterday"); code != http.StatusBadRequest {
+		t.Errorf("invalid If-Unmodified-Since: got %d, want 400", code)
+	}
+}
+
+func TestHandleStorageTruncate(t *testing.T) {
+	dir := useTempStorage(t)
+	logPath := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(logPath, []byte("lots of log lines\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(logPath, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := doStorageJSON(t, handleStorageTruncate, http.MethodPost, "/api/storage/truncate", `{"path":"/app.log"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	after, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() != 0 {
+		t.Errorf("size = %d, want 0", after.Size())
+	}
+	if after.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %o, want 640 kept", after.Mode().Perm())
+	}
+	if !os.SameFile(before, after) {
+		t.Error("file was replaced, want it truncated in place")
+	}
+
+	for body, want := range map[string]int{
+		`{"path":"/missing.log"}`: http.StatusNotFound,
+		`{"path":"/"}`:            http.StatusBadRequest,
+		`{"path":"/../x"}`:        http.StatusBadRequest,
+	} {
+		if rec := doStorageJSON(t, handleStorageTruncate, http.MethodPost, "/api/storage/truncate", body); rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, want)
+		}
+	}
+}
+
+func TestGetFileRaw(t *testing.T) {
+	dir := useTempStorage(t)
+	files := map[string]string{
+		"data.json": `{"ok":true}`,
+		"notes":     "plain text\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		path     string
+		wantType string
+	}{
+		{"/data.json", "application/json"},
+		{"/notes", "text/plain; charset=utf-8"},
+	}
+	for _, tc := range cases {
+		rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"`+tc.path+`","raw":true}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", tc.path, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get(echo.HeaderContentType); got != tc.wantType {
+			t.Errorf("%s: Content-Type = %q, want %q", tc.path, got, tc.wantType)
+		}
+		if got, want := rec.Body.String(), files[strings.TrimPrefix(tc.path, "/")]; got != want {
+			t.Errorf("%s: body = %q, want %q", tc.path, got, want)
+		}
+		if rec.Header().Get(echo.HeaderLastModified) == "" {
+			t.Errorf("%s: no Last-Modified header", tc.path)
+		}
+	}
+
+	if rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/missing","raw":true}`); rec.Code != http.StatusNotFound {
+		t.Errorf("missing file: status = %d, want 404", rec.Code)
+	}
+	if rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/notes","raw":true,"tail":1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("raw with tail: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestMaxPathDepth(t *testing.T) {
+	useTempStorage(t)
+	appConfig.Storage.MaxPathDepth = 2
+
+	cases := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/a.txt", http.StatusOK},
+		{"/docs/a.txt", http.StatusOK},
+		{"//docs//a.txt", http.StatusOK},
+		{"/docs/2024/a.txt", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"`+tc.path+`","content":"x"}`)
+		if rec.Code != tc.wantStatus {
+			t.Errorf("%s: status = %d, want %d (%s)", tc.path, rec.Code, tc.wantStatus, rec.Body.String())
+		}
+	}
+	if rec := doStorageJSON(t, handleStorageMkdir, http.MethodPost, "/api/storage/mkdir", `{"path":"/a/b/c"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "over the limit of 2") {
+		t.Errorf("mkdir: got %d %s, want 400 over the limit", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStrictNames(t *testing.T) {
+	useTempStorage(t)
+	save := func(path string) int {
+		body, _ := json.Marshal(StorageRequest{Path: path, Content: "x"})
+		return doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", string(body)).Code
+	}
+
+	// Off by default, so such names are saved as before.
+	if code := save("/notes.txt."); code != http.StatusOK {
+		t.Errorf("strict_names off: status = %d, want 200", code)
+	}
+
+	appConfig.Storage.StrictNames = true
+	cases := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/docs/a.txt", http.StatusOK},
+		{"/docs/./b.txt", http.StatusOK},
+		{"/v1.2/c.txt", http.StatusOK},
+		{"/console.txt", http.StatusOK},
+		{"/line\nbreak.txt", http.StatusBadRequest},
+		{"/tab\there.txt", http.StatusBadRequest},
+		{"/bell\u0007.txt", http.StatusBadRequest},
+		{"/report.txt.", http.StatusBadRequest},
+		{"/report.txt ", http.StatusBadRequest},
+		{"/docs /a.txt", http.StatusBadRequest},
+		{"/CON", http.StatusBadRequest},
+		{"/nul.txt", http.StatusBadRequest},
+		{"/logs/com1.log", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if code := save(tc.path); code != tc.wantStatus {
+			t.Errorf("%q: status = %d, want %d", tc.path, code, tc.wantStatus)
+		}
+	}
+}
+
+// TestSaveFileDiskFull checks a write that fails with ENOSPC gets 507 with
+// the disk_full code, and other write errors a plain 500.
+func TestSaveFileDiskFull(t *testing.T) {
+	useTempStorage(t)
+	writeErr := error(&os.PathError{Op: "write", Path: "full.txt", Err: syscall.ENOSPC})
+	prev := saveFileData
+	saveFileData = func(string, []byte) error { return writeErr }
+	t.Cleanup(func() { saveFileData = prev })
+
+	rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/full.txt","content":"x"}`)
+	var resp StorageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusInsufficientStorage || resp.Code != storageCodeDiskFull {
+		t.Errorf("disk full: got %d %+v, want 507 with code %s", rec.Code, resp, storageCodeDiskFull)
+	}
+
+	writeErr = &os.PathError{Op: "write", Path: "full.txt", Err: syscall.EIO}
+	rec = doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/full.txt","content":"x"}`)
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), storageCodeDiskFull) {
+		t.Errorf("I/O error: got %d %s, want a 500 without a code", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSaveFileModTime(t *testing.T) {
+	dir := useTempStorage(t)
+
+	rec := doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage",
+		`{"path":"/synced.txt","content":"from elsewhere","modTime":"2024-04-30T08:15:00Z"}`)
+	var resp StorageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || resp.ModTime != "2024-04-30T08:15:00Z" {
+		t.Fatalf("got %d %+v, want 200 with the given modTime", rec.Code, resp)
+	}
+	info, err := os.Stat(filepath.Join(dir, "synced.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 4, 30, 8, 15, 0, 0, time.UTC); !info.ModTime().Equal(want) {
+		t.Errorf("file modTime = %v, want %v", info.ModTime(), want)
+	}
+
+	// Without modTime the file gets the time of the save.
+	rec = doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/synced.txt","content":"edited"}`)
+	if info, _ := os.Stat(filepath.Join(dir, "synced.txt")); rec.Code != http.StatusOK || time.Since(info.ModTime()) > time.Minute {
+		t.Errorf("plain save: got %d with modTime %v, want 200 and a recent modTime", rec.Code, info.ModTime())
+	}
+
+	rec = doStorageJSON(t, handleStorage, http.MethodPost, "/api/storage", `{"path":"/synced.txt","content":"x","modTime":"last week"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid modTime: got %d, want 400", rec.Code)
+	}
+}
+
+func TestGetFileParseJSON(t *testing.T) {
+	dir := useTempStorage(t)
+	files := map[string]string{
+		"app.json":    `{"theme": "dark", "id": 12345678901234567890}`,
+		"broken.json": `{"theme": `,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/app.json","parse":"json"}`)
+	var resp struct {
+		Success bool
+		Content string
+		Data    map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || !resp.Success || resp.Content != "" {
+		t.Fatalf("got %d %s, want 200 with data and no content", rec.Code, rec.Body)
+	}
+	// Large numbers come back exactly, not rounded through a float64.
+	if got := string(resp.Data["id"]); got != "12345678901234567890" {
+		t.Errorf("data.id = %s, want 12345678901234567890", got)
+	}
+
+	rec = doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/broken.json","parse":"json"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid JSON: got %d, want 422", rec.Code)
+	}
+	for _, body := range []string{
+		`{"path":"/app.json","parse":"yaml"}`,
+		`{"path":"/app.json","parse":"json","tail":1}`,
+		`{"path":"/app.json","parse":"json","raw":true}`,
+	} {
+		if rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestGetFileExpandEnv(t *testing.T) {
+	dir := useTempStorage(t)
+	t.Setenv("MOWA_TEST_HOST", "api.example.com")
+	if err := os.WriteFile(filepath.Join(dir, "app.yaml"), []byte("url: https://${MOWA_TEST_HOST}/v1\nprice: $5\nmissing: ${MOWA_TEST_UNSET}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"path":"/app.yaml","expandEnv":true}`
+	if rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", body); rec.Code != http.StatusForbidden {
+		t.Errorf("without storage.allow_expand_env: got %d, want 403", rec.Code)
+	}
+
+	appConfig.Storage.AllowExpandEnv = true
+	rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", body)
+	var resp StorageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := "url: https://api.example.com/v1\nprice: $5\nmissing: \n"; rec.Code != http.StatusOK || resp.Content != want {
+		t.Errorf("got %d %q, want 200 %q", rec.Code, resp.Content, want)
+	}
+
+	// Without the flag the placeholders are returned untouched.
+	rec = doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/app.yaml"}`)
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp.Content, "${MOWA_TEST_HOST}") {
+		t.Errorf("plain read expanded placeholders: %q", resp.Content)
+	}
+
+	if rec := doStorageJSON(t, handleStorage, http.MethodGet, "/api/storage", `{"path":"/app.yaml","expandEnv":true,"tail":1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expandEnv with tail: got %d, want 400", rec.Code)
+	}
+}
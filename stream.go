@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// streamPollInterval is how often a followed file is checked for growth.
+var streamPollInterval = 500 * time.Millisecond
+
+// streamKeepAliveInterval is how often an idle stream sends an SSE comment, so
+// proxies don't time it out and a gone client is noticed.
+const streamKeepAliveInterval = 15 * time.Second
+
+// streamChunkSize caps how much appended content goes into one event.
+const streamChunkSize = 64 * 1024
+
+// streamsClosing is closed when the server shuts down, ending open streams,
+// which would otherwise hold up the graceful shutdown until it times out.
+var (
+	streamsClosing   = make(chan struct{})
+	closeStreamsOnce sync.Once
+)
+
+// closeStreams ends every open stream. It is registered with the HTTP server's
+// shutdown.
+func closeStreams() {
+	closeStreamsOnce.Do(func() { close(streamsClosing) })
+}
+
+// @Summary Follow a file
+// @Description Stream content appended to a file as Server-Sent Events, like `tail -f`. The stream starts at the current end of the file; each event's data is the newly appended text. If the file is truncated or replaced by a shorter one, following restarts from its beginning. Not available with encryption at rest.
+// @Tags storage
+// @Produce text/event-stream
+// @Param path query string true "File path" default(/logs/app.log)
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path or not a file"
+// @Failure 404 {object} StorageResponse "File not found"
+// @Router /api/storage/stream [get]
+func handleStorageStream(c echo.Context) error {
+	path := c.QueryParam("path")
+	if path == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+	if storageCipher != nil {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "streaming is not available with encryption at rest",
+		})
+	}
+
+	fullPath, err := validateAndResolvePath(c, path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) {
+		return c.JSON(http.StatusNotFound, StorageResponse{
+			Success: false,
+			Error:   "file not found",
+		})
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "only files can be streamed",
+		})
+	}
+
+	// The stream stays open for as long as the client watches.
+	liftDeadlines(c)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	offset := info.Size()
+	poll := time.NewTicker(streamPollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-streamsClosing:
+			return nil
+		case <-keepAlive.C:
+			if _, err := io.WriteString(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case <-poll.C:
+			next, err := streamAppended(res, fullPath, offset)
+			if err != nil {
+				logWarnf("Stopped streaming %s: %v", fullPath, err)
+				return nil
+			}
+			offset = next
+		}
+	}
+}
+
+// streamAppended writes whatever was appended to path past offset as SSE
+// events and returns the new offset. A file now shorter than offset was
+// truncated or replaced, so it is followed again from the start.
+func streamAppended(w *echo.Response, path string, offset int64) (int64, error) {
+	f, err := openLockedFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return offset, err
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if info.Size() == offset {
+		return offset, nil
+	}
+
+	buf := make([]byte, streamChunkSize)
+	for offset < info.Size() {
+		n, err := f.ReadAt(buf, offset)
+		if n > 0 {
+			if err := writeSSEData(w, buf[:n]); err != nil {
+				return offset, err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return offset, err
+		}
+	}
+	w.Flush()
+	return offset, nil
+}
+
+// writeSSEData writes data as one SSE event, with a data: field per line so
+// clients reassemble it exactly (joining the lines with "\n").
+func writeSSEData(w io.Writer, data []byte) error {
+	var event bytes.Buffer
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fmt.Fprintf(&event, "data: %s\n", line)
+	}
+	event.WriteString("\n")
+	_, err := w.Write(event.Bytes())
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestStorageStreamFollowsAppends checks only content appended after the
+// stream opens is sent, as data: lines that rebuild it exactly.
+func TestStorageStreamFollowsAppends(t *testing.T) {
+	dir := useTempStorage(t)
+	prevInterval := streamPollInterval
+	streamPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { streamPollInterval = prevInterval })
+
+	logPath := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(logPath, []byte("old line\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.GET("/api/storage/stream", handleStorageStream)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/storage/stream?path=/app.log", nil)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get(echo.HeaderContentType); ct != "text/event-stream" {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("new line\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var data []string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		data = append(data, strings.TrimPrefix(line, "data: "))
+	}
+	if got := strings.Join(data, "\n"); got != "new line\n" {
+		t.Errorf("event data = %q, want %q", got, "new line\n")
+	}
+}
+
+func TestStorageStreamRejectsBadPaths(t *testing.T) {
+	dir := useTempStorage(t)
+	if err := os.Mkdir(filepath.Join(dir, "logs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for target, want := range map[string]int{
+		"/api/storage/stream":                     http.StatusBadRequest,
+		"/api/storage/stream?path=/missing.log":   http.StatusNotFound,
+		"/api/storage/stream?path=/logs":          http.StatusBadRequest,
+		"/api/storage/stream?path=/../etc/passwd": http.StatusBadRequest,
+	} {
+		e := echo.New()
+		e.GET("/api/storage/stream", handleStorageStream)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", target, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Actions selectable with messages.rate_limit_action, for sends beyond
+// messages.rate_limit_per_minute.
+const (
+	rateLimitQueue  = "queue"
+	rateLimitReject = "reject"
+)
+
+// errMessageRateLimited is reported for sends refused by the global rate limit.
+var errMessageRateLimited = errors.New("global message rate limit reached (messages.rate_limit_per_minute)")
+
+// messageThrottle caps iMessage sends across all requests, recipients and
+// background notifications, so the account as a whole isn't flagged by Apple.
+// Nil, the default, means unlimited.
+var messageThrottle *tokenBucket
+
+// initMessageThrottle sets up messageThrottle from messages.rate_limit_per_minute.
+func initMessageThrottle() {
+	messageThrottle = nil
+	if perMinute := appConfig.Messages.RateLimitPerMinute; perMinute > 0 {
+		messageThrottle = newTokenBucket(perMinute, time.Minute)
+	}
+}
+
+// tokenBucket is a rate limiter that allows bursts of up to its capacity and
+// refills at capacity tokens per period.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	// perToken is how long one token takes to refill.
+	perToken time.Duration
+	last     time.Time
+}
+
+// newTokenBucket returns a full bucket of capacity tokens refilled over period.
+func newTokenBucket(capacity int, period time.Duration) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		perToken: period / time.Duration(capacity),
+		last:     time.Now(),
+	}
+}
+
+// reserve takes a token and returns 0 if one is available, or else how long
+// until one will be.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = min(b.capacity, b.tokens+float64(now.Sub(b.last))/float64(b.perToken))
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(b.perToken))
+}
+
+// take takes a token. Without one available it fails with
+// errMessageRateLimited, or with queue waits for one until ctx is done.
+func (b *tokenBucket) take(ctx context.Context, queue bool) error {
+	for {
+		wait := b.reserve()
+		if wait == 0 {
+			return nil
+		}
+		if !queue {
+			return errMessageRateLimited
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(2, time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := b.take(context.Background(), false); err != nil {
+			t.Fatalf("take %d of a full bucket: %v", i+1, err)
+		}
+	}
+	if err := b.take(context.Background(), false); !errors.Is(err, errMessageRateLimited) {
+		t.Errorf("empty bucket, rejecting: err = %v, want errMessageRateLimited", err)
+	}
+
+	// Queued, a take waits for the refill, or until the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.take(ctx, true); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("empty bucket, queueing: err = %v, want the context's deadline", err)
+	}
+
+	fast := newTokenBucket(1, 20*time.Millisecond)
+	fast.take(context.Background(), false)
+	start := time.Now()
+	if err := fast.take(context.Background(), true); err != nil || time.Since(start) < 10*time.Millisecond {
+		t.Errorf("queued take: err %v after %v, want to wait for the refill", err, time.Since(start))
+	}
+}
+
+// TestSendMessagesThrottle checks sends beyond the global rate are rejected
+// when so configured, while email recipients aren't counted.
+func TestSendMessagesThrottle(t *testing.T) {
+	prev := appConfig
+	t.Cleanup(func() { appConfig = prev; messageThrottle = nil })
+	appConfig = defaultConfig()
+	appConfig.Messages.RateLimitPerMinute = 1
+	appConfig.Messages.RateLimitAction = rateLimitReject
+	initMessageThrottle()
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	results := sendMessages([]string{"+15550000001", "+15550000002"}, "hi")
+	if !results[0].Success || results[1].Success || !strings.Contains(*results[1].Error, "rate limit") {
+		t.Errorf("results = %+v, want the second send rate limited", results)
+	}
+	if len(*scripts) != 1 {
+		t.Errorf("osascript ran %d times, want 1", len(*scripts))
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Default HTTP server timeouts, used when server.*_timeout_seconds are not
+// set. They are generous for ordinary requests while still cutting off
+// clients that trickle in a request (slow-loris) or never read the response.
+const (
+	defaultReadTimeoutSeconds  = 60
+	defaultWriteTimeoutSeconds = 60
+	defaultIdleTimeoutSeconds  = 120
+	// defaultUploadTimeoutSeconds is long enough to upload the largest raw
+	// file or zip archive at about half a megabyte a second.
+	defaultUploadTimeoutSeconds = 600
+)
+
+// applyServerTimeouts sets the read, write and idle timeouts of s from cfg.
+// Headers get the read timeout too, so lifting a request's deadlines with
+// liftDeadlines never exposes the header read.
+func applyServerTimeouts(s *http.Server, cfg ServerConfig) {
+	s.ReadTimeout = time.Duration(cfg.ReadTimeoutSeconds) * time.Second
+	s.ReadHeaderTimeout = s.ReadTimeout
+	s.WriteTimeout = time.Duration(cfg.WriteTimeoutSeconds) * time.Second
+	s.IdleTimeout = time.Duration(cfg.IdleTimeoutSeconds) * time.Second
+}
+
+// liftDeadlines clears the server's read and write deadlines for the current
+// request. Handlers that legitimately outlast the timeouts call it before
+// starting: file streams, zip downloads and self-updates, which have no body
+// left to trickle. Writers that don't support deadlines, like test recorders,
+// are left alone.
+func liftDeadlines(c echo.Context) {
+	rc := http.NewResponseController(c.Response())
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+}
+
+// liftWriteDeadline clears only the server's write deadline, for handlers
+// whose work, not their small request body, can outlast it: message sends,
+// which are bounded by their own per-send timeout instead, and long storage
+// walks. The read deadline stays, so a client can't trickle in the body
+// forever.
+func liftWriteDeadline(c echo.Context) {
+	_ = http.NewResponseController(c.Response()).SetWriteDeadline(time.Time{})
+}
+
+// extendUploadDeadline gives a large upload server.upload_timeout_seconds to
+// arrive instead of the read timeout, and lifts the write deadline for
+// storing it. The body is still bounded, so a client can't trickle it in
+// forever.
+func extendUploadDeadline(c echo.Context) {
+	timeout := defaultUploadTimeoutSeconds * time.Second
+	if appConfig != nil && appConfig.Server.UploadTimeoutSeconds > 0 {
+		timeout = time.Duration(appConfig.Server.UploadTimeoutSeconds) * time.Second
+	}
+	rc := http.NewResponseController(c.Response())
+	_ = rc.SetReadDeadline(time.Now().Add(timeout))
+	_ = rc.SetWriteDeadline(time.Time{})
+}
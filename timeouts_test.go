@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestLiftDeadlines checks a handler that lifts its deadlines can outlast the
+// server's write timeout, while one that doesn't is cut off.
+func TestLiftDeadlines(t *testing.T) {
+	slow := func(lift bool) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if lift {
+				liftDeadlines(c)
+			}
+			time.Sleep(300 * time.Millisecond)
+			return c.String(http.StatusOK, "done")
+		}
+	}
+
+	e := echo.New()
+	e.GET("/lifted", slow(true))
+	e.GET("/bounded", slow(false))
+	srv := httptest.NewUnstartedServer(e)
+	applyServerTimeouts(srv.Config, ServerConfig{ReadTimeoutSeconds: 1, IdleTimeoutSeconds: 1})
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/lifted")
+	if err != nil {
+		t.Fatalf("lifted: %v", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "done" {
+		t.Errorf("lifted: body = %q, want done", body)
+	}
+
+	if res, err := http.Get(srv.URL + "/bounded"); err == nil {
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err == nil && string(body) == "done" {
+			t.Error("bounded: response arrived after the write timeout")
+		}
+	}
+}
+
+// TestLiftWriteDeadlineKeepsReadDeadline checks a handler that lifts only its
+// write deadline still can't be sent a body slower than the read timeout.
+func TestLiftWriteDeadlineKeepsReadDeadline(t *testing.T) {
+	readErr := make(chan error, 1)
+	e := echo.New()
+	e.POST("/", func(c echo.Context) error {
+		liftWriteDeadline(c)
+		_, err := io.ReadAll(c.Request().Body)
+		readErr <- err
+		return c.NoContent(http.StatusOK)
+	})
+	srv := httptest.NewUnstartedServer(e)
+	srv.Config.ReadTimeout = 200 * time.Millisecond
+	srv.Config.ReadHeaderTimeout = srv.Config.ReadTimeout
+	srv.Start()
+	defer srv.Close()
+
+	body, w := io.Pipe()
+	go func() {
+		w.Write([]byte(`{"to":`))
+		time.Sleep(500 * time.Millisecond)
+		w.Write([]byte(`[]}`))
+		w.Close()
+	}()
+	if res, err := http.Post(srv.URL, echo.MIMEApplicationJSON, body); err == nil {
+		res.Body.Close()
+	}
+
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Error("a body trickled in past the read timeout was read in full")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler never finished reading the body")
+	}
+}
+
+// TestExtendUploadDeadline checks an upload may take longer than the read
+// timeout to arrive, but not longer than the upload timeout.
+func TestExtendUploadDeadline(t *testing.T) {
+	prev := appConfig
+	appConfig = defaultConfig()
+	appConfig.Server.UploadTimeoutSeconds = 1
+	t.Cleanup(func() { appConfig = prev })
+
+	readErr := make(chan error, 1)
+	e := echo.New()
+	e.PUT("/", func(c echo.Context) error {
+		extendUploadDeadline(c)
+		_, err := io.ReadAll(c.Request().Body)
+		readErr <- err
+		return c.NoContent(http.StatusOK)
+	})
+	srv := httptest.NewUnstartedServer(e)
+	srv.Config.ReadTimeout = 200 * time.Millisecond
+	srv.Config.ReadHeaderTimeout = srv.Config.ReadTimeout
+	srv.Start()
+	defer srv.Close()
+
+	upload := func(pause time.Duration) error {
+		t.Helper()
+		body, w := io.Pipe()
+		go func() {
+			w.Write([]byte("first half,"))
+			time.Sleep(pause)
+			w.Write([]byte("second half"))
+			w.Close()
+		}()
+		req, _ := http.NewRequest(http.MethodPut, srv.URL, body)
+		if res, err := http.DefaultClient.Do(req); err == nil {
+			res.Body.Close()
+		}
+		select {
+		case err := <-readErr:
+			return err
+		case <-time.After(3 * time.Second):
+			t.Fatal("handler never finished reading the body")
+			return nil
+		}
+	}
+
+	if err := upload(400 * time.Millisecond); err != nil {
+		t.Errorf("upload slower than the read timeout failed: %v", err)
+	}
+	if err := upload(1500 * time.Millisecond); err == nil {
+		t.Error("an upload trickled in past the upload timeout was read in full")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// @Summary Touch a file
+// @Description Like touch(1): create an empty file (and any missing parent directories), or set the modification time of an existing file or directory without changing its content, e.g. for marker files. The time is now unless modTime is given. Optionally send notifications about the result.
+// @Tags storage
+// @Accept json
+// @Produce json
+// @Param request body StorageRequest true "Storage request (path, modTime and notify are used)"
+// @Success 200 {object} StorageResponse "File created or its modification time updated"
+// @Failure 400 {object} StorageResponse "Bad request - invalid path or modTime"
+// @Failure 507 {object} StorageResponse "Storage quota exceeded"
+// @Failure 500 {object} StorageResponse "Internal server error"
+// @Router /api/storage/touch [post]
+func handleStorageTouch(c echo.Context) error {
+	var req StorageRequest
+	if err := c.Bind(&req); err != nil {
+		logDebugf("Failed to parse request body: %v", err)
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "invalid request body",
+		})
+	}
+
+	if req.Path == "" {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "path is required",
+		})
+	}
+
+	if req.Notify != nil && len(req.Notify) == 0 {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   "notify field cannot be empty - either omit it or provide at least one recipient",
+		})
+	}
+
+	modTime, err := parseModTime(req.ModTime)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, StorageResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	}
+	now := time.Now()
+	if modTime == nil {
+		modTime = &now
+	}
+
+	fullPath, err := validateAndResolvePath(c, req.Path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	unlock := storageLocks.lock(fullPath)
+	defer unlock()
+
+	message := "File touched successfully"
+	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		if err := createEmptyStorageFile(fullPath); err != nil {
+			status, errorMsg := http.StatusInternalServerError, "failed to create file"
+			if errors.Is(err, errStorageQuotaExceeded) {
+				status, errorMsg = http.StatusInsufficientStorage, err.Error()
+				setQuotaHeader(c)
+			} else {
+				logErrorf("Failed to create file %s: %v", fullPath, err)
+			}
+			if len(req.Notify) > 0 {
+				go sendStorageNotification(req.Notify, "TOUCH", requestRelativePath(c, fullPath), false, "create file")
+			}
+			return c.JSON(status, StorageResponse{
+				Success: false,
+				Error:   errorMsg,
+			})
+		}
+		setQuotaHeader(c)
+		message = "File created successfully"
+	}
+
+	// The access time is bumped along with the modification time, as touch(1)
+	// does, unless an explicit modTime leaves it alone.
+	atime := now
+	if req.ModTime != "" {
+		atime = time.Time{}
+	}
+	if err := os.Chtimes(fullPath, atime, *modTime); err != nil {
+		logErrorf("Failed to set modification time of %s: %v", fullPath, err)
+		if len(req.Notify) > 0 {
+			go sendStorageNotification(req.Notify, "TOUCH", requestRelativePath(c, fullPath), false, "set modification time")
+		}
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to set modification time",
+		})
+	}
+
+	response := StorageResponse{
+		Success: true,
+		Content: message,
+	}
+	if info, err := os.Stat(fullPath); err == nil {
+		response.ModTime = formatModTime(info)
+		if info.Mode().IsRegular() {
+			response.Size = contentSize(info)
+		}
+	}
+
+	if len(req.Notify) > 0 {
+		go sendStorageNotification(req.Notify, "TOUCH", requestRelativePath(c, fullPath), true, "touched successfully")
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// createEmptyStorageFile creates an empty file at path, along with its parent
+// directories, charging the quota for what lands on disk (nothing, unless the
+// file is encrypted); errStorageQuotaExceeded means it didn't fit. No expiry
+// or download count left from an earlier file there applies to it. The caller
+// must hold the path's storageLocks lock.
+func createEmptyStorageFile(path string) error {
+	data, err := sealStorageData(nil)
+	if err != nil {
+		return err
+	}
+
+	size := int64(len(data))
+	if storageUsage != nil && !storageUsage.reserve(size) {
+		return errStorageQuotaExceeded
+	}
+	if err = mkdirStorage(filepath.Dir(path)); err == nil {
+		defer invalidateCachedFile(path)
+		err = writeStorageFile(path, data)
+	}
+	if err != nil {
+		if storageUsage != nil {
+			storageUsage.release(size)
+		}
+		return err
+	}
+	forgetStoredFile(path)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorageTouch(t *testing.T) {
+	dir := useTempStorage(t)
+
+	touch := func(body string) (int, StorageResponse) {
+		t.Helper()
+		rec := doStorageJSON(t, handleStorageTouch, http.MethodPost, "/api/storage/touch", body)
+		var resp StorageResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, resp
+	}
+
+	code, resp := touch(`{"path":"/markers/done"}`)
+	if code != http.StatusOK || resp.Content != "File created successfully" || resp.Size == nil || *resp.Size != 0 {
+		t.Fatalf("create: got %d %+v, want 200 with an empty new file", code, resp)
+	}
+	path := filepath.Join(dir, "markers", "done")
+	if content, err := os.ReadFile(path); err != nil || len(content) != 0 {
+		t.Fatalf("created file: %q, %v; want an empty file", content, err)
+	}
+
+	if err := os.WriteFile(path, []byte("keep me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, resp = touch(`{"path":"/markers/done","modTime":"2024-05-01T12:00:00Z"}`)
+	if code != http.StatusOK || resp.Content != "File touched successfully" || resp.ModTime != "2024-05-01T12:00:00Z" {
+		t.Fatalf("touch with modTime: got %d %+v", code, resp)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "keep me" {
+		t.Errorf("touch changed the content to %q", content)
+	}
+
+	code, _ = touch(`{"path":"/markers/done"}`)
+	if info, _ := os.Stat(path); code != http.StatusOK || time.Since(info.ModTime()) > time.Minute {
+		t.Errorf("touch: got %d with modTime %v, want 200 and a recent modTime", code, info.ModTime())
+	}
+
+	if code, resp = touch(`{"path":"/markers","modTime":"2024-05-01T12:00:00Z"}`); code != http.StatusOK || resp.Size != nil {
+		t.Errorf("touch directory: got %d %+v, want 200 without a size", code, resp)
+	}
+	if code, _ = touch(`{"path":"/markers/done","modTime":"soon"}`); code != http.StatusBadRequest {
+		t.Errorf("invalid modTime: got %d, want 400", code)
+	}
+	if code, _ = touch(`{"path":""}`); code != http.StatusBadRequest {
+		t.Errorf("missing path: got %d, want 400", code)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Limits of GET /api/storage/tree when storage.tree_max_depth and
+// storage.tree_max_nodes are not set.
+const (
+	defaultTreeMaxDepth = 10
+	defaultTreeMaxNodes = 10000
+)
+
+// defaultMaxListEntries is how many entries are read from any one directory
+// when listing it if storage.max_list_entries is not set.
+const defaultMaxListEntries = 100000
+
+// Types of a StorageTreeNode.
+const (
+	treeNodeFile      = "file"
+	treeNodeDirectory = "directory"
+)
+
+// @Summary Get a directory tree
+// @Description Return the files and directories under a directory as a nested tree, e.g. for a file browser. The tree goes depth levels deep (at most storage.tree_max_depth) and holds at most storage.tree_max_nodes entries, reading no more than storage.max_list_entries from any one directory; directories cut off by any of these limits are marked truncated. Symbolic links and other special files are left out. With since, only files modified after that time are returned, along with the directories leading to them, e.g. for incremental sync.
+// @Tags storage
+// @Produce json
+// @Param path query string false "Directory path (default: the storage root)" default(/)
+// @Param depth query int false "Levels to descend, 1 for just the directory's own contents (default and maximum: storage.tree_max_depth)"
+// @Param since query string false "Only files modified after this RFC 3339 time, which must include its offset, e.g. 2024-05-01T12:00:00Z"
+// @Success 200 {object} StorageTreeResponse "Directory tree"
+// @Failure 400 {object} StorageTreeResponse "Bad request - invalid path, depth or since, or not a directory"
+// @Failure 404 {object} StorageTreeResponse "Directory not found"
+// @Failure 500 {object} StorageTreeResponse "Internal server error"
+// @Router /api/storage/tree [get]
+func handleStorageTree(c echo.Context) error {
+	path := c.QueryParam("path")
+	if path == "" {
+		path = "/"
+	}
+
+	maxDepth := appConfig.Storage.TreeMaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultTreeMaxDepth
+	}
+	depth := maxDepth
+	if value := c.QueryParam("depth"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return c.JSON(http.StatusBadRequest, StorageTreeResponse{
+				Success: false,
+				Error:   "depth must be a positive number of levels",
+			})
+		}
+		depth = min(n, maxDepth)
+	}
+
+	// time.RFC3339 requires an offset, so since is never read in the
+	// server's own time zone.
+	var since time.Time
+	if value := c.QueryParam("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, StorageTreeResponse{
+				Success: false,
+				Error:   "since must be an RFC 3339 time with an offset, e.g. 2024-05-01T12:00:00Z",
+			})
+		}
+		since = t
+	}
+
+	root, err := validateAndResolvePath(c, path)
+	if err != nil {
+		return storagePathError(c, err)
+	}
+
+	info, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return c.JSON(http.StatusNotFound, StorageTreeResponse{
+			Success: false,
+			Error:   "directory not found",
+		})
+	}
+	if err != nil || !info.IsDir() {
+		return c.JSON(http.StatusBadRequest, StorageTreeResponse{
+			Success: false,
+			Error:   "path must be a directory",
+		})
+	}
+	if !withinStorageDir(c, root) {
+		return c.JSON(http.StatusBadRequest, StorageTreeResponse{
+			Success: false,
+			Error:   "path is outside of storage directory",
+		})
+	}
+
+	maxNodes := appConfig.Storage.TreeMaxNodes
+	if maxNodes <= 0 {
+		maxNodes = defaultTreeMaxNodes
+	}
+	maxEntries := appConfig.Storage.MaxListEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxListEntries
+	}
+	response, err := buildStorageTree(root, depth, maxNodes, maxEntries, since)
+	if response.Tree != nil {
+		response.Tree.Name = filepath.Base(requestRelativePath(c, root))
+	}
+	if err != nil {
+		logErrorf("Failed to build the tree of %s: %v", root, err)
+		return c.JSON(http.StatusInternalServerError, StorageTreeResponse{
+			Success: false,
+			Error:   "failed to read directory",
+		})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// buildStorageTree walks root up to depth levels down, stopping once maxNodes
+// files and directories have been added. No more than maxEntries entries are
+// read from any one directory. Expired files are left out, as they read as
+// gone. A non-zero since leaves out files not modified after it, and the
+// directories left with nothing in them.
+func buildStorageTree(root string, depth, maxNodes, maxEntries int, since time.Time) (StorageTreeResponse, error) {
+	response := StorageTreeResponse{
+		Success: true,
+		Tree:    &StorageTreeNode{Name: filepath.Base(storageRelativePath(root)), Type: treeNodeDirectory},
+	}
+	walker := treeWalker{depth: depth, maxNodes: maxNodes, maxEntries: maxEntries, since: since, response: &response}
+	err := walker.fill(response.Tree, root, 1)
+	return response, err
+}
+
+// treeWalker holds the state of one buildStorageTree walk.
+type treeWalker struct {
+	depth, maxNodes, maxEntries int
+	since                       time.Time
+	response                    *StorageTreeResponse
+	// full is set once maxNodes is reached, ending the walk.
+	full bool
+}
+
+// fill adds the contents of dir, level levels below the tree's root, to node.
+func (w *treeWalker) fill(node *StorageTreeNode, dir string, level int) error {
+	entries, truncated, err := readDirLimited(dir, w.maxEntries)
+	if err != nil {
+		return err
+	}
+	if truncated {
+		node.Truncated, w.response.Truncated = true, true
+	}
+
+	for _, d := range entries {
+		// Symbolic links are never followed; they are left out, like other
+		// special files.
+		if !d.IsDir() && !d.Type().IsRegular() {
+			continue
+		}
+		if w.response.Nodes >= w.maxNodes {
+			node.Truncated, w.response.Truncated = true, true
+			w.full = true
+			return nil
+		}
+
+		path := filepath.Join(dir, d.Name())
+		child := &StorageTreeNode{Name: d.Name(), Type: treeNodeDirectory}
+		if !d.IsDir() {
+			if storageExpiry.expired(path) {
+				continue
+			}
+			info, err := d.Info()
+			if err != nil {
+				// Removed since the directory was read.
+				continue
+			}
+			if !w.since.IsZero() && !info.ModTime().After(w.since) {
+				continue
+			}
+			size := storedContentSize(info)
+			child.Type, child.Size, child.ModTime = treeNodeFile, &size, formatModTime(info)
+		}
+		node.Children = append(node.Children, child)
+		w.response.Nodes++
+
+		if !d.IsDir() {
+			continue
+		}
+		if level >= w.depth {
+			if !isEmptyDir(path) {
+				child.Truncated, w.response.Truncated = true, true
+			}
+		} else if err := w.fill(child, path, level+1); err != nil {
+			// A directory removed or unreadable mid-walk is skipped, not fatal.
+			logWarnf("Directory tree skipped %s: %v", path, err)
+		}
+		// Filtered by since, a directory with nothing changed under it is
+		// dropped. One cut off by a limit stays, as it may hold changes.
+		if !w.since.IsZero() && len(child.Children) == 0 && !child.Truncated {
+			node.Children = node.Children[:len(node.Children)-1]
+			w.response.Nodes--
+		}
+		if w.full {
+			return nil
+		}
+	}
+	return nil
+}
+
+// readDirLimited returns the entries of dir sorted by name, reading no more
+// than limit of them; truncated reports whether any were left unread. Which
+// entries a truncated read returns depends on the file system's order.
+func readDirLimited(dir string, limit int) (entries []fs.DirEntry, truncated bool, err error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	entries, err = f.ReadDir(limit + 1)
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	if len(entries) > limit {
+		entries, truncated = entries[:limit], true
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, truncated, nil
+}
+
+// isEmptyDir reports whether the directory at path has no entries. One that
+// can't be read counts as not empty.
+func isEmptyDir(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	return err == io.EOF
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// doStorageTree gets the tree for query and decodes the response.
+func doStorageTree(t *testing.T, query string) (int, StorageTreeResponse) {
+	t.Helper()
+	rec := doStorageJSON(t, handleStorageTree, http.MethodGet, "/api/storage/tree"+query, "")
+	var resp StorageTreeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+// treeShape renders a tree as nested names, e.g. "docs(a.txt sub(b.txt))",
+// with "+" after truncated directories.
+func treeShape(node *StorageTreeNode) string {
+	if node.Type == treeNodeFile {
+		return node.Name
+	}
+	shape := node.Name + "("
+	for i, child := range node.Children {
+		if i > 0 {
+			shape += " "
+		}
+		shape += treeShape(child)
+	}
+	shape += ")"
+	if node.Truncated {
+		shape += "+"
+	}
+	return shape
+}
+
+func TestHandleStorageTree(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "docs/a.txt", "docs/sub/b.txt", "docs/sub/deep/c.txt", "top.txt")
+	if err := os.MkdirAll(filepath.Join(dir, "docs", "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "top.txt"), filepath.Join(dir, "docs", "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		query, want   string
+		nodes         int
+		wantTruncated bool
+	}{
+		{"?path=/docs", "docs(a.txt empty() sub(b.txt deep(c.txt)))", 6, false},
+		{"?path=/docs&depth=1", "docs(a.txt empty() sub()+)", 3, true},
+		{"", "/(docs(a.txt empty() sub(b.txt deep(c.txt))) top.txt)", 8, false},
+	}
+	for _, tc := range cases {
+		code, resp := doStorageTree(t, tc.query)
+		if code != http.StatusOK || resp.Tree == nil {
+			t.Errorf("%q: got %d %+v, want 200 with a tree", tc.query, code, resp)
+			continue
+		}
+		if got := treeShape(resp.Tree); got != tc.want || resp.Nodes != tc.nodes || resp.Truncated != tc.wantTruncated {
+			t.Errorf("%q: tree %s with %d nodes (truncated %v), want %s with %d (truncated %v)",
+				tc.query, got, resp.Nodes, resp.Truncated, tc.want, tc.nodes, tc.wantTruncated)
+		}
+	}
+
+	// The node limit cuts the walk short.
+	appConfig.Storage.TreeMaxNodes = 2
+	if _, resp := doStorageTree(t, "?path=/docs"); treeShape(resp.Tree) != "docs(a.txt empty())+" || !resp.Truncated {
+		t.Errorf("node limit: got %s (truncated %v), want docs(a.txt empty())+", treeShape(resp.Tree), resp.Truncated)
+	}
+
+	// The per-directory entry limit truncates just the directories it cuts.
+	appConfig.Storage.TreeMaxNodes = 0
+	appConfig.Storage.MaxListEntries = 2
+	if _, resp := doStorageTree(t, "?path=/docs/sub"); treeShape(resp.Tree) != "sub(b.txt deep(c.txt))" || resp.Truncated {
+		t.Errorf("entry limit, small directory: got %s (truncated %v), want sub(b.txt deep(c.txt))", treeShape(resp.Tree), resp.Truncated)
+	}
+	writeStorageFiles(t, dir, "many/1.txt", "many/2.txt", "many/3.txt")
+	if _, resp := doStorageTree(t, "?path=/many"); !resp.Tree.Truncated || !resp.Truncated || len(resp.Tree.Children) != 2 {
+		t.Errorf("entry limit: got %s (truncated %v), want 2 of 3 files, truncated", treeShape(resp.Tree), resp.Truncated)
+	}
+
+	for query, want := range map[string]int{
+		"?path=/top.txt":        http.StatusBadRequest,
+		"?path=/missing":        http.StatusNotFound,
+		"?path=/docs&depth=0":   http.StatusBadRequest,
+		"?path=/docs&depth=two": http.StatusBadRequest,
+	} {
+		if code, _ := doStorageTree(t, query); code != want {
+			t.Errorf("%q: status = %d, want %d", query, code, want)
+		}
+	}
+}
+
+func TestHandleStorageTreeSince(t *testing.T) {
+	dir := useTempStorage(t)
+	writeStorageFiles(t, dir, "docs/old.txt", "docs/new.txt", "docs/sub/old.txt", "docs/sub/deep/new.txt", "stale/old.txt")
+	if err := os.MkdirAll(filepath.Join(dir, "docs", "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	recent := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for name, modTime := range map[string]time.Time{
+		"docs/old.txt":          old,
+		"docs/new.txt":          recent,
+		"docs/sub/old.txt":      old,
+		"docs/sub/deep/new.txt": recent,
+		"stale/old.txt":         old,
+	} {
+		if err := os.Chtimes(filepath.Join(dir, name), time.Time{}, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		query, want string
+		nodes       int
+	}{
+		// 13:00+02:00 is 11:00 UTC, between the old and the new files.
+		{"?since=2024-05-01T13:00:00%2B02:00", "/(docs(new.txt sub(deep(new.txt))))", 5},
+		{"?since=2024-05-01T11:00:00Z&depth=2", "/(docs(new.txt sub()+))", 3},
+		{"?since=2024-05-01T12:00:00Z", "/()", 0},
+		{"?since=2024-05-01T09:00:00Z&path=/stale", "stale(old.txt)", 1},
+	}
+	for _, tc := range cases {
+		code, resp := doStorageTree(t, tc.query)
+		if code != http.StatusOK || resp.Tree == nil {
+			t.Errorf("%q: got %d %+v, want 200 with a tree", tc.query, code, resp)
+			continue
+		}
+		if got := treeShape(resp.Tree); got != tc.want || resp.Nodes != tc.nodes {
+			t.Errorf("%q: tree %s with %d nodes, want %s with %d", tc.query, got, resp.Nodes, tc.want, tc.nodes)
+		}
+	}
+
+	if _, resp := doStorageTree(t, "?path=/docs&since=2024-05-01T11:00:00Z&depth=1"); len(resp.Tree.Children) != 2 || resp.Tree.Children[0].ModTime != "2024-05-01T12:00:00Z" {
+		t.Errorf("modTime: got %+v, want new.txt modified 2024-05-01T12:00:00Z first", resp.Tree.Children)
+	}
+
+	for _, since := range []string{"2024-05-01T11:00:00", "2024-05-01", "yesterday"} {
+		if code, _ := doStorageTree(t, "?since="+since); code != http.StatusBadRequest {
+			t.Errorf("since %q: status = %d, want 400", since, code)
+		}
+	}
+}
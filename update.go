@@ -9,7 +9,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -97,6 +96,9 @@ func handleUpdate(c echo.Context) error {
 		})
 	}
 
+	// Downloading the release can outlast the server's write timeout.
+	liftDeadlines(c)
+
 	// Resolve the target release (explicit tag or latest).
 	release, status, err := resolveRelease(req.Version)
 	if err != nil {
@@ -203,10 +205,10 @@ func handleUpdate(c echo.Context) error {
 	// process would keep serving the old in-memory binary indefinitely.
 	writeErr := c.JSON(http.StatusOK, resp)
 	if writeErr != nil {
-		log.Printf("failed to write update response, restarting anyway: %v", writeErr)
+		logWarnf("failed to write update response, restarting anyway: %v", writeErr)
 	}
 
-	log.Printf("🔄 Updated from %s to %s; exiting to restart on the new binary", currentVersion, targetVersion)
+	logInfof("🔄 Updated from %s to %s; exiting to restart on the new binary", currentVersion, targetVersion)
 	go func() {
 		time.Sleep(restartDelay)
 		os.Exit(0)
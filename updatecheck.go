@@ -6,7 +6,6 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -104,7 +103,7 @@ func runCheckUpdates(args []string) error {
 	appConfig = cfg
 
 	if !cfg.SoftwareUpdateCheck.isEnabled() {
-		log.Printf("software update check is not configured (software_update_check.notify is empty or enabled is false); nothing to do")
+		logInfof("software update check is not configured (software_update_check.notify is empty or enabled is false); nothing to do")
 		return nil
 	}
 
@@ -140,9 +139,9 @@ func runCheckUpdates(args []string) error {
 	}
 
 	if len(restartUpdates) == 0 {
-		log.Printf("no restart-required updates available; not notifying")
+		logInfof("no restart-required updates available; not notifying")
 	} else if len(fresh) == 0 {
-		log.Printf("all %d restart-required update(s) already notified; not notifying again", len(restartUpdates))
+		logInfof("all %d restart-required update(s) already notified; not notifying again", len(restartUpdates))
 	}
 
 	sendFailed := false
@@ -152,14 +151,14 @@ func runCheckUpdates(args []string) error {
 			host = "this Mac"
 		}
 		message := updateNotificationMessage(host, fresh)
-		log.Printf("notifying %v: %s", cfg.SoftwareUpdateCheck.Notify, message)
+		logInfof("notifying %v: %s", cfg.SoftwareUpdateCheck.Notify, message)
 
 		anySuccess := false
 		for _, result := range sendMessages(expandGroups(cfg.SoftwareUpdateCheck.Notify), message) {
 			if result.Success {
 				anySuccess = true
 			} else if result.Error != nil {
-				log.Printf("⚠️ failed to notify %s: %s", result.Recipient, *result.Error)
+				logWarnf("⚠️ failed to notify %s: %s", result.Recipient, *result.Error)
 			}
 		}
 		// Only record the labels once someone actually received the message, so
@@ -291,13 +290,13 @@ func loadUpdateCheckState(path string) updateCheckState {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
-			log.Printf("⚠️ could not read update-check state %s (%v); assuming nothing notified", path, err)
+			logWarnf("⚠️ could not read update-check state %s (%v); assuming nothing notified", path, err)
 		}
 		return updateCheckState{}
 	}
 	var state updateCheckState
 	if err := json.Unmarshal(data, &state); err != nil {
-		log.Printf("⚠️ could not parse update-check state %s (%v); assuming nothing notified", path, err)
+		logWarnf("⚠️ could not parse update-check state %s (%v); assuming nothing notified", path, err)
 		return updateCheckState{}
 	}
 	return state
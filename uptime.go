@@ -1,20 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"net/http"
-	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
 // @Summary Get system uptime
-// @Description Get the current system uptime information
+// @Description Get the current system uptime information. Clients that ask for text/plain in Accept get just the formatted uptime.
 // @Tags system
 // @Produce json
+// @Produce plain
 // @Success 200 {object} UptimeResponse "Uptime information retrieved successfully"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /api/uptime [get]
@@ -27,6 +30,9 @@ func handleGetUptime(c echo.Context) error {
 		})
 	}
 
+	if negotiateFormat(c, formatJSON) == formatPlain {
+		return c.String(http.StatusOK, uptime.Formatted)
+	}
 	return c.JSON(http.StatusOK, uptime)
 }
 
@@ -46,26 +52,52 @@ func getUptime() (UptimeResponse, error) {
 	return formatUptimeResponse(uptime), nil
 }
 
-// getNativeUptime gets uptime using Go's time package
-func getNativeUptime() (float64, error) {
-	// This is a simplified approach - in a real implementation,
-	// you might use syscall to get boot time
-	// For now, we'll return an error to fall back to shell command
-	return 0, fmt.Errorf("native uptime not implemented")
+// getNativeUptime is implemented per platform: /proc/uptime on Linux
+// (uptime_linux.go), the kern.boottime sysctl on macOS and the BSDs
+// (uptime_bsd.go). Elsewhere it returns an error (uptime_other.go) and
+// getUptime falls back to the uptime command.
+
+// uptimeSince returns the seconds elapsed between boot and now.
+func uptimeSince(boot, now time.Time) (float64, error) {
+	if boot.IsZero() || boot.After(now) {
+		return 0, fmt.Errorf("invalid boot time %s", boot)
+	}
+	return now.Sub(boot).Seconds(), nil
 }
 
-// getShellUptime gets uptime using the uptime command
+// uptimeCommandAttempts is how many times getShellUptime runs the uptime
+// command before giving up, as it can fail momentarily under heavy load.
+const uptimeCommandAttempts = 3
+
+// uptimeRetryBackoff is the wait before the first retry of the uptime
+// command, doubling for each one after. A variable so tests can shorten it.
+var uptimeRetryBackoff = 100 * time.Millisecond
+
+// getShellUptime gets uptime using the uptime command, retrying failed runs.
+// Output that can't be parsed is not retried, as it would not change.
 func getShellUptime() (float64, error) {
-	cmd := exec.Command("uptime")
-	output, err := cmd.Output()
+	var output []byte
+	var err error
+	backoff := uptimeRetryBackoff
+	for attempt := 1; attempt <= uptimeCommandAttempts; attempt++ {
+		if output, err = runCommand(context.Background(), "uptime"); err == nil {
+			break
+		}
+		if attempt < uptimeCommandAttempts {
+			logDebugf("uptime command failed (attempt %d of %d), retrying in %s: %v", attempt, uptimeCommandAttempts, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to execute uptime command: %v", err)
+		return 0, fmt.Errorf("failed to execute uptime command after %d attempts: %v", uptimeCommandAttempts, err)
 	}
 
 	return parseUptimeOutput(string(output))
 }
 
-// parseUptimeOutput parses the uptime command output
+// parseUptimeOutput parses the uptime command output. The command only reports
+// whole minutes, so neither does the result.
 func parseUptimeOutput(output string) (float64, error) {
 	// Example output: " 12:34:56 up 2 days, 3:45, 2 users, load average: 1.23, 1.45, 1.67"
 
@@ -78,17 +110,24 @@ func parseUptimeOutput(output string) (float64, error) {
 	// Extract the part after "up"
 	afterUp := output[upIndex+2:]
 
-	// Split by comma to get the uptime part
-	parts := strings.Split(afterUp, ",")
-	if len(parts) == 0 {
+	// The uptime spans the comma-separated fields up to the user count or
+	// load average, e.g. "2 days, 3:45" or "1 day, 10 mins"
+	var uptimeParts []string
+	for _, part := range strings.Split(afterUp, ",") {
+		if strings.Contains(part, "user") || strings.Contains(part, "load") {
+			break
+		}
+		uptimeParts = append(uptimeParts, strings.TrimSpace(part))
+	}
+	if len(uptimeParts) == 0 {
 		return 0, fmt.Errorf("could not parse uptime component")
 	}
 
-	uptimeString := strings.TrimSpace(parts[0])
-	return parseUptimeString(uptimeString)
+	return parseUptimeString(strings.Join(uptimeParts, ", "))
 }
 
-// parseUptimeString parses uptime string like "2 days, 3:45" or "3:45" or "2 days"
+// parseUptimeString parses uptime string like "2 days, 3:45", "3:45",
+// "2 days", "1 day, 2 hrs" or "5 mins", rounding to whole minutes
 func parseUptimeString(uptimeString string) (float64, error) {
 	var totalSeconds float64
 
@@ -112,7 +151,25 @@ func parseUptimeString(uptimeString string) (float64, error) {
 		}
 	}
 
-	return totalSeconds, nil
+	// Check for hours, minutes and seconds spelled out ("2 hrs", "5 mins",
+	// "30 secs"), as printed for uptimes without an HH:MM part
+	unitPattern := regexp.MustCompile(`(\d+)\s+(hr|min|sec)`)
+	for _, match := range unitPattern.FindAllStringSubmatch(uptimeString, -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		switch match[2] {
+		case "hr":
+			totalSeconds += float64(n * 60 * 60)
+		case "min":
+			totalSeconds += float64(n * 60)
+		case "sec":
+			totalSeconds += float64(n)
+		}
+	}
+
+	return math.Round(totalSeconds/60) * 60, nil
 }
 
 // formatUptimeResponse formats uptime seconds into a human-readable response
@@ -0,0 +1,20 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// getNativeUptime derives uptime from the kern.boottime sysctl, which macOS
+// shares with the BSDs it descends from.
+func getNativeUptime() (float64, error) {
+	tv, err := unix.SysctlTimeval("kern.boottime")
+	if err != nil {
+		return 0, err
+	}
+	sec, nsec := tv.Unix()
+	return uptimeSince(time.Unix(sec, nsec), time.Now())
+}
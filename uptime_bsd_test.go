@@ -0,0 +1,15 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import "testing"
+
+func TestNativeUptimeFromBootTime(t *testing.T) {
+	seconds, err := getNativeUptime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seconds <= 0 {
+		t.Errorf("uptime = %v, want a positive number of seconds", seconds)
+	}
+}
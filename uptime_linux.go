@@ -0,0 +1,33 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// getNativeUptime reads the uptime the kernel reports in /proc/uptime.
+func getNativeUptime() (float64, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	return parseProcUptime(string(data))
+}
+
+// parseProcUptime parses /proc/uptime, e.g. "350735.47 234388.90": seconds
+// since boot, followed by the idle time summed across CPUs.
+func parseProcUptime(content string) (float64, error) {
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("could not parse /proc/uptime: %q", content)
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("could not parse /proc/uptime: %q", content)
+	}
+	return seconds, nil
+}
@@ -0,0 +1,25 @@
+//go:build linux
+
+package main
+
+import "testing"
+
+func TestParseProcUptime(t *testing.T) {
+	got, err := parseProcUptime("350735.47 234388.90\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 350735.47 {
+		t.Errorf("uptime = %v, want 350735.47", got)
+	}
+
+	for _, bad := range []string{"", "up 3 days", "-1 0"} {
+		if _, err := parseProcUptime(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+
+	if seconds, err := getNativeUptime(); err != nil || seconds <= 0 {
+		t.Errorf("getNativeUptime() = %v, %v", seconds, err)
+	}
+}
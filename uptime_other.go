@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package main
+
+import "errors"
+
+// getNativeUptime has no native source here; getUptime falls back to the
+// uptime command.
+func getNativeUptime() (float64, error) {
+	return 0, errors.New("native uptime not supported on this platform")
+}
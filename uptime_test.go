@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestGetShellUptime parses the output of a faked `uptime` command.
+func TestGetShellUptime(t *testing.T) {
+	prev := runCommand
+	t.Cleanup(func() { runCommand = prev })
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if name != "uptime" {
+			t.Fatalf("unexpected command %q", name)
+		}
+		return []byte(" 12:34  up 3:45, 2 users, load averages: 1.23 1.45 1.67\n"), nil
+	}
+
+	got, err := getShellUptime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := float64(3*3600 + 45*60); got != want {
+		t.Errorf("uptime = %v seconds, want %v", got, want)
+	}
+}
+
+// TestGetShellUptimeRetries checks a failing uptime command is retried, and
+// an error only reported once every attempt failed.
+func TestGetShellUptimeRetries(t *testing.T) {
+	prevRun, prevBackoff := runCommand, uptimeRetryBackoff
+	t.Cleanup(func() { runCommand, uptimeRetryBackoff = prevRun, prevBackoff })
+	uptimeRetryBackoff = time.Millisecond
+
+	var runs, failures int
+	runCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		runs++
+		if runs <= failures {
+			return nil, errors.New("resource temporarily unavailable")
+		}
+		return []byte(" 12:34  up 5 mins, 1 user, load averages: 9.99 9.99 9.99\n"), nil
+	}
+
+	failures = uptimeCommandAttempts - 1
+	if got, err := getShellUptime(); err != nil || got != 300 || runs != uptimeCommandAttempts {
+		t.Errorf("transient failures: got %v, %v after %d runs, want 300 on the last attempt", got, err, runs)
+	}
+
+	runs, failures = 0, uptimeCommandAttempts
+	if _, err := getShellUptime(); err == nil || runs != uptimeCommandAttempts {
+		t.Errorf("persistent failure: err %v after %d runs, want an error after %d", err, runs, uptimeCommandAttempts)
+	}
+}
+
+func TestUptimeSince(t *testing.T) {
+	boot := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	got, err := uptimeSince(boot, boot.Add(90*time.Minute+1500*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 5401.5 {
+		t.Errorf("uptime = %v, want 5401.5", got)
+	}
+	if resp := formatUptimeResponse(got); resp.Formatted != "1 hour, 30 minutes" {
+		t.Errorf("formatted = %q", resp.Formatted)
+	}
+
+	if _, err := uptimeSince(boot.Add(time.Hour), boot); err == nil {
+		t.Error("expected an error for a boot time in the future")
+	}
+}
+
+// TestParseUptimeOutput covers the uptime formats of Linux and macOS; the
+// command reports at most whole minutes, and so does the parsed result.
+func TestParseUptimeOutput(t *testing.T) {
+	for output, want := range map[string]float64{
+		" 12:34:56 up 2 days,  3:45,  2 users,  load average: 1.23, 1.45, 1.67": 2*86400 + 3*3600 + 45*60,
+		"10:01  up 1 day, 10 mins, 3 users, load averages: 2.01 1.98 1.90":      86400 + 10*60,
+		"10:01  up 3 days, 2 hrs, 1 user, load averages: 2.01 1.98 1.90":        3*86400 + 2*3600,
+		" 09:00:00 up 5 min,  1 user,  load average: 0.00, 0.01, 0.05":          5 * 60,
+		"10:01  up 40 secs, 1 user, load averages: 0.50 0.20 0.10":              60,
+	} {
+		got, err := parseUptimeOutput(output)
+		if err != nil {
+			t.Errorf("%q: %v", output, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: uptime = %v, want %v", output, got, want)
+		}
+	}
+}
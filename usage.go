@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// storageUsageCacheTTL is how long a computed usage report is reused, so
+// dashboards polling GET /api/storage/usage don't re-walk the tree each time.
+const storageUsageCacheTTL = 30 * time.Second
+
+// usageCache holds the last usage report of each storage directory, keyed by
+// the directory, so tenants with their own storage_dir get their own.
+var usageCache = struct {
+	mu      sync.Mutex
+	reports map[string]cachedUsage
+}{reports: make(map[string]cachedUsage)}
+
+// cachedUsage is a usage report and when it was computed.
+type cachedUsage struct {
+	report   StorageUsageResponse
+	computed time.Time
+}
+
+// @Summary Get storage usage
+// @Description Report the total size and number of files in the storage directory, or in the storage_dir of the API key used. Results are cached for a few seconds, so recent writes may not be reflected immediately. quotaBytes is left out for API keys with their own storage_dir, as storage.quota is shared by all of them.
+// @Tags storage
+// @Produce json
+// @Success 200 {object} StorageUsageResponse "Storage usage"
+// @Failure 500 {object} StorageResponse "Internal server error"
+// @Router /api/storage/usage [get]
+func handleStorageUsage(c echo.Context) error {
+	root := storageRoot(c)
+	report, err := storageUsageReport(root)
+	if err != nil {
+		logErrorf("Failed to compute storage usage: %v", err)
+		return c.JSON(http.StatusInternalServerError, StorageResponse{
+			Success: false,
+			Error:   "failed to compute storage usage",
+		})
+	}
+	if root != appConfig.Storage.Dir {
+		report.QuotaBytes = 0
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// storageUsageReport returns the cached usage report of dir, walking it again
+// once the cache is older than storageUsageCacheTTL.
+func storageUsageReport(dir string) (StorageUsageResponse, error) {
+	usageCache.mu.Lock()
+	defer usageCache.mu.Unlock()
+
+	if cached, ok := usageCache.reports[dir]; ok && time.Since(cached.computed) < storageUsageCacheTTL {
+		return cached.report, nil
+	}
+
+	total, files, err := directoryUsage(dir)
+	if err != nil {
+		return StorageUsageResponse{}, err
+	}
+	report := StorageUsageResponse{TotalBytes: total, Files: files}
+	if storageUsage != nil {
+		report.QuotaBytes = storageUsage.limit
+	}
+
+	usageCache.reports[dir] = cachedUsage{report: report, computed: time.Now()}
+	return report, nil
+}
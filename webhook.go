@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// webhookSignatureHeader carries the HMAC-SHA256 of an incoming webhook's
+// body, keyed with messages.webhook_secret, as "sha256=<hex>".
+const webhookSignatureHeader = "X-Mowa-Signature"
+
+// maxWebhookBodyBytes caps the body of an incoming webhook, which is a
+// message request and never needs to be large.
+const maxWebhookBodyBytes = 1 << 20
+
+// @Summary Send a message from a signed webhook
+// @Description Send a message like POST /api/messages, for requests from external services signed with messages.webhook_secret. The X-Mowa-Signature header must be "sha256=" followed by the hex HMAC-SHA256 of the raw request body keyed with the secret; requests without a valid signature are rejected before anything is sent. Disabled (404) unless messages.webhook_secret is set.
+// @Tags messages
+// @Accept json
+// @Produce json
+// @Param request body MessageRequest true "Message request"
+// @Param X-Mowa-Signature header string true "sha256=<hex HMAC-SHA256 of the body>"
+// @Success 200 {object} MessageResponse "Messages sent successfully"
+// @Failure 400 {object} map[string]interface{} "Bad request - invalid input"
+// @Failure 401 {object} map[string]interface{} "Missing or invalid signature"
+// @Failure 404 {object} map[string]interface{} "Webhooks are not enabled"
+// @Failure 413 {object} map[string]interface{} "Request body too large"
+// @Router /api/webhook/message [post]
+func handleWebhookMessage(c echo.Context) error {
+	secret := appConfig.Messages.WebhookSecret
+	if secret == "" {
+		return c.JSON(http.StatusNotFound, map[string]interface{}{
+			"error": "Webhooks are not enabled; set messages.webhook_secret",
+		})
+	}
+
+	req := c.Request()
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxWebhookBodyBytes+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Failed to read request body",
+		})
+	}
+	if len(body) > maxWebhookBodyBytes {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]interface{}{
+			"error": "Request body too large",
+		})
+	}
+
+	if !validWebhookSignature(secret, body, req.Header.Get(webhookSignatureHeader)) {
+		logWarnf("Rejected webhook from %s: missing or invalid %s", c.RealIP(), webhookSignatureHeader)
+		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Invalid webhook signature",
+		})
+	}
+
+	// The verified body is handled like any message request. Services that
+	// don't label their JSON still get it bound as such.
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if req.Header.Get(echo.HeaderContentType) == "" {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	return handleSendMessages(c)
+}
+
+// validWebhookSignature reports whether signature, "sha256=<hex>", is the
+// HMAC-SHA256 of body keyed with secret. The comparison takes constant time,
+// so it leaks nothing about the expected signature.
+func validWebhookSignature(secret string, body []byte, signature string) bool {
+	digest, ok := strings.CutPrefix(strings.TrimSpace(signature), "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
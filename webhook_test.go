@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestHandleWebhookMessage checks only requests signed with the configured
+// secret send their message.
+func TestHandleWebhookMessage(t *testing.T) {
+	prev := appConfig
+	appConfig = defaultConfig()
+	t.Cleanup(func() { appConfig = prev })
+	scripts := fakeOSAScript(t, func(string) ([]byte, error) { return nil, nil })
+
+	body := `{"to":["+15550000001"],"message":"Build #42 failed"}`
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	post := func(signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/webhook/message", strings.NewReader(body))
+		if signature != "" {
+			req.Header.Set(webhookSignatureHeader, signature)
+		}
+		rec := httptest.NewRecorder()
+		if err := handleWebhookMessage(echo.New().NewContext(req, rec)); err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	if rec := post(sign("s3cret")); rec.Code != http.StatusNotFound {
+		t.Errorf("without a secret: status = %d, want 404", rec.Code)
+	}
+
+	appConfig.Messages.WebhookSecret = "s3cret"
+	for name, signature := range map[string]string{
+		"missing":   "",
+		"wrong key": sign("guess"),
+		"no prefix": strings.TrimPrefix(sign("s3cret"), "sha256="),
+		"not hex":   "sha256=zz",
+		"truncated": sign("s3cret")[:20],
+	} {
+		if rec := post(signature); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s signature: status = %d, want 401", name, rec.Code)
+		}
+	}
+	if len(*scripts) != 0 {
+		t.Fatalf("osascript ran %d times for unsigned requests, want none", len(*scripts))
+	}
+
+	// A valid signature sends the message, even without a Content-Type.
+	if rec := post(sign("s3cret")); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"success":true`) {
+		t.Errorf("signed: got %d %s, want 200 with a successful send", rec.Code, rec.Body)
+	}
+	if len(*scripts) != 1 {
+		t.Errorf("osascript ran %d times, want 1", len(*scripts))
+	}
+}